@@ -0,0 +1,62 @@
+package bigquery
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"go.opentelemetry.io/collector/component"
+)
+
+// A client auth extension, e.g. oauth2client or googleclientauth, that
+// authenticates HTTP requests. The same method set as the collector's
+// extensionauth.HTTPClient, so any extension implementing it can be
+// referenced by Auth.
+type httpClientAuthenticator interface {
+	RoundTripper(base http.RoundTripper) (http.RoundTripper, error)
+}
+
+// The BigQuery client's transport with Auth set. The client is created with
+// the exporter, before the auth extension is available from the host, so
+// requests are sent through the extension's round tripper once start resolves
+// it.
+type authTransport struct {
+	mu        sync.RWMutex
+	transport http.RoundTripper
+}
+
+func (t *authTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.mu.RLock()
+	transport := t.transport
+	t.mu.RUnlock()
+	if transport == nil {
+		return nil, errors.New("auth extension not resolved: the exporter hasn't started")
+	}
+	return transport.RoundTrip(req)
+}
+
+// Look up the extension id among the host's extensions and send requests
+// through its round tripper.
+func (t *authTransport) resolve(host component.Host, id component.ID) error {
+	if host == nil {
+		return fmt.Errorf("auth extension %s not found: no host", id)
+	}
+	ext, ok := host.GetExtensions()[id]
+	if !ok {
+		return fmt.Errorf("auth extension %s not found", id)
+	}
+	authenticator, ok := ext.(httpClientAuthenticator)
+	if !ok {
+		return fmt.Errorf("extension %s isn't an HTTP client authenticator", id)
+	}
+	transport, err := authenticator.RoundTripper(http.DefaultTransport)
+	if err != nil {
+		return fmt.Errorf("auth extension %s: %w", id, err)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.transport = transport
+	return nil
+}
@@ -0,0 +1,89 @@
+package bigquery
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/component"
+	"go.opentelemetry.io/collector/component/componenttest"
+)
+
+func TestStartConsultsAuthExtension(t *testing.T) {
+	var authorization []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization = append(authorization, r.Header.Get("Authorization"))
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"etag": "etag0", "schema": {"fields": [{"name": "name", "type": "STRING"}]}}`)
+	}))
+	defer server.Close()
+	cfg := createTestConfig()
+	cfg.Endpoint = server.URL
+	cfg.Auth = component.MustNewID("googleclientauth")
+	ext := &fakeAuthExtension{token: "ext-token"}
+	host := &fakeHost{extensions: map[component.ID]component.Component{cfg.Auth: ext}}
+	sender, err := newBigQuerySender(cfg, cfg.Table, componenttest.NewNopTelemetrySettings())
+	require.NoError(t, err)
+
+	require.NoError(t, sender.start(context.Background(), host))
+
+	assert.Equal(t, 1, ext.calls, "The auth extension should be consulted at start")
+	assert.Equal(t, []string{"Bearer ext-token"}, authorization, "Requests should carry the extension's credentials")
+}
+
+func TestStartFailsWithoutAuthExtension(t *testing.T) {
+	cfg := createTestConfig()
+	cfg.Endpoint = "http://localhost:0"
+	cfg.Auth = component.MustNewID("googleclientauth")
+	sender, err := newBigQuerySender(cfg, cfg.Table, componenttest.NewNopTelemetrySettings())
+	require.NoError(t, err)
+
+	err = sender.start(context.Background(), &fakeHost{})
+	require.Error(t, err, "A missing auth extension should fail the start")
+	assert.Contains(t, err.Error(), "googleclientauth")
+
+	host := &fakeHost{extensions: map[component.ID]component.Component{cfg.Auth: &struct {
+		component.StartFunc
+		component.ShutdownFunc
+	}{}}}
+	err = sender.start(context.Background(), host)
+	require.Error(t, err, "An extension that can't authenticate HTTP requests should fail the start")
+	assert.Contains(t, err.Error(), "isn't an HTTP client authenticator")
+}
+
+// Fake host exposing the given extensions
+type fakeHost struct {
+	extensions map[component.ID]component.Component
+}
+
+func (h *fakeHost) GetExtensions() map[component.ID]component.Component {
+	return h.extensions
+}
+
+// Fake client auth extension that sets a bearer token and counts
+// RoundTripper calls
+type fakeAuthExtension struct {
+	component.StartFunc
+	component.ShutdownFunc
+	token string
+	calls int
+}
+
+func (e *fakeAuthExtension) RoundTripper(base http.RoundTripper) (http.RoundTripper, error) {
+	e.calls++
+	return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		req = req.Clone(req.Context())
+		req.Header.Set("Authorization", "Bearer "+e.token)
+		return base.RoundTrip(req)
+	}), nil
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
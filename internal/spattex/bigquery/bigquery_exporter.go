@@ -2,16 +2,34 @@ package bigquery
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net/http"
+	"os"
 	"reflect"
-	"strings"
+	"sort"
+	"sync"
 	"time"
 
 	"cloud.google.com/go/bigquery"
+	"cloud.google.com/go/bigquery/storage/managedwriter"
+	"cloud.google.com/go/compute/metadata"
+	"cloud.google.com/go/storage"
+	"go.opentelemetry.io/collector/component"
 	"go.opentelemetry.io/collector/config/configretry"
+	"go.opentelemetry.io/collector/consumer"
+	"go.opentelemetry.io/collector/consumer/consumererror"
 	"go.opentelemetry.io/collector/exporter"
 	"go.opentelemetry.io/collector/exporter/exporterhelper"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/plog"
+	"go.opentelemetry.io/collector/pdata/pmetric"
 	"go.opentelemetry.io/collector/pdata/ptrace"
+	"go.uber.org/zap"
+	"golang.org/x/sync/errgroup"
+	"golang.org/x/time/rate"
+	"google.golang.org/api/impersonate"
+	"google.golang.org/api/option"
 )
 
 /*
@@ -42,17 +60,24 @@ Batch size determination:
 ! It's useful to batch early in the pipeline. Also, if there's a need to tune batching,
 it's less of a lift to do so in the config used at deploy (no need to rebuild the
 Collector distribution binary). So, batching will be set in /builders/otelcol-config.yaml.
+For pipelines without a batch processor, InternalBatch coalesces small exports.
 */
 
-// Partitioning the table into single days is useful for efficient queries.
-const tablePartitionFieldKey = "ts"
+// Keep insert requests under the 10 MB request size limit, with headroom for
+// request overhead and error in the row size estimate.
+const maxInsertRequestBytes = 9 << 20
 
+// Streaming insert of rows into a table. Satisfied by *bigquery.Inserter.
+type rowInserter interface {
+	Put(ctx context.Context, src interface{}) error
+}
+
+// Default queue settings; override via sending_queue in the collector config.
 func TunedQueueSettings() exporterhelper.QueueBatchConfig {
-	return exporterhelper.QueueBatchConfig{
-		Enabled: true,
-	}
+	return exporterhelper.NewDefaultQueueConfig()
 }
 
+// Default retry settings; override via retry_on_failure in the collector config.
 func TunedRetrySettings() configretry.BackOffConfig {
 	return configretry.BackOffConfig{
 		Enabled:         true,
@@ -62,6 +87,7 @@ func TunedRetrySettings() configretry.BackOffConfig {
 	}
 }
 
+// Default timeout settings; override via timeout in the collector config.
 func TunedTimeoutSettings() exporterhelper.TimeoutConfig {
 	// Long-ish, to accommodate (occasional) target table schema updates.
 	return exporterhelper.TimeoutConfig{
@@ -72,176 +98,1274 @@ func TunedTimeoutSettings() exporterhelper.TimeoutConfig {
 type bigquerySender struct {
 	*Config
 	bigqueryClient *bigquery.Client
+	writeClient    *managedwriter.Client
+	tableID        string
+	logger         *zap.Logger
+	rows           *rowBuilder
+	inserter       rowInserter
+	shardInserter  func(suffix string) rowInserter
+	limiter        *rate.Limiter
+	telemetry      *exporterTelemetry
+	deadLetters    *deadLetterSink
+	fallback       *gcsFallback
+	datasetManager datasetManager
+	schemaManager  schemaManager
+	schema         schemaCache
+
+	// Exports in progress, which shutdown waits for.
+	inflight sync.WaitGroup
+
+	// Senders for the tables in RouteTableMapping, by table ID. Rows that
+	// aren't routed are sent to this sender's table.
+	routes map[string]*bigquerySender
+
+	// Sender for the ResourceTable, if one is configured.
+	resources *bigquerySender
+
+	// The client's transport, with Auth set. Resolved by start.
+	auth *authTransport
+
+	// Rows buffered by InternalBatch, if it's enabled.
+	buffer *rowBuffer
+}
+
+// Creates the BigQuery client. Replaced in tests to inspect client options.
+var newBigQueryClient = bigquery.NewClient
+
+// Creates the Storage Write API client, which uses gRPC. Replaced in tests.
+var newWriteClient = managedwriter.NewClient
+
+// Creates the token source for ImpersonateServiceAccount. Replaced in tests.
+var newImpersonatedTokenSource = impersonate.CredentialsTokenSource
+
+// The BigQuery emulator address, as host:port. Used when no endpoint is
+// configured.
+const emulatorHostEnv = "BIGQUERY_EMULATOR_HOST"
+
+// The environment variable checked for the project ID when none is
+// configured.
+const projectEnv = "GOOGLE_CLOUD_PROJECT"
+
+// Looks up the project ID from the GCE metadata server. Replaced in tests.
+var metadataProjectID = func(ctx context.Context) (string, error) {
+	if !metadata.OnGCE() {
+		return "", errors.New("not running on GCE")
+	}
+	return metadata.ProjectIDWithContext(ctx)
+}
+
+// The configured project ID or, if unset, the one from the environment or
+// the metadata server, so images can be deployed across projects unchanged.
+func resolveProjectID(ctx context.Context, cfg *Config) (string, error) {
+	if cfg.ProjectID != "" {
+		return cfg.ProjectID, nil
+	}
+	if projectID := os.Getenv(projectEnv); projectID != "" {
+		return projectID, nil
+	}
+	projectID, err := metadataProjectID(ctx)
+	if err != nil || projectID == "" {
+		return "", fmt.Errorf("projectID not configured, %s not set, and not available from the metadata server: %v", projectEnv, err)
+	}
+	return projectID, nil
 }
 
-func newBigQuerySender(cfg *Config) (*bigquerySender, error) {
-	client, err := bigquery.NewClient(context.Background(), cfg.ProjectID)
+// Client options from config. Without credentials in config, the client
+// authenticates with Application Default Credentials.
+func clientOptions(cfg *Config) []option.ClientOption {
+	var opts []option.ClientOption
+	if cfg.Endpoint != "" {
+		opts = append(opts, option.WithEndpoint(cfg.Endpoint))
+	} else if host := os.Getenv(emulatorHostEnv); host != "" {
+		// The emulator doesn't authenticate requests.
+		opts = append(opts, option.WithEndpoint("http://"+host), option.WithoutAuthentication())
+	}
+	if cfg.CredentialsFile != "" {
+		opts = append(opts, option.WithCredentialsFile(cfg.CredentialsFile))
+	}
+	if cfg.CredentialsJSON != "" {
+		opts = append(opts, option.WithCredentialsJSON([]byte(cfg.CredentialsJSON)))
+	}
+	return opts
+}
+
+// Options for the GCS client for GCSFallbackBucket. Endpoint and the
+// emulator host are BigQuery's, so the client connects to GCS, or to
+// STORAGE_EMULATOR_HOST if it's set. Impersonation and Auth apply to it like
+// to the BigQuery client.
+func storageClientOptions(cfg *Config) []option.ClientOption {
+	return writeClientOptions(cfg)
+}
+
+// Scopes for the impersonated service account's tokens.
+func impersonationScopes(cfg *Config) []string {
+	if cfg.GCSFallbackBucket != "" {
+		return []string{bigquery.Scope, storage.ScopeReadWrite}
+	}
+	return []string{bigquery.Scope}
+}
+
+// Options for the Storage Write API client. Endpoint and the emulator host
+// are REST endpoints, so the client connects to the default gRPC endpoint.
+func writeClientOptions(cfg *Config) []option.ClientOption {
+	var opts []option.ClientOption
+	if cfg.CredentialsFile != "" {
+		opts = append(opts, option.WithCredentialsFile(cfg.CredentialsFile))
+	}
+	if cfg.CredentialsJSON != "" {
+		opts = append(opts, option.WithCredentialsJSON([]byte(cfg.CredentialsJSON)))
+	}
+	return opts
+}
+
+func newBigQuerySender(cfg *Config, tableID string, settings component.TelemetrySettings) (*bigquerySender, error) {
+	telemetry, err := newExporterTelemetry(settings)
+	if err != nil {
+		return nil, fmt.Errorf("create telemetry: %w", err)
+	}
+
+	projectID, err := resolveProjectID(context.Background(), cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	opts, writeOpts, storageOpts := clientOptions(cfg), writeClientOptions(cfg), storageClientOptions(cfg)
+	if cfg.ImpersonateServiceAccount != "" {
+		// Impersonate with Application Default Credentials.
+		ts, err := newImpersonatedTokenSource(context.Background(), impersonate.CredentialsConfig{
+			TargetPrincipal: cfg.ImpersonateServiceAccount,
+			Delegates:       cfg.ImpersonateDelegates,
+			Scopes:          impersonationScopes(cfg),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("impersonate %s: %w", cfg.ImpersonateServiceAccount, err)
+		}
+		opts = append(opts, option.WithTokenSource(ts))
+		writeOpts = append(writeOpts, option.WithTokenSource(ts))
+		storageOpts = append(storageOpts, option.WithTokenSource(ts))
+	}
+
+	var auth *authTransport
+	if cfg.hasAuth() {
+		auth = &authTransport{}
+		opts = append(opts, option.WithHTTPClient(&http.Client{Transport: auth}))
+		storageOpts = append(storageOpts, option.WithHTTPClient(&http.Client{Transport: auth}))
+	}
+
+	client, err := newBigQueryClient(context.Background(), projectID, opts...)
 	if err != nil {
 		return nil, fmt.Errorf("create bigquery client: %w", err)
 	}
-	defer client.Close()
+	client.Location = cfg.Location
+
+	var writeClient *managedwriter.Client
+	if cfg.useStorageWriteAPI() {
+		writeClient, err = newWriteClient(context.Background(), projectID, writeOpts...)
+		if err != nil {
+			client.Close()
+			return nil, fmt.Errorf("create bigquery storage write client: %w", err)
+		}
+	}
+
+	sender := newTableSender(cfg, client, writeClient, tableID, settings.Logger)
+	sender.telemetry = telemetry
+	sender.auth = auth
+	if cfg.InternalBatch.MaxRows > 0 {
+		sender.buffer = &rowBuffer{}
+	}
+	if cfg.DeadLetterTable != "" {
+		sender.deadLetters = &deadLetterSink{
+			tableID:  cfg.DeadLetterTable,
+			inserter: dataset(cfg, client).Table(cfg.DeadLetterTable).Inserter(),
+		}
+	}
+	if cfg.GCSFallbackBucket != "" {
+		gcs, err := newStorageClient(context.Background(), storageOpts...)
+		if err != nil {
+			client.Close()
+			if writeClient != nil {
+				writeClient.Close()
+			}
+			return nil, fmt.Errorf("create gcs client: %w", err)
+		}
+		sender.fallback = &gcsFallback{
+			bucket: cfg.GCSFallbackBucket,
+			writer: gcsBucket{handle: gcs.Bucket(cfg.GCSFallbackBucket)},
+			client: gcs,
+		}
+	}
+	if cfg.MaxRequestsPerSecond > 0 {
+		sender.limiter = rate.NewLimiter(rate.Limit(cfg.MaxRequestsPerSecond), 1)
+	}
+	sender.addResourceTable()
+	return sender, nil
+}
+
+// The configured dataset, which may be in a different project than the
+// client, e.g. when writing to a shared data lake.
+func dataset(cfg *Config, client *bigquery.Client) *bigquery.Dataset {
+	if cfg.DatasetProjectID != "" && cfg.DatasetProjectID != client.Project() {
+		return client.DatasetInProject(cfg.DatasetProjectID, cfg.Dataset)
+	}
+	return client.Dataset(cfg.Dataset)
+}
 
+// A sender for one table, using existing clients. writeClient is only used
+// with the Storage Write API.
+func newTableSender(cfg *Config, client *bigquery.Client, writeClient *managedwriter.Client, tableID string, logger *zap.Logger) *bigquerySender {
+	dataset := dataset(cfg, client)
+	table := dataset.Table(tableID)
 	sender := &bigquerySender{
 		Config:         cfg,
 		bigqueryClient: client,
+		writeClient:    writeClient,
+		tableID:        tableID,
+		logger:         logger,
+		rows:           newRowBuilder(cfg, logger),
+		inserter:       newInserter(cfg, table),
+		datasetManager: dataset,
+		schemaManager:  table,
+		shardInserter: func(suffix string) rowInserter {
+			inserter := newInserter(cfg, table)
+			inserter.TableTemplateSuffix = suffix
+			return inserter
+		},
 	}
+	if cfg.useStorageWriteAPI() {
+		tablePath := managedwriter.TableParentFromParts(table.ProjectID, table.DatasetID, table.TableID)
+		sender.inserter = newStorageWriteInserter(writeClient, tablePath, &sender.schema, table)
+	}
+	return sender
+}
 
-	return sender, nil
+// A streaming inserter for table, with the configured insert options.
+func newInserter(cfg *Config, table *bigquery.Table) *bigquery.Inserter {
+	inserter := table.Inserter()
+	inserter.SkipInvalidRows = cfg.SkipInvalidRows
+	inserter.IgnoreUnknownValues = cfg.IgnoreUnknownValues
+	return inserter
+}
+
+// Add a sender for each table that rows may be routed to.
+func (s *bigquerySender) addRoutes() {
+	if s.RouteByAttribute == "" {
+		return
+	}
+	s.routes = make(map[string]*bigquerySender, len(s.RouteTableMapping))
+	for _, tableID := range s.RouteTableMapping {
+		if _, ok := s.routes[tableID]; !ok && tableID != s.tableID {
+			route := newTableSender(s.Config, s.bigqueryClient, s.writeClient, tableID, s.logger)
+			// Routed tables count against the same project quotas.
+			route.limiter = s.limiter
+			route.telemetry = s.telemetry
+			route.deadLetters = s.deadLetters
+			route.fallback = s.fallback
+			s.routes[tableID] = route
+		}
+	}
 }
 
+// Rows are built from the incoming pdata without modifying it, so the
+// pipeline can share it with other consumers rather than copy it. A change
+// that modifies it, e.g. a transform applied before rows are built, must set
+// MutatesData.
+var capabilities = consumer.Capabilities{MutatesData: false}
+
 func newRowsExporter(cfg *Config, settings exporter.Settings) (exporter.Traces, error) {
-	sender, err := newBigQuerySender(cfg)
+	sender, err := newBigQuerySender(cfg, cfg.Table, settings.TelemetrySettings)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create traces exporter: %w", err)
 	}
+	sender.addRoutes()
 
 	return exporterhelper.NewTraces(
 		context.Background(),
 		settings,
 		cfg,
 		sender.consumeTraces,
-		exporterhelper.WithQueue(TunedQueueSettings()),
-		exporterhelper.WithRetry(TunedRetrySettings()),
-		exporterhelper.WithTimeout(TunedTimeoutSettings()),
+		exporterhelper.WithStart(sender.start),
+		exporterhelper.WithShutdown(sender.shutdown),
+		exporterhelper.WithCapabilities(capabilities),
+		exporterhelper.WithQueue(cfg.QueueBatchConfig),
+		exporterhelper.WithRetry(cfg.BackOffConfig),
+		exporterhelper.WithTimeout(cfg.TimeoutConfig),
 	)
 }
 
-func (s *bigquerySender) consumeTraces(ctx context.Context, td ptrace.Traces) error {
-	rows := buildRows(td)
-	err := s.sendRows(ctx, rows)
+// Fetch the table schema before the first batch arrives, warming the schema
+// cache. A missing table or inaccessible dataset fails the collector start,
+// unless the exporter is configured to create them. A table created from the
+// first batch (AutodetectSchemaFromFirstBatch) is cached, and isn't probed
+// (RunStartupProbe), once it's created. The Auth extension is resolved from
+// host first, failing the start if it's missing.
+func (s *bigquerySender) start(ctx context.Context, host component.Host) error {
+	if s.auth != nil {
+		if err := s.auth.resolve(host, s.Auth); err != nil {
+			return err
+		}
+	}
+
+	if s.CreateIfMissing {
+		if err := s.createIfMissing(ctx); err != nil {
+			return err
+		}
+	}
+
+	s.schema.mu.Lock()
+	pendingCreate := s.schema.pendingCreate
+	s.schema.mu.Unlock()
+	if !pendingCreate {
+		if err := s.loadSchema(ctx); err != nil {
+			return err
+		}
+		if !s.SchemaFlexible {
+			s.checkRigidSchema()
+		}
+		if s.RunStartupProbe {
+			if err := s.probe(ctx); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, route := range s.routes {
+		if err := route.start(ctx, nil); err != nil {
+			return err
+		}
+	}
+	if s.resources != nil {
+		return s.resources.start(ctx, nil)
+	}
+	return nil
+}
+
+// Insert rows buffered by InternalBatch, wait for exports in progress to
+// finish, then close the clients. The sending queue, if enabled, is drained
+// before shutdown is called. Returns an error if exports are still in
+// progress after ShutdownTimeout, or when ctx is done, whichever comes first.
+// The clients are closed regardless.
+func (s *bigquerySender) shutdown(ctx context.Context) error {
+	err := s.flushBuffer(ctx)
+	err = errors.Join(err, s.drain(ctx))
+	// Routes share the clients.
+	if s.writeClient != nil {
+		err = errors.Join(err, s.writeClient.Close())
+	}
+	if s.bigqueryClient != nil {
+		err = errors.Join(err, s.bigqueryClient.Close())
+	}
+	if s.fallback != nil && s.fallback.client != nil {
+		err = errors.Join(err, s.fallback.client.Close())
+	}
+	return err
+}
+
+// Wait for exports in progress to finish, for at most ShutdownTimeout.
+func (s *bigquerySender) drain(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		s.inflight.Wait()
+		close(done)
+	}()
+
+	timer := time.NewTimer(s.ShutdownTimeout)
+	defer timer.Stop()
+	select {
+	case <-done:
+		return nil
+	case <-timer.C:
+		return fmt.Errorf("exports to %s still in progress after %v", s.tableID, s.ShutdownTimeout)
+	case <-ctx.Done():
+		return fmt.Errorf("exports to %s still in progress: %w", s.tableID, ctx.Err())
+	}
+}
+
+func (s *bigquerySender) loadSchema(ctx context.Context) error {
+	s.schema.mu.Lock()
+	defer s.schema.mu.Unlock()
+
+	if err := s.schema.load(ctx, s.schemaManager); err != nil {
+		return fmt.Errorf("table metadata for %s.%s: %w", s.Dataset, s.tableID, err)
+	}
+	// Inserts into views fail with errors that don't say why.
+	switch s.schema.tableType {
+	case bigquery.ViewTable, bigquery.MaterializedView:
+		return fmt.Errorf("%s.%s is a %s, and rows can only be inserted into tables: configure the table the view selects from",
+			s.Dataset, s.tableID, s.schema.tableType)
+	}
+	return nil
+}
+
+// Warn if a rigid schema is missing columns that every row is written with,
+// since every insert will then fail.
+func (s *bigquerySender) checkRigidSchema() {
+	columns := []string{s.partitionField()}
+	if s.IngestTimestampColumn != "" {
+		columns = append(columns, s.IngestTimestampColumn)
+	}
+	if s.NestResource {
+		columns = append(columns, resourceColumn)
+	}
+
+	s.schema.mu.Lock()
+	defer s.schema.mu.Unlock()
+	var missing []string
+	for _, column := range columns {
+		if _, ok := s.schema.types[column]; !ok {
+			missing = append(missing, column)
+		}
+	}
+	if len(missing) > 0 {
+		s.logger.Warn("Table schema is missing columns every row is written with, and schemaFlexible is off, so every insert will fail",
+			zap.String("table", s.tableID),
+			zap.Strings("columns", missing))
+	}
+}
+
+// Warn about row columns missing from a rigid schema. BigQuery rejects the
+// rows, which are dropped rather than retried. Each column is only reported
+// once, and only once the schema is cached: a rigid schema isn't fetched
+// just to report them.
+func (sender *bigquerySender) warnUnmappedColumns(rows []bigqueryrow) {
+	sender.schema.mu.Lock()
+	defer sender.schema.mu.Unlock()
+	if !sender.schema.loaded {
+		return
+	}
+
+	var missing []string
+	for _, row := range rows {
+		for column := range row {
+			if _, ok := sender.schema.types[column]; ok || sender.schema.unmapped[column] {
+				continue
+			}
+			if sender.schema.unmapped == nil {
+				sender.schema.unmapped = map[string]bool{}
+			}
+			sender.schema.unmapped[column] = true
+			missing = append(missing, column)
+		}
+	}
+	if len(missing) == 0 {
+		return
+	}
+	sort.Strings(missing)
+	sender.logger.Warn("Dropping rows with columns missing from the table schema. Add the columns, exclude the attributes or enable schemaFlexible to export them",
+		zap.String("table", sender.tableID),
+		zap.Strings("columns", missing))
+}
+
+// Log records are exported with the same machinery as spans, to their own
+// table if one is configured.
+func newLogsExporter(cfg *Config, settings exporter.Settings) (exporter.Logs, error) {
+	sender, err := newBigQuerySender(cfg, cfg.logsTable(), settings.TelemetrySettings)
 	if err != nil {
-		fmt.Printf("Error pushing traces: %v\n", err)
+		return nil, fmt.Errorf("failed to create logs exporter: %w", err)
+	}
+
+	return exporterhelper.NewLogs(
+		context.Background(),
+		settings,
+		cfg,
+		sender.consumeLogs,
+		exporterhelper.WithStart(sender.start),
+		exporterhelper.WithShutdown(sender.shutdown),
+		exporterhelper.WithCapabilities(capabilities),
+		exporterhelper.WithQueue(cfg.QueueBatchConfig),
+		exporterhelper.WithRetry(cfg.BackOffConfig),
+		exporterhelper.WithTimeout(cfg.TimeoutConfig),
+	)
+}
+
+// Metric data points are exported with the same machinery as spans, to their
+// own table if one is configured.
+func newMetricsExporter(cfg *Config, settings exporter.Settings) (exporter.Metrics, error) {
+	sender, err := newBigQuerySender(cfg, cfg.metricsTable(), settings.TelemetrySettings)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create metrics exporter: %w", err)
+	}
+
+	return exporterhelper.NewMetrics(
+		context.Background(),
+		settings,
+		cfg,
+		sender.consumeMetrics,
+		exporterhelper.WithStart(sender.start),
+		exporterhelper.WithShutdown(sender.shutdown),
+		exporterhelper.WithCapabilities(capabilities),
+		exporterhelper.WithQueue(cfg.QueueBatchConfig),
+		exporterhelper.WithRetry(cfg.BackOffConfig),
+		exporterhelper.WithTimeout(cfg.TimeoutConfig),
+	)
+}
+
+func (s *bigquerySender) consumeTraces(ctx context.Context, td ptrace.Traces) error {
+	s.inflight.Add(1)
+	defer s.inflight.Done()
+
+	drops := &attributeDrops{}
+	ctx = contextWithAttributeDrops(ctx, drops)
+	settled := &settledRows{}
+	ctx = contextWithSettledRows(ctx, settled)
+	if err := s.sendResourceRows(ctx, s.rows.withDrops(drops), traceResources(td)); err != nil {
+		return classifyError(err, s.SchemaFlexible)
+	}
+	if s.StreamingRowBuild {
+		// Each span is one row.
+		s.telemetry.recordExportRows(ctx, s.tableID, td.SpanCount())
+		return unsettledTracesError(s.streamRows(ctx, s.rows.withDrops(drops), td), td, settled)
+	}
+
+	rows := s.rows.withDrops(drops).buildRows(td)
+	s.telemetry.recordExportRows(ctx, s.tableID, len(rows))
+	return unsettledTracesError(classifyError(s.sendOrBufferRows(ctx, rows), s.SchemaFlexible), td, settled)
+}
+
+func (s *bigquerySender) consumeLogs(ctx context.Context, ld plog.Logs) error {
+	s.inflight.Add(1)
+	defer s.inflight.Done()
+
+	drops := &attributeDrops{}
+	ctx = contextWithAttributeDrops(ctx, drops)
+	settled := &settledRows{}
+	ctx = contextWithSettledRows(ctx, settled)
+	if err := s.sendResourceRows(ctx, s.rows.withDrops(drops), logResources(ld)); err != nil {
+		return classifyError(err, s.SchemaFlexible)
+	}
+	rows := s.rows.withDrops(drops).buildLogRows(ld)
+	s.telemetry.recordExportRows(ctx, s.tableID, len(rows))
+	return unsettledLogsError(classifyError(s.sendOrBufferRows(ctx, rows), s.SchemaFlexible), ld, settled)
+}
+
+func (s *bigquerySender) consumeMetrics(ctx context.Context, md pmetric.Metrics) error {
+	s.inflight.Add(1)
+	defer s.inflight.Done()
+
+	drops := &attributeDrops{}
+	ctx = contextWithAttributeDrops(ctx, drops)
+	if err := s.sendResourceRows(ctx, s.rows.withDrops(drops), metricResources(md)); err != nil {
+		return classifyError(err, s.SchemaFlexible)
+	}
+	rows := s.rows.withDrops(drops).buildMetricRows(md)
+	s.telemetry.recordExportRows(ctx, s.tableID, len(rows))
+	return classifyError(s.sendOrBufferRows(ctx, rows), s.SchemaFlexible)
+}
+
+// Insert each chunk of rows as soon as it's built, so the full batch is never
+// held in memory. If a later chunk fails, the retry will resend the whole
+// batch, including chunks that were already inserted.
+func (s *bigquerySender) streamRows(ctx context.Context, builder *rowBuilder, td ptrace.Traces) error {
+	err := builder.rangeRowChunks(td, s.MaxRowsPerRequest, func(rows []bigqueryrow) error {
+		return s.sendRows(ctx, rows)
+	})
+	return classifyError(err, s.SchemaFlexible)
+}
+
+// Minimum wait before retrying a batch rejected for exceeding a quota. Longer
+// than the usual retry interval, to let the quota recover rather than
+// prolong the overload.
+const quotaExceededBackoff = 2 * time.Minute
+
+// Mark errors that retrying can't fix as permanent, so the retry queue drops
+// the batch rather than resending it until the retry time limit. Quota errors
+// are retried after a longer backoff. Transient errors, e.g. network
+// timeouts, and errors of unknown kinds are retried.
+func classifyError(err error, schemaFlexible bool) error {
+	err = tagErrorKind(err)
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, errQuotaExceeded):
+		return exporterhelper.NewThrottleRetry(err, quotaExceededBackoff)
+	case errors.Is(err, errSchemaMismatch):
+		// Missing fields are only added to a flexible schema. Otherwise, the
+		// rows will be rejected on every attempt.
+		if !schemaFlexible {
+			return consumererror.NewPermanent(err)
+		}
+	case errors.Is(err, errAccessDenied), errors.Is(err, errTableNotFound), errors.Is(err, errInvalidRequest):
+		return consumererror.NewPermanent(err)
 	}
 	return err
 }
 
+// Insert rows into their destination tables, after stamping them with the
+// IngestTimestampColumn and applying the RowTransformer, if any. Attribute
+// values dropped from the rows, including while they were built, are
+// reported once the rows are sent. If routing is configured, rows
+// are grouped by table and each group is inserted in turn, starting with the
+// default table. If one group fails, the remaining groups aren't attempted.
 func (sender *bigquerySender) sendRows(ctx context.Context, rows []bigqueryrow) error {
-	table := sender.bigqueryClient.Dataset(sender.Dataset).Table(sender.Table)
-	err := table.Inserter().Put(ctx, rows)
-	if err != nil && strings.Contains(err.Error(), "no such field") {
-		// When a span attribute key is not represented in the schema, it will
-		// be updated if the exporter is configured to have a flexible schema.
-		// New fields cannot be REQUIRED fields. Existing table rows will have
-		// a NULL value in new field(s).
-		if sender.SchemaFlexible {
-			err := sender.updateSchema(ctx, table, rows)
-			if err != nil {
+	drops := attributeDropsFromContext(ctx)
+	if drops == nil {
+		drops = &attributeDrops{}
+		ctx = contextWithAttributeDrops(ctx, drops)
+	}
+	defer sender.reportAttributeDrops(ctx, drops)
+
+	sender.stampIngestTime(rows)
+	rows = sender.transformRows(ctx, rows)
+	if len(sender.routes) == 0 {
+		err := sender.insertShards(ctx, rows)
+		if sender.isPermanent(err) {
+			sender.writeFallback(ctx, rows)
+		}
+		return err
+	}
+
+	var unrouted []bigqueryrow
+	routed := make(map[string][]bigqueryrow, len(sender.routes))
+	for _, row := range rows {
+		if tableID := sender.routeTable(row); tableID != "" {
+			routed[tableID] = append(routed[tableID], row)
+		} else {
+			unrouted = append(unrouted, row)
+		}
+	}
+
+	err := sender.insertRoutes(ctx, unrouted, routed)
+	if sender.isPermanent(err) {
+		sender.writeFallback(ctx, unrouted)
+		for tableID, rows := range routed {
+			sender.routes[tableID].writeFallback(ctx, rows)
+		}
+	}
+	return err
+}
+
+// Insert unrouted rows into the default table, then routed rows into their
+// tables, in table order. If one table fails, the rest aren't attempted.
+func (sender *bigquerySender) insertRoutes(ctx context.Context, unrouted []bigqueryrow, routed map[string][]bigqueryrow) error {
+	if len(unrouted) > 0 {
+		if err := sender.insertShards(ctx, unrouted); err != nil {
+			return err
+		}
+	}
+	tableIDs := make([]string, 0, len(routed))
+	for tableID := range routed {
+		tableIDs = append(tableIDs, tableID)
+	}
+	sort.Strings(tableIDs)
+	for _, tableID := range tableIDs {
+		if err := sender.routes[tableID].insertShards(ctx, routed[tableID]); err != nil {
+			return fmt.Errorf("table %s: %w", tableID, err)
+		}
+	}
+	return nil
+}
+
+// The retry queue will drop the rows an insert failed with err for, rather
+// than retry them.
+func (sender *bigquerySender) isPermanent(err error) bool {
+	return consumererror.IsPermanent(classifyError(err, sender.SchemaFlexible))
+}
+
+// Set the IngestTimestampColumn of each row to the current time, if it's
+// configured. Rows resent on retry are restamped.
+func (sender *bigquerySender) stampIngestTime(rows []bigqueryrow) {
+	if sender.IngestTimestampColumn == "" {
+		return
+	}
+	now := pcommon.NewTimestampFromTime(time.Now())
+	for _, row := range rows {
+		row[sender.IngestTimestampColumn] = now
+	}
+}
+
+// The routed table for a row, or "" if the row belongs in the default table.
+// The route attribute is looked up by its column, so it must be exported.
+func (sender *bigquerySender) routeTable(row bigqueryrow) string {
+	column := sender.attributeColumn(sender.RouteByAttribute)
+	value, ok := row[column]
+	if !ok {
+		// Resource attributes may have a standard column, and may be
+		// nested; see StandardResourceColumns and NestResource.
+		column = sender.resourceAttributeColumn(sender.RouteByAttribute)
+		if value, ok = row[column]; !ok {
+			resource, _ := row[resourceColumn].(map[string]bigquery.Value)
+			if value, ok = resource[column]; !ok {
+				return ""
+			}
+		}
+	}
+	key, ok := value.(string)
+	if !ok {
+		key = fmt.Sprint(value)
+	}
+	tableID := sender.RouteTableMapping[key]
+	if _, ok := sender.routes[tableID]; !ok {
+		return ""
+	}
+	return tableID
+}
+
+// Insert rows into the table or, if TableSuffixFormat is set, into the date
+// shards of the table their timestamps fall in. BigQuery creates missing
+// shards from the table, which serves as a template. Shards are inserted in
+// date order. If one fails, the remaining shards aren't attempted.
+func (sender *bigquerySender) insertShards(ctx context.Context, rows []bigqueryrow) error {
+	if sender.TableSuffixFormat == "" {
+		return sender.insertChunks(ctx, sender.inserter, rows)
+	}
+
+	shards := make(map[string][]bigqueryrow)
+	for _, row := range rows {
+		suffix := sender.tableSuffix(row)
+		shards[suffix] = append(shards[suffix], row)
+	}
+	suffixes := make([]string, 0, len(shards))
+	for suffix := range shards {
+		suffixes = append(suffixes, suffix)
+	}
+	sort.Strings(suffixes)
+	for _, suffix := range suffixes {
+		inserter := sender.inserter
+		if suffix != "" {
+			inserter = sender.shardInserter(suffix)
+		}
+		if err := sender.insertChunks(ctx, inserter, shards[suffix]); err != nil {
+			return fmt.Errorf("table %s%s: %w", sender.tableID, suffix, err)
+		}
+	}
+	return nil
+}
+
+// The shard suffix for a row: its timestamp formatted with TableSuffixFormat,
+// in UTC. Rows without a timestamp get none, so they're inserted into the
+// table itself.
+func (sender *bigquerySender) tableSuffix(row bigqueryrow) string {
+	ts, ok := row[sender.partitionField()].(pcommon.Timestamp)
+	if !ok {
+		return ""
+	}
+	return ts.AsTime().UTC().Format(sender.TableSuffixFormat)
+}
+
+// Insert rows in sub-batches that fit BigQuery's per-request limits. Each
+// sub-batch is inserted (and, after a schema update, retried) on its own.
+// If one fails, or ctx is cancelled, the remaining sub-batches aren't
+// attempted. With MaxConcurrentInserts above 1, up to that many sub-batches
+// are inserted at once, and all are attempted even if one fails.
+func (sender *bigquerySender) insertChunks(ctx context.Context, inserter rowInserter, rows []bigqueryrow) error {
+	chunks := splitRows(rows, sender.MaxRowsPerRequest, maxInsertRequestBytes)
+	if len(chunks) > 1 {
+		sender.logger.Debug("Splitting batch into sub-batches",
+			zap.String("table", sender.tableID),
+			zap.Int("rows", len(rows)),
+			zap.Int("estimated_bytes", estimateBatchBytes(rows)),
+			zap.Int("sub_batches", len(chunks)))
+	}
+	if sender.MaxConcurrentInserts > 1 && len(chunks) > 1 {
+		return sender.insertChunksConcurrently(ctx, inserter, chunks)
+	}
+
+	for _, chunk := range chunks {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := sender.insertChunk(ctx, inserter, chunk); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Insert sub-batches on a bounded pool of goroutines, returning the errors of
+// all that failed. The rate limiter is shared, so it still bounds the overall
+// request rate.
+func (sender *bigquerySender) insertChunksConcurrently(ctx context.Context, inserter rowInserter, chunks [][]bigqueryrow) error {
+	errs := make([]error, len(chunks))
+	var g errgroup.Group
+	g.SetLimit(sender.MaxConcurrentInserts)
+	for i, chunk := range chunks {
+		g.Go(func() error {
+			if err := ctx.Err(); err != nil {
+				errs[i] = err
+				return nil
+			}
+			errs[i] = sender.insertChunk(ctx, inserter, chunk)
+			return nil
+		})
+	}
+	_ = g.Wait()
+	return errors.Join(errs...)
+}
+
+func (sender *bigquerySender) insertChunk(ctx context.Context, inserter rowInserter, chunk []bigqueryrow) error {
+	if err := sender.insertRows(ctx, inserter, chunk); err != nil {
+		sender.telemetry.recordRowsFailed(ctx, sender.tableID, len(chunk))
+		return err
+	}
+	sender.telemetry.recordRowsSent(ctx, sender.tableID, len(chunk))
+	settledRowsFromContext(ctx).add(chunk, sender.partitionField())
+	return nil
+}
+
+func (sender *bigquerySender) insertRows(ctx context.Context, inserter rowInserter, rows []bigqueryrow) error {
+	if err := sender.createPendingTable(ctx, rows); err != nil {
+		return err
+	}
+	rows = sender.resolveTypeConflicts(ctx, rows)
+	if len(rows) == 0 {
+		return nil
+	}
+
+	// Rows are resent with the same insertIDs (see Deduplicate), so BigQuery
+	// can drop any copies a retry inserts.
+	err := sender.put(ctx, inserter, rows)
+	for retries := 0; err != nil; retries++ {
+		// When BigQuery reports which rows failed, only those are retried.
+		// Rows that can never be inserted are dropped, so they don't fail
+		// every retry of the batch.
+		mismatch := isSchemaMismatch(err)
+		var rowErrs bigquery.PutMultiError
+		if errors.As(err, &rowErrs) {
+			rows, mismatch = sender.failedRows(ctx, rows, rowErrs)
+			if len(rows) == 0 {
+				return nil
+			}
+		}
+
+		if mismatch {
+			// When a span attribute key is not represented in the schema, it will
+			// be updated if the exporter is configured to have a flexible schema.
+			// New fields cannot be REQUIRED fields. Existing table rows will have
+			// a NULL value in new field(s).
+			if !sender.SchemaFlexible {
+				// Permanent; see classifyError.
+				sender.warnUnmappedColumns(rows)
 				return err
 			}
 
-			// Avoid failed inserts with an enforced delay after schema updates.
-			// Typically, it's best practice to have a fixed schema, so this won't
-			// come up in those cases. This delay accommodates the (nominally
-			// exceptional) case where schema alterations occur on-the-fly.
-			const wait = 60 * time.Second
-			fmt.Printf("Waiting %v to allow schema updates to register fully", wait)
-			time.Sleep(wait)
+			// Values without a BigQuery type can't be added to the schema.
+			var unmappable []bigqueryrow
+			var reasons []error
+			rows, unmappable, reasons = splitUnmappableRows(rows)
+			drops := attributeDropsFromContext(ctx)
+			for _, row := range unmappable {
+				drops.add(dropReasonUnsupportedType, unmappableValues(row))
+			}
+			if len(unmappable) > 0 {
+				sender.logger.Warn("Dropping rows with values that have no BigQuery type",
+					zap.String("table", sender.tableID),
+					zap.Int("rows", len(unmappable)),
+					zap.Error(reasons[0]))
+				sender.deadLetter(ctx, unmappable, reasons)
+			}
+			if len(rows) == 0 {
+				return nil
+			}
+			if retries > 0 {
+				// The fields were missing again after an update, so the
+				// cached schema may be stale, e.g. if another writer replaced
+				// it. Merge the rows into the table's current schema instead.
+				sender.schema.mu.Lock()
+				sender.schema.invalidate()
+				sender.schema.mu.Unlock()
+			}
+			if err := sender.updateSchema(ctx, rows); err != nil {
+				return err
+			}
+			if sender.MaxColumns > 0 {
+				var over []bigqueryrow
+				rows, over, reasons = sender.splitRowsOverColumnLimit(rows)
+				sender.deadLetter(ctx, over, reasons)
+				if len(rows) == 0 {
+					return nil
+				}
+			}
+
+			// New fields take a while to register with BigQuery, so an
+			// immediate retry will likely fail. Typically, it's best practice to
+			// have a fixed schema, so this won't come up in those cases. By
+			// default, return the error and leave it to the retry queue (see
+			// TunedRetrySettings) to retry the rows that didn't settle (see
+			// settled_rows.go) once the update registers. This doesn't block
+			// the export goroutine.
+			if sender.SchemaUpdateSettleDelay == 0 {
+				return err
+			}
+			if retries == sender.MaxSchemaUpdateRetries {
+				sender.logger.Warn("Rows still have fields missing from the table schema after retrying",
+					zap.String("table", sender.tableID),
+					zap.Int("rows", len(rows)),
+					zap.Int("retries", retries))
+				return err
+			}
 
-			// table.Inserter().Put() does not skipInvalidRows. If any row fails,
-			// the entire batch will fail. In that case, retry the full batch.
-			fmt.Println("Retrying insert")
-			return table.Inserter().Put(ctx, rows)
+			sender.logger.Debug("Waiting to allow schema updates to register fully",
+				zap.String("table", sender.tableID),
+				zap.Duration("delay", sender.SchemaUpdateSettleDelay))
+			if err := sleepCtx(ctx, sender.SchemaUpdateSettleDelay); err != nil {
+				return err
+			}
+		} else if rowErrs == nil || retries > 0 {
+			return err
+		}
+
+		// Unless SkipInvalidRows is set, if any row fails, the remaining
+		// rows aren't inserted either. Retry the failed rows once,
+		// or after each schema update, unless the export was cancelled (e.g.
+		// on collector shutdown) meanwhile.
+		if err := ctx.Err(); err != nil {
+			return err
 		}
+		sender.logger.Debug("Retrying insert",
+			zap.String("table", sender.tableID),
+			zap.Int("rows", len(rows)),
+			zap.Int("retries", retries))
+		err = sender.put(ctx, inserter, rows)
+	}
+	return nil
+}
+
+// Rows from a failed insert that may succeed on retry, and whether any failed
+// for fields missing from the table schema. Rows rejected for any other
+// reason are logged and dead-lettered. BigQuery reports the rows it didn't
+// insert because of them as stopped; those are retried. Rows without errors
+// were inserted, e.g. with SkipInvalidRows, so they're settled.
+func (sender *bigquerySender) failedRows(ctx context.Context, rows []bigqueryrow, rowErrs bigquery.PutMultiError) ([]bigqueryrow, bool) {
+	var retry, dropped []bigqueryrow
+	var droppedIndices []int
+	var reasons []error
+	mismatch := false
+	logged := 0
+	failed := make([]bool, len(rows))
+
+	for i := range rowErrs {
+		rowErr := &rowErrs[i]
+		if rowErr.RowIndex < 0 || rowErr.RowIndex >= len(rows) {
+			continue
+		}
+		failed[rowErr.RowIndex] = true
+		row := rows[rowErr.RowIndex]
+		switch {
+		case isRowSchemaMismatch(rowErr):
+			mismatch = true
+			retry = append(retry, row)
+		case isStopped(rowErr):
+			retry = append(retry, row)
+			// Not at fault, so not logged.
+			continue
+		default:
+			dropped = append(dropped, row)
+			droppedIndices = append(droppedIndices, rowErr.RowIndex)
+			reasons = append(reasons, rowErr.Errors)
+		}
+
+		if logged < maxLoggedRowErrors {
+			sender.logger.Warn("Row rejected by BigQuery",
+				zap.String("table", sender.tableID),
+				zap.Int("row_index", rowErr.RowIndex),
+				zap.String("trace_id", stringValue(row["trace_id"])),
+				zap.String("span_id", stringValue(row["span_id"])),
+				zap.Error(rowErr.Errors))
+		}
+		logged++
+	}
+	if logged > maxLoggedRowErrors {
+		sender.logger.Warn("More rows rejected by BigQuery than logged",
+			zap.String("table", sender.tableID),
+			zap.Int("rows", logged-maxLoggedRowErrors))
+	}
+
+	if len(dropped) > 0 {
+		sender.logger.Warn("Dropping rows rejected by BigQuery",
+			zap.String("table", sender.tableID),
+			zap.Ints("row_indices", droppedIndices),
+			zap.Error(reasons[0]))
+		sender.deadLetter(ctx, dropped, reasons)
+	}
+
+	var inserted []bigqueryrow
+	for i, row := range rows {
+		if !failed[i] {
+			inserted = append(inserted, row)
+		}
+	}
+	settledRowsFromContext(ctx).add(inserted, sender.partitionField())
+	return retry, mismatch
+}
+
+// Rejected rows are logged individually, with their trace and span IDs so
+// the affected traces can be found, up to this many per request.
+const maxLoggedRowErrors = 20
+
+// The value as a string, or "" if it isn't one, e.g. for a missing column.
+func stringValue(value bigquery.Value) string {
+	s, _ := value.(string)
+	return s
+}
+
+// The row was valid, but wasn't inserted because other rows in the request
+// were invalid.
+func isStopped(rowErr *bigquery.RowInsertionError) bool {
+	for _, err := range rowErr.Errors {
+		var bqErr *bigquery.Error
+		if !errors.As(err, &bqErr) || bqErr.Reason != "stopped" {
+			return false
+		}
+	}
+	return len(rowErr.Errors) > 0
+}
+
+// Insert rows with inserter, first waiting for the rate limiter if one is
+// configured. Errors are tagged with their kind; see tagErrorKind.
+func (sender *bigquerySender) put(ctx context.Context, inserter rowInserter, rows []bigqueryrow) error {
+	if sender.limiter != nil {
+		if err := sender.limiter.Wait(ctx); err != nil {
+			return err
+		}
+	}
+	sender.telemetry.recordBatchSize(ctx, sender.tableID, len(rows))
+	sender.telemetry.recordRequestBytes(ctx, sender.tableID, estimateBatchBytes(rows))
+	return tagErrorKind(inserter.Put(ctx, sender.valueSavers(rows)))
+}
+
+// Prepare rows for the inserter, with insertIDs if deduplication is enabled.
+func (sender *bigquerySender) valueSavers(rows []bigqueryrow) []bigquery.ValueSaver {
+	savers := make([]bigquery.ValueSaver, len(rows))
+	for i, row := range rows {
+		if sender.Deduplicate {
+			savers[i] = dedupedRow{row: row, insertID: row.insertID(sender.partitionField())}
+		} else {
+			savers[i] = row
+		}
+	}
+	return savers
+}
+
+// Wait for d to elapse, returning early if ctx is cancelled first (e.g. on
+// collector shutdown).
+func sleepCtx(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
 	}
-	return err
 }
 
 // Attempt to update the target table schema when new fields are identified.
 // If no BigQuery type maps to the span value type, block the export.
-func (s *bigquerySender) updateSchema(ctx context.Context, table *bigquery.Table, rows []bigqueryrow) error {
+func (s *bigquerySender) updateSchema(ctx context.Context, rows []bigqueryrow) error {
 	// If data contains field(s) not present in the target table schema, update the schema using the first
 	// matching type for each. If the update is unsuccessful for any fields in a trace, the table will reject
 	// the entire trace aka data row.
-	meta, err := table.Metadata(ctx)
-	if err != nil {
+
+	// Holding the lock for the update keeps concurrent consumers from racing
+	// each other's schema changes.
+	s.schema.mu.Lock()
+	defer s.schema.mu.Unlock()
+
+	var err error
+	for attempt := 1; attempt <= maxSchemaUpdateAttempts; attempt++ {
+		err = s.tryUpdateSchema(ctx, rows)
+		if !isETagConflict(err) {
+			return err
+		}
+		// Another writer changed the schema. Refetch it and merge the new
+		// fields into that version on the next attempt.
+		s.schema.invalidate()
+	}
+	return err
+}
+
+// A single fetch-merge-update pass of updateSchema. The caller holds the
+// schema lock.
+func (s *bigquerySender) tryUpdateSchema(ctx context.Context, rows []bigqueryrow) error {
+	if err := s.schema.load(ctx, s.schemaManager); err != nil {
 		return fmt.Errorf("table metadata: %w", err)
 	}
 
-	knownFields := make(map[string]bool, len(meta.Schema))
-	knownFieldsTypes := make(map[string]string, len(meta.Schema))
+	schema, newFields, err := mergeSchema(s.logger, s.schema.fields, rows)
+	if err != nil {
+		return err
+	}
+	if s.MaxColumns > 0 && len(schema) > s.MaxColumns {
+		// New fields are merged after the existing ones, so the first new
+		// fields seen are kept.
+		keep := max(s.MaxColumns, len(s.schema.fields))
+		refused := make([]string, 0, len(schema)-keep)
+		for _, field := range schema[keep:] {
+			refused = append(refused, field.Name)
+		}
+		s.logger.Error("Table is at maxColumns, so new fields aren't added, and rows with them are dead-lettered",
+			zap.String("table", s.tableID),
+			zap.Int("max_columns", s.MaxColumns),
+			zap.Strings("fields", refused))
+		schema = schema[:keep]
+		newFields -= len(refused)
+	}
 
-	for _, field := range meta.Schema {
+	if newFields == 0 {
+		// This case may arise when there are no new fields relative to a previously processed row (span),
+		// but at least some of the (recently) updated schema fields have not yet registered with BigQuery.
+		// No action required.
+		return nil
+	}
+
+	s.logger.Info("Updating table schema",
+		zap.String("table", s.tableID),
+		zap.Int("new_fields", newFields))
+	metaUpdate := bigquery.TableMetadataToUpdate{
+		Schema: schema,
+	}
+	meta, err := s.schemaManager.Update(ctx, metaUpdate, s.schema.etag)
+	if err != nil {
+		return fmt.Errorf("unable to update schema: %w", err)
+	}
+	s.schema.set(meta)
+	s.telemetry.recordSchemaUpdate(ctx, s.tableID)
+	return nil
+}
+
+// The field type for a row value, for key's column. OTel attribute value
+// types are limited to these cases. Conveniently, they each map to a BigQuery
+// type. Timestamps, e.g. of the partition field (ts by default), are typed by
+// value rather than by key, so any column they're written to is a TIMESTAMP.
+// Slices are typed by their elements, for a REPEATED column; see
+// isRepeatedValue. Nested rows, i.e. the NestResource column, are RECORDs.
+func inferFieldType(key string, value interface{}) (bigquery.FieldType, error) {
+	switch value.(type) {
+	case nil:
+		// Empty attribute values carry no type.
+		return bigquery.StringFieldType, nil
+	case pcommon.Timestamp:
+		return bigquery.TimestampFieldType, nil
+	case bool:
+		return bigquery.BooleanFieldType, nil
+	case []byte:
+		return bigquery.BytesFieldType, nil
+	case float64:
+		return bigquery.FloatFieldType, nil
+	case int64:
+		return bigquery.IntegerFieldType, nil
+	case string, []string:
+		return bigquery.StringFieldType, nil
+	case []int64:
+		return bigquery.IntegerFieldType, nil
+	case []float64:
+		return bigquery.FloatFieldType, nil
+	case []bool:
+		return bigquery.BooleanFieldType, nil
+	case map[string]bigquery.Value:
+		return bigquery.RecordFieldType, nil
+	}
+	return "", fmt.Errorf("no BigQuery type for %T value of %s", value, key)
+}
+
+// Extend the schema with a field for each row key not already present,
+// returning the extended schema and the number of fields added. The schemas
+// of RECORD fields are extended in turn with the keys of their nested rows.
+func mergeSchema(logger *zap.Logger, schema bigquery.Schema, rows []bigqueryrow) (bigquery.Schema, int, error) {
+	knownFields := make(map[string]bool, len(schema))
+	knownFieldsTypes := make(map[string]string, len(schema))
+
+	for _, field := range schema {
 		knownFields[field.Name] = true
 		switch field.Type {
 		case bigquery.BigNumericFieldType:
+			// Double fields were previously created as BIGNUMERIC. Existing
+			// tables may still have them.
 			knownFieldsTypes[field.Name] = "float64"
 		case bigquery.BooleanFieldType:
 			knownFieldsTypes[field.Name] = "bool"
 		case bigquery.BytesFieldType:
-			knownFieldsTypes[field.Name] = "byte"
+			knownFieldsTypes[field.Name] = "[]uint8"
+		case bigquery.FloatFieldType:
+			knownFieldsTypes[field.Name] = "float64"
+		case bigquery.IntegerFieldType:
+			knownFieldsTypes[field.Name] = "int64"
 		case bigquery.NumericFieldType:
+			// Int fields were previously created as NUMERIC. Existing tables
+			// may still have them.
 			knownFieldsTypes[field.Name] = "int64"
 		case bigquery.StringFieldType:
 			knownFieldsTypes[field.Name] = "string"
 		case bigquery.TimestampFieldType:
-			knownFieldsTypes[field.Name] = "int64"
+			// As set by the row builders; see inferFieldType.
+			knownFieldsTypes[field.Name] = "pcommon.Timestamp"
+		case bigquery.RecordFieldType:
+			knownFieldsTypes[field.Name] = "map[string]bigquery.Value"
 		default:
-			return fmt.Errorf("BigQuery field type %v incompatible with span attribute value types", field.Type)
+			return nil, 0, fmt.Errorf("BigQuery field type %v incompatible with span attribute value types", field.Type)
+		}
+		if field.Repeated {
+			knownFieldsTypes[field.Name] = "[]" + knownFieldsTypes[field.Name]
 		}
 	}
-	newFields := make(map[string]bool)
-	metaUpdate := bigquery.TableMetadataToUpdate{
-		Schema: meta.Schema,
-	}
+	newFields := 0
+	merged := append(bigquery.Schema{}, schema...)
+	records := map[string][]bigqueryrow{}
 
 	for _, row := range rows {
 		for key, value := range row {
-			valueType := reflect.TypeOf(value).String()
+			if record, ok := value.(map[string]bigquery.Value); ok {
+				records[key] = append(records[key], record)
+			}
+			// NULLs fit any field type.
+			if value == nil && knownFields[key] {
+				continue
+			}
+			valueType := "string"
+			if value != nil {
+				valueType = reflect.TypeOf(value).String()
+			}
 
 			if knownFields[key] {
-				// TODO Improve handling of fields with duplicate names but
-				// different value types.
+				// Conflicting types are resolved before insert, as
+				// configured by TypeConflictStrategy. Any left over, e.g.
+				// before the schema was cached, fail the row.
 				if knownFieldsTypes[key] != valueType {
-					fmt.Printf("Schema field %v doesn't map to span value type %v. Export may fail.\n", key, reflect.TypeOf(value))
+					logger.Warn("Schema field type doesn't match the row value type. Export may fail",
+						zap.String("field", key),
+						zap.String("field_type", knownFieldsTypes[key]),
+						zap.String("value_type", valueType))
 				}
 			}
 
 			if !knownFields[key] {
 				// OTel span attribute value types are limited to these cases.
 				// Conveniently, they each map to a BigQuery type.
-				var fieldType bigquery.FieldType
-				if key == "ts" {
-					fieldType = bigquery.TimestampFieldType
-				} else {
-					switch value.(type) {
-					case bool:
-						fieldType = bigquery.BooleanFieldType
-					case byte:
-						fieldType = bigquery.BytesFieldType
-					case float64:
-						fieldType = bigquery.BigNumericFieldType
-					case int64:
-						fieldType = bigquery.NumericFieldType
-					case string:
-						fieldType = bigquery.StringFieldType
-
-					default:
-						fmt.Printf("Schema update attempted: %v has unsupported type: %v.\n", key, reflect.TypeOf(value))
-					}
+				fieldType, err := inferFieldType(key, value)
+				if err != nil {
+					return nil, 0, err
 				}
-				fmt.Printf("Updating schema with field '%v' of type %v\n", key, fieldType)
-				metaUpdate.Schema = append(metaUpdate.Schema, &bigquery.FieldSchema{
-					Name: key,
-					Type: fieldType,
+				logger.Debug("Adding schema field",
+					zap.String("field", key),
+					zap.String("type", string(fieldType)))
+				merged = append(merged, &bigquery.FieldSchema{
+					Name:     key,
+					Type:     fieldType,
+					Repeated: isRepeatedValue(value),
 				})
 				knownFields[key] = true
 				knownFieldsTypes[key] = valueType
-				newFields[key] = true
+				newFields++
 			}
 		}
 	}
 
-	if len(newFields) == 0 {
-		// This case may arise when there are no new fields relative to a previously processed row (span),
-		// but at least some of the (recently) updated schema fields have not yet registered with BigQuery.
-		// No action required.
-	} else {
-		fmt.Printf("Updating schema with %d new fields\n", len(newFields))
-		_, err = table.Update(ctx, metaUpdate, meta.ETag)
+	for i, field := range merged {
+		if field.Type != bigquery.RecordFieldType || len(records[field.Name]) == 0 {
+			continue
+		}
+		fieldSchema, n, err := mergeSchema(logger, field.Schema, records[field.Name])
 		if err != nil {
-			return fmt.Errorf("unable to update schema: %w", err)
+			return nil, 0, fmt.Errorf("%s: %w", field.Name, err)
+		}
+		if n > 0 {
+			// A copy, so the cached schema isn't modified.
+			extended := *field
+			extended.Schema = fieldSchema
+			merged[i] = &extended
+			newFields += n
 		}
 	}
 
-	return nil
+	return merged, newFields, nil
 }
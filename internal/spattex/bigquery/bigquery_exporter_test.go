@@ -0,0 +1,1709 @@
+package bigquery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"cloud.google.com/go/bigquery/storage/managedwriter"
+	"cloud.google.com/go/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/component/componenttest"
+	"go.opentelemetry.io/collector/consumer/consumererror"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/plog"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+	"golang.org/x/oauth2"
+	"golang.org/x/time/rate"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/impersonate"
+	"google.golang.org/api/option"
+)
+
+func TestMergeSchemaIntField(t *testing.T) {
+	schema := bigquery.Schema{
+		{Name: "name", Type: bigquery.StringFieldType},
+	}
+	rows := []bigqueryrow{{"name": "span1", "int_key": int64(41)}}
+
+	merged, newFields, err := mergeSchema(zap.NewNop(), schema, rows)
+	require.NoError(t, err)
+
+	assert.Equal(t, 1, newFields, "Only the int field should be new")
+	assert.Equal(t, bigquery.IntegerFieldType, fieldType(merged, "int_key"), "New int fields should be INTEGER")
+}
+
+func TestMergeSchemaKnownTimestampField(t *testing.T) {
+	schema := bigquery.Schema{
+		{Name: "ts", Type: bigquery.TimestampFieldType},
+	}
+	rows := []bigqueryrow{{"ts": pcommon.Timestamp(1_706_702_400_000_000_000)}}
+	core, logs := observer.New(zap.WarnLevel)
+
+	_, newFields, err := mergeSchema(zap.New(core), schema, rows)
+	require.NoError(t, err)
+
+	assert.Equal(t, 0, newFields)
+	assert.Zero(t, logs.Len(), "Timestamp values should match TIMESTAMP fields")
+}
+
+func TestMergeSchemaKnownNumericField(t *testing.T) {
+	// Tables created before int fields mapped to INTEGER have NUMERIC columns.
+	schema := bigquery.Schema{
+		{Name: "int_key", Type: bigquery.NumericFieldType},
+	}
+	rows := []bigqueryrow{{"int_key": int64(41)}}
+
+	merged, newFields, err := mergeSchema(zap.NewNop(), schema, rows)
+	require.NoError(t, err)
+
+	assert.Equal(t, 0, newFields, "Existing NUMERIC fields should be reused")
+	assert.Equal(t, bigquery.NumericFieldType, fieldType(merged, "int_key"))
+}
+
+func TestMergeSchemaBytesField(t *testing.T) {
+	schema := bigquery.Schema{
+		{Name: "bytes_key", Type: bigquery.BytesFieldType},
+	}
+	rows := []bigqueryrow{{"bytes_key": []byte("known"), "new_bytes_key": []byte("new")}}
+
+	merged, newFields, err := mergeSchema(zap.NewNop(), schema, rows)
+	require.NoError(t, err)
+
+	assert.Equal(t, 1, newFields, "Only the new bytes field should be added")
+	assert.Equal(t, bigquery.BytesFieldType, fieldType(merged, "new_bytes_key"), "New bytes fields should be BYTES")
+}
+
+func TestMergeSchemaNullField(t *testing.T) {
+	schema := bigquery.Schema{
+		{Name: "int_key", Type: bigquery.IntegerFieldType},
+	}
+	rows := []bigqueryrow{{"int_key": nil, "empty_key": nil}}
+
+	merged, newFields, err := mergeSchema(zap.NewNop(), schema, rows)
+	require.NoError(t, err)
+
+	assert.Equal(t, 1, newFields, "NULLs should fit existing fields")
+	assert.Equal(t, bigquery.StringFieldType, fieldType(merged, "empty_key"), "New fields with only NULLs should be STRING")
+}
+
+func TestMergeSchemaDoubleField(t *testing.T) {
+	schema := bigquery.Schema{
+		{Name: "name", Type: bigquery.StringFieldType},
+	}
+	rows := []bigqueryrow{{"name": "span1", "double_key": 3.14}}
+
+	merged, newFields, err := mergeSchema(zap.NewNop(), schema, rows)
+	require.NoError(t, err)
+
+	assert.Equal(t, 1, newFields, "Only the double field should be new")
+	assert.Equal(t, bigquery.FloatFieldType, fieldType(merged, "double_key"), "New double fields should be FLOAT")
+}
+
+func TestMergeSchemaKnownBigNumericField(t *testing.T) {
+	// Tables created before double fields mapped to FLOAT have BIGNUMERIC columns.
+	schema := bigquery.Schema{
+		{Name: "double_key", Type: bigquery.BigNumericFieldType},
+	}
+	rows := []bigqueryrow{{"double_key": 3.14}}
+
+	merged, newFields, err := mergeSchema(zap.NewNop(), schema, rows)
+	require.NoError(t, err)
+
+	assert.Equal(t, 0, newFields, "Existing BIGNUMERIC fields should be reused")
+	assert.Equal(t, bigquery.BigNumericFieldType, fieldType(merged, "double_key"))
+}
+
+func TestMergeSchemaRepeatedField(t *testing.T) {
+	schema := bigquery.Schema{
+		{Name: "tags", Type: bigquery.StringFieldType, Repeated: true},
+	}
+	rows := []bigqueryrow{{"tags": []string{"a", "b"}, "codes": []int64{1, 2}, "json_key": `["a",1]`}}
+
+	merged, newFields, err := mergeSchema(zap.NewNop(), schema, rows)
+	require.NoError(t, err)
+
+	assert.Equal(t, 2, newFields, "Existing REPEATED fields should be reused")
+	repeated := map[string]bool{}
+	for _, field := range merged {
+		repeated[field.Name] = field.Repeated
+	}
+	assert.Equal(t, bigquery.IntegerFieldType, fieldType(merged, "codes"))
+	assert.True(t, repeated["codes"], "Slice values should get a REPEATED field")
+	assert.Equal(t, bigquery.StringFieldType, fieldType(merged, "json_key"))
+	assert.False(t, repeated["json_key"], "JSON array strings should get a scalar field")
+}
+
+func TestMergeSchemaRecordField(t *testing.T) {
+	rows := []bigqueryrow{
+		{"name": "span1", "resource": map[string]bigquery.Value{"service_name": "checkout"}},
+		{"name": "span2", "resource": map[string]bigquery.Value{"service_name": "cart", "host_cpus": int64(4)}},
+	}
+
+	merged, newFields, err := mergeSchema(zap.NewNop(), bigquery.Schema{{Name: "name", Type: bigquery.StringFieldType}}, rows)
+	require.NoError(t, err)
+
+	assert.Equal(t, 3, newFields, "The record and both of its fields should be new")
+	require.Equal(t, bigquery.RecordFieldType, fieldType(merged, "resource"))
+	resource := merged[1].Schema
+	assert.Equal(t, bigquery.StringFieldType, fieldType(resource, "service_name"))
+	assert.Equal(t, bigquery.IntegerFieldType, fieldType(resource, "host_cpus"))
+}
+
+func TestMergeSchemaKnownRecordField(t *testing.T) {
+	schema := bigquery.Schema{
+		{Name: "resource", Type: bigquery.RecordFieldType, Schema: bigquery.Schema{
+			{Name: "service_name", Type: bigquery.StringFieldType},
+		}},
+	}
+	rows := []bigqueryrow{{"resource": map[string]bigquery.Value{"service_name": "checkout", "host_cpus": int64(4)}}}
+
+	merged, newFields, err := mergeSchema(zap.NewNop(), schema, rows)
+	require.NoError(t, err)
+
+	assert.Equal(t, 1, newFields, "Only the nested field should be new")
+	assert.Equal(t, bigquery.IntegerFieldType, fieldType(merged[0].Schema, "host_cpus"))
+	assert.Len(t, schema[0].Schema, 1, "The original schema should be unchanged")
+}
+
+func TestMergeSchemaUnsupportedField(t *testing.T) {
+	rows := []bigqueryrow{{"map_key": pcommon.NewMap()}}
+
+	_, _, err := mergeSchema(zap.NewNop(), bigquery.Schema{}, rows)
+
+	require.Error(t, err, "Values without a BigQuery type should fail the schema update")
+	assert.Contains(t, err.Error(), "map_key")
+}
+
+func TestInferFieldType(t *testing.T) {
+	tests := []struct {
+		name     string
+		key      string
+		value    interface{}
+		expected bigquery.FieldType
+	}{
+		{name: "bool", key: "flag", value: true, expected: bigquery.BooleanFieldType},
+		{name: "bytes", key: "payload", value: []byte{1, 2}, expected: bigquery.BytesFieldType},
+		{name: "float64", key: "ratio", value: 0.5, expected: bigquery.FloatFieldType},
+		{name: "int64", key: "count", value: int64(3), expected: bigquery.IntegerFieldType},
+		{name: "string", key: "http.method", value: "GET", expected: bigquery.StringFieldType},
+		{name: "nil", key: "empty", value: nil, expected: bigquery.StringFieldType},
+		{name: "ts", key: "ts", value: pcommon.Timestamp(1_700_000_000_000_000_000), expected: bigquery.TimestampFieldType},
+		{name: "custom partition field", key: "start_time", value: pcommon.Timestamp(1), expected: bigquery.TimestampFieldType},
+		{name: "string slice", key: "tags", value: []string{"a"}, expected: bigquery.StringFieldType},
+		{name: "float64 slice", key: "ratios", value: []float64{0.5}, expected: bigquery.FloatFieldType},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fieldType, err := inferFieldType(tt.key, tt.value)
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, fieldType)
+		})
+	}
+}
+
+func TestInferFieldTypeUnsupported(t *testing.T) {
+	for _, value := range []interface{}{pcommon.NewMap(), int32(1), struct{}{}} {
+		fieldType, err := inferFieldType("key", value)
+
+		require.Error(t, err, "%T values should have no field type", value)
+		assert.Contains(t, err.Error(), "key")
+		assert.Empty(t, fieldType)
+	}
+}
+
+func TestClientOptionsCredentials(t *testing.T) {
+	tests := []struct {
+		name     string
+		file     string
+		json     string
+		expected []option.ClientOption
+	}{
+		{name: "default credentials"},
+		{name: "credentials file", file: "/etc/otelex/key.json", expected: []option.ClientOption{option.WithCredentialsFile("/etc/otelex/key.json")}},
+		{name: "credentials JSON", json: `{"type":"service_account"}`, expected: []option.ClientOption{option.WithCredentialsJSON([]byte(`{"type":"service_account"}`))}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := createTestConfig()
+			cfg.CredentialsFile = tt.file
+			cfg.CredentialsJSON = tt.json
+
+			t.Setenv(emulatorHostEnv, "")
+
+			var got []option.ClientOption
+			stubClientFactory(t, func(ctx context.Context, projectID string, opts ...option.ClientOption) (*bigquery.Client, error) {
+				got = opts
+				return &bigquery.Client{}, nil
+			})
+
+			_, err := newBigQuerySender(cfg, cfg.Table, componenttest.NewNopTelemetrySettings())
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.expected, got)
+		})
+	}
+}
+
+func TestClientOptionsEndpoint(t *testing.T) {
+	t.Setenv(emulatorHostEnv, "localhost:9050")
+	cfg := createTestConfig()
+
+	assert.Equal(t, []option.ClientOption{option.WithEndpoint("http://localhost:9050"), option.WithoutAuthentication()}, clientOptions(cfg),
+		"Emulator host should be used when no endpoint is configured")
+
+	cfg.Endpoint = "https://bigquery.example.com/bigquery/v2/"
+	assert.Equal(t, []option.ClientOption{option.WithEndpoint("https://bigquery.example.com/bigquery/v2/")}, clientOptions(cfg),
+		"Configured endpoint should take precedence over the emulator host")
+}
+
+func TestStartAgainstEmulatorHost(t *testing.T) {
+	var paths []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"etag": "etag0", "schema": {"fields": [{"name": "name", "type": "STRING"}]}}`)
+	}))
+	defer server.Close()
+	t.Setenv(emulatorHostEnv, strings.TrimPrefix(server.URL, "http://"))
+
+	cfg := createTestConfig()
+	sender, err := newBigQuerySender(cfg, cfg.Table, componenttest.NewNopTelemetrySettings())
+	require.NoError(t, err)
+
+	require.NoError(t, sender.start(context.Background(), nil))
+
+	require.Len(t, paths, 1, "Start should fetch table metadata from the emulator")
+	assert.Contains(t, paths[0], "/projects/msyvr/datasets/otelex/tables/spattex_test")
+	assert.Equal(t, bigquery.StringFieldType, sender.schema.types["name"])
+}
+
+func TestProjectIDFromEnvironment(t *testing.T) {
+	t.Setenv(projectEnv, "env-project")
+	stubMetadataProjectID(t, "metadata-project", nil)
+	cfg := createTestConfig()
+	cfg.ProjectID = ""
+
+	var got string
+	stubClientFactory(t, func(ctx context.Context, projectID string, opts ...option.ClientOption) (*bigquery.Client, error) {
+		got = projectID
+		return &bigquery.Client{}, nil
+	})
+
+	_, err := newBigQuerySender(cfg, cfg.Table, componenttest.NewNopTelemetrySettings())
+	require.NoError(t, err)
+
+	assert.Equal(t, "env-project", got, "The environment should take precedence over the metadata server")
+}
+
+func TestResolveProjectID(t *testing.T) {
+	cfg := createTestConfig()
+	t.Setenv(projectEnv, "env-project")
+	projectID, err := resolveProjectID(context.Background(), cfg)
+	require.NoError(t, err)
+	assert.Equal(t, testProjectID, projectID, "A configured project should be used as is")
+
+	cfg.ProjectID = ""
+	t.Setenv(projectEnv, "")
+	stubMetadataProjectID(t, "metadata-project", nil)
+	projectID, err = resolveProjectID(context.Background(), cfg)
+	require.NoError(t, err)
+	assert.Equal(t, "metadata-project", projectID)
+}
+
+func TestDatasetInOtherProject(t *testing.T) {
+	stubClientFactory(t, func(ctx context.Context, projectID string, opts ...option.ClientOption) (*bigquery.Client, error) {
+		return bigquery.NewClient(ctx, projectID, option.WithoutAuthentication())
+	})
+	cfg := createTestConfig()
+
+	sender, err := newBigQuerySender(cfg, cfg.Table, componenttest.NewNopTelemetrySettings())
+	require.NoError(t, err)
+	assert.Equal(t, testProjectID, sender.schemaManager.(*bigquery.Table).ProjectID, "Dataset should default to the client project")
+
+	cfg.DatasetProjectID = "data-lake"
+	sender, err = newBigQuerySender(cfg, cfg.Table, componenttest.NewNopTelemetrySettings())
+	require.NoError(t, err)
+
+	table := sender.schemaManager.(*bigquery.Table)
+	assert.Equal(t, "data-lake", table.ProjectID, "Table should be in the dataset project")
+	assert.Equal(t, testDataset, table.DatasetID)
+	assert.Equal(t, testProjectID, sender.bigqueryClient.Project(), "Client should stay in the configured project")
+}
+
+func TestNoProjectID(t *testing.T) {
+	t.Setenv(projectEnv, "")
+	stubMetadataProjectID(t, "", errors.New("not running on GCE"))
+	cfg := createTestConfig()
+	cfg.ProjectID = ""
+	require.NoError(t, cfg.Validate(), "An empty project should be resolved at startup")
+
+	_, err := newBigQuerySender(cfg, cfg.Table, componenttest.NewNopTelemetrySettings())
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "projectID")
+}
+
+// Helper function to replace the metadata server lookup for the duration of
+// a test
+func stubMetadataProjectID(t *testing.T, projectID string, err error) {
+	original := metadataProjectID
+	metadataProjectID = func(context.Context) (string, error) { return projectID, err }
+	t.Cleanup(func() { metadataProjectID = original })
+}
+
+// Helper function to replace the client factory for the duration of a test
+func stubClientFactory(t *testing.T, factory func(context.Context, string, ...option.ClientOption) (*bigquery.Client, error)) {
+	original := newBigQueryClient
+	newBigQueryClient = factory
+	t.Cleanup(func() { newBigQueryClient = original })
+}
+
+func TestNewSenderTransport(t *testing.T) {
+	for _, useGRPC := range []bool{false, true} {
+		t.Run(fmt.Sprintf("useGRPC=%v", useGRPC), func(t *testing.T) {
+			cfg := createTestConfig()
+			cfg.UseGRPC = useGRPC
+			cfg.Endpoint = "https://bigquery.example.com/bigquery/v2/"
+			cfg.CredentialsJSON = `{"type": "service_account"}`
+			stubClientFactory(t, func(ctx context.Context, projectID string, opts ...option.ClientOption) (*bigquery.Client, error) {
+				return &bigquery.Client{}, nil
+			})
+			var grpcOpts []option.ClientOption
+			grpcClients := 0
+			stubWriteClientFactory(t, func(ctx context.Context, projectID string, opts ...option.ClientOption) (*managedwriter.Client, error) {
+				grpcClients++
+				grpcOpts = opts
+				return &managedwriter.Client{}, nil
+			})
+
+			sender, err := newBigQuerySender(cfg, cfg.Table, componenttest.NewNopTelemetrySettings())
+			require.NoError(t, err)
+
+			if !useGRPC {
+				assert.Equal(t, 0, grpcClients, "REST should be used by default")
+				assert.IsType(t, &bigquery.Inserter{}, sender.inserter)
+				return
+			}
+			assert.Equal(t, 1, grpcClients, "A gRPC client should be created")
+			assert.IsType(t, &storageWriteInserter{}, sender.inserter, "Rows should be written over gRPC")
+			assert.Equal(t, []option.ClientOption{option.WithCredentialsJSON([]byte(cfg.CredentialsJSON))}, grpcOpts,
+				"The REST endpoint should not be applied to the gRPC client")
+		})
+	}
+}
+
+func TestNewSenderLocation(t *testing.T) {
+	cfg := createTestConfig()
+	cfg.Location = "us-east4"
+	stubClientFactory(t, func(ctx context.Context, projectID string, opts ...option.ClientOption) (*bigquery.Client, error) {
+		return &bigquery.Client{}, nil
+	})
+
+	sender, err := newBigQuerySender(cfg, cfg.Table, componenttest.NewNopTelemetrySettings())
+	require.NoError(t, err)
+
+	assert.Equal(t, "us-east4", sender.bigqueryClient.Location, "The client's jobs should run in the configured location")
+}
+
+func TestNewSenderGCSFallback(t *testing.T) {
+	cfg := createTestConfig()
+	cfg.GCSFallbackBucket = "otelex-fallback"
+	cfg.RouteByAttribute = "tenant"
+	cfg.RouteTableMapping = map[string]string{"acme": "spattex_acme"}
+	stubClientFactory(t, func(ctx context.Context, projectID string, opts ...option.ClientOption) (*bigquery.Client, error) {
+		return &bigquery.Client{}, nil
+	})
+	stubStorageClientFactory(t, func(ctx context.Context, opts ...option.ClientOption) (*storage.Client, error) {
+		return storage.NewClient(ctx, option.WithoutAuthentication())
+	})
+
+	sender, err := newBigQuerySender(cfg, cfg.Table, componenttest.NewNopTelemetrySettings())
+	require.NoError(t, err)
+	sender.addRoutes()
+
+	require.NotNil(t, sender.fallback)
+	assert.Equal(t, "otelex-fallback", sender.fallback.bucket)
+	assert.Same(t, sender.fallback, sender.routes["spattex_acme"].fallback, "Routes should share the fallback bucket")
+	require.NoError(t, sender.fallback.client.Close())
+}
+
+func TestNewTableSenderInsertOptions(t *testing.T) {
+	cfg := createTestConfig()
+	sender := newTableSender(cfg, &bigquery.Client{}, nil, cfg.Table, zap.NewNop())
+	inserter := sender.inserter.(*bigquery.Inserter)
+	assert.False(t, inserter.SkipInvalidRows, "Invalid rows should fail the request by default")
+	assert.False(t, inserter.IgnoreUnknownValues, "Unknown values should fail the request by default")
+
+	cfg.SkipInvalidRows = true
+	cfg.IgnoreUnknownValues = true
+	sender = newTableSender(cfg, &bigquery.Client{}, nil, cfg.Table, zap.NewNop())
+
+	for _, inserter := range []rowInserter{sender.inserter, sender.shardInserter("_20240131")} {
+		assert.True(t, inserter.(*bigquery.Inserter).SkipInvalidRows)
+		assert.True(t, inserter.(*bigquery.Inserter).IgnoreUnknownValues)
+	}
+}
+
+func TestNewSenderImpersonation(t *testing.T) {
+	cfg := createTestConfig()
+	cfg.ImpersonateServiceAccount = "writer@msyvr.iam.gserviceaccount.com"
+	cfg.ImpersonateDelegates = []string{"delegate@msyvr.iam.gserviceaccount.com"}
+	ts := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "impersonated"})
+	var got impersonate.CredentialsConfig
+	original := newImpersonatedTokenSource
+	newImpersonatedTokenSource = func(ctx context.Context, config impersonate.CredentialsConfig, opts ...option.ClientOption) (oauth2.TokenSource, error) {
+		got = config
+		return ts, nil
+	}
+	t.Cleanup(func() { newImpersonatedTokenSource = original })
+	var opts []option.ClientOption
+	stubClientFactory(t, func(ctx context.Context, projectID string, o ...option.ClientOption) (*bigquery.Client, error) {
+		opts = o
+		return &bigquery.Client{}, nil
+	})
+
+	_, err := newBigQuerySender(cfg, cfg.Table, componenttest.NewNopTelemetrySettings())
+	require.NoError(t, err)
+
+	assert.Equal(t, cfg.ImpersonateServiceAccount, got.TargetPrincipal)
+	assert.Equal(t, cfg.ImpersonateDelegates, got.Delegates)
+	assert.Equal(t, []string{bigquery.Scope}, got.Scopes)
+	assert.Contains(t, opts, option.WithTokenSource(ts), "Client should authenticate with the impersonated token source")
+}
+
+func TestNewSenderImpersonationGCSFallback(t *testing.T) {
+	cfg := createTestConfig()
+	cfg.ImpersonateServiceAccount = "writer@msyvr.iam.gserviceaccount.com"
+	cfg.GCSFallbackBucket = "otelex-fallback"
+	ts := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "impersonated"})
+	var got impersonate.CredentialsConfig
+	original := newImpersonatedTokenSource
+	newImpersonatedTokenSource = func(ctx context.Context, config impersonate.CredentialsConfig, opts ...option.ClientOption) (oauth2.TokenSource, error) {
+		got = config
+		return ts, nil
+	}
+	t.Cleanup(func() { newImpersonatedTokenSource = original })
+	stubClientFactory(t, func(ctx context.Context, projectID string, o ...option.ClientOption) (*bigquery.Client, error) {
+		return &bigquery.Client{}, nil
+	})
+	var storageOpts []option.ClientOption
+	stubStorageClientFactory(t, func(ctx context.Context, o ...option.ClientOption) (*storage.Client, error) {
+		storageOpts = o
+		return storage.NewClient(ctx, option.WithoutAuthentication())
+	})
+
+	sender, err := newBigQuerySender(cfg, cfg.Table, componenttest.NewNopTelemetrySettings())
+	require.NoError(t, err)
+	t.Cleanup(func() { sender.fallback.client.Close() })
+
+	assert.Equal(t, []string{bigquery.Scope, storage.ScopeReadWrite}, got.Scopes, "Impersonated tokens should be scoped for the fallback bucket")
+	assert.Contains(t, storageOpts, option.WithTokenSource(ts), "The GCS client should authenticate with the impersonated token source")
+}
+
+// Helper function to replace the GCS client factory for a test
+func stubStorageClientFactory(t *testing.T, factory func(context.Context, ...option.ClientOption) (*storage.Client, error)) {
+	original := newStorageClient
+	newStorageClient = factory
+	t.Cleanup(func() { newStorageClient = original })
+}
+
+// Helper function to replace the Storage Write client factory for a test
+func stubWriteClientFactory(t *testing.T, factory func(context.Context, string, ...option.ClientOption) (*managedwriter.Client, error)) {
+	original := newWriteClient
+	newWriteClient = factory
+	t.Cleanup(func() { newWriteClient = original })
+}
+
+func TestClassifyQuotaError(t *testing.T) {
+	quotaErrs := []error{
+		&googleapi.Error{Code: http.StatusForbidden, Errors: []googleapi.ErrorItem{{Reason: "quotaExceeded"}}},
+		fmt.Errorf("insert: %w", &googleapi.Error{Code: http.StatusForbidden, Errors: []googleapi.ErrorItem{{Reason: "rateLimitExceeded"}}}),
+		&googleapi.Error{Code: http.StatusTooManyRequests},
+	}
+
+	for _, err := range quotaErrs {
+		classified := classifyError(err, false)
+
+		assert.False(t, consumererror.IsPermanent(classified), "Quota error %v should be retried", err)
+		assert.NotEqual(t, err, classified, "Quota error %v should be wrapped for a longer backoff", err)
+		assert.ErrorIs(t, classified, err)
+	}
+
+	genericErr := &googleapi.Error{Code: http.StatusServiceUnavailable}
+	assert.Equal(t, tagErrorKind(genericErr), classifyError(genericErr, false), "Other retryable errors should use the usual backoff")
+
+	accessErr := &googleapi.Error{Code: http.StatusForbidden, Errors: []googleapi.ErrorItem{{Reason: "accessDenied"}}}
+	assert.True(t, consumererror.IsPermanent(classifyError(accessErr, false)), "Other 403s should still be permanent")
+}
+
+func TestClassifyError(t *testing.T) {
+	schemaErr := fmt.Errorf("%w: new_key.", errSchemaMismatch)
+	authErr := fmt.Errorf("insert: %w", &googleapi.Error{Code: http.StatusUnauthorized, Message: "Request had invalid authentication credentials."})
+
+	tests := []struct {
+		name           string
+		err            error
+		schemaFlexible bool
+		permanent      bool
+	}{
+		{
+			name:           "missing field with flexible schema",
+			err:            schemaErr,
+			schemaFlexible: true,
+			permanent:      false,
+		},
+		{
+			name:           "missing field with fixed schema",
+			err:            schemaErr,
+			schemaFlexible: false,
+			permanent:      true,
+		},
+		{
+			name:           "auth error",
+			err:            authErr,
+			schemaFlexible: true,
+			permanent:      true,
+		},
+		{
+			name:           "forbidden",
+			err:            &googleapi.Error{Code: http.StatusForbidden},
+			schemaFlexible: true,
+			permanent:      true,
+		},
+		{
+			name:           "server error",
+			err:            &googleapi.Error{Code: http.StatusServiceUnavailable},
+			schemaFlexible: true,
+			permanent:      false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := classifyError(tt.err, tt.schemaFlexible)
+
+			require.ErrorIs(t, err, tt.err)
+			assert.Equal(t, tt.permanent, consumererror.IsPermanent(err))
+		})
+	}
+}
+
+func TestSendRowsClassifiesInsertErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       error
+		kind      error
+		permanent bool
+		throttled bool
+	}{
+		{
+			name:      "missing field",
+			err:       noSuchFieldError("new_key"),
+			kind:      errSchemaMismatch,
+			permanent: true,
+		},
+		{
+			name:      "table not found",
+			err:       &googleapi.Error{Code: http.StatusNotFound, Message: "Not found: Table project:dataset.table"},
+			kind:      errTableNotFound,
+			permanent: true,
+		},
+		{
+			name:      "quota exceeded",
+			err:       &googleapi.Error{Code: http.StatusForbidden, Errors: []googleapi.ErrorItem{{Reason: "quotaExceeded"}}},
+			kind:      errQuotaExceeded,
+			throttled: true,
+		},
+		{
+			name:      "access denied",
+			err:       &googleapi.Error{Code: http.StatusForbidden, Errors: []googleapi.ErrorItem{{Reason: "accessDenied"}}},
+			kind:      errAccessDenied,
+			permanent: true,
+		},
+		{
+			name:      "invalid request",
+			err:       &googleapi.Error{Code: http.StatusBadRequest, Errors: []googleapi.ErrorItem{{Reason: "invalid"}}, Message: "Request payload size exceeds the limit"},
+			kind:      errInvalidRequest,
+			permanent: true,
+		},
+		{
+			name: "server error",
+			err:  &googleapi.Error{Code: http.StatusServiceUnavailable},
+			kind: errTransient,
+		},
+		{
+			name: "network timeout",
+			err:  &url.Error{Op: "Post", URL: "https://bigquery.googleapis.com", Err: &net.OpError{Op: "dial", Net: "tcp", Err: timeoutError{}}},
+			kind: errTransient,
+		},
+		{
+			name: "connection reset",
+			err:  &url.Error{Op: "Post", URL: "https://bigquery.googleapis.com", Err: &net.OpError{Op: "read", Net: "tcp", Err: syscall.ECONNRESET}},
+			kind: errTransient,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inserter := &fakeInserter{errs: []error{tt.err}}
+			sender := &bigquerySender{Config: createTestConfig(), inserter: inserter, logger: zap.NewNop()}
+			rows := []bigqueryrow{{"name": "span1", "new_key": int64(1)}}
+
+			err := sender.sendRows(context.Background(), rows)
+
+			require.Error(t, err)
+			assert.Equal(t, tt.err.Error(), err.Error(), "Tagged errors should read as BigQuery's")
+			for _, kind := range []error{errSchemaMismatch, errTableNotFound, errQuotaExceeded, errAccessDenied, errInvalidRequest, errTransient} {
+				assert.Equal(t, kind == tt.kind, errors.Is(err, kind), "The error should only be of kind %v", tt.kind)
+			}
+			classified := classifyError(err, sender.SchemaFlexible)
+			assert.Equal(t, tt.permanent, consumererror.IsPermanent(classified))
+			if !tt.permanent {
+				assert.Equal(t, tt.throttled, classified != err, "Only quota errors should be retried after a longer backoff")
+			}
+		})
+	}
+}
+
+// A net.Error that timed out
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestIsRowSchemaMismatch(t *testing.T) {
+	missing := &bigquery.RowInsertionError{Errors: bigquery.MultiError{&bigquery.Error{Reason: "invalid", Message: "no such field: new_key."}}}
+	invalid := &bigquery.RowInsertionError{Errors: bigquery.MultiError{&bigquery.Error{Reason: "invalid", Message: "Cannot convert value to integer."}}}
+	stopped := &bigquery.RowInsertionError{Errors: bigquery.MultiError{&bigquery.Error{Reason: "stopped"}}}
+
+	assert.True(t, isRowSchemaMismatch(missing))
+	assert.False(t, isRowSchemaMismatch(invalid), "Values that don't fit their column can't be fixed by a schema update")
+	assert.False(t, isRowSchemaMismatch(stopped))
+}
+
+func TestClassifyNilError(t *testing.T) {
+	assert.NoError(t, classifyError(nil, false))
+}
+
+func TestUpdateSchemaUsesCache(t *testing.T) {
+	table := newFakeSchemaManager(bigquery.Schema{
+		{Name: "name", Type: bigquery.StringFieldType},
+	})
+	sender := &bigquerySender{Config: createTestConfig(), schemaManager: table, logger: zap.NewNop()}
+	rows := []bigqueryrow{{"name": "span1", "new_key": "value"}}
+
+	require.NoError(t, sender.updateSchema(context.Background(), rows))
+	require.NoError(t, sender.updateSchema(context.Background(), rows))
+
+	assert.Equal(t, 1, table.metadataCalls, "Schema should be fetched once, then cached")
+	assert.Equal(t, 1, table.updateCalls, "A known new field should not trigger another update")
+	assert.Equal(t, bigquery.StringFieldType, sender.schema.types["new_key"], "Cache should include the new field")
+}
+
+func TestUpdateSchemaRetriesOnETagConflict(t *testing.T) {
+	table := newFakeSchemaManager(bigquery.Schema{
+		{Name: "name", Type: bigquery.StringFieldType},
+	})
+	table.updateErrs = []error{&googleapi.Error{Code: http.StatusPreconditionFailed}}
+	table.onUpdate = func() {
+		if table.updateCalls == 1 {
+			// Another writer added a field before this update landed.
+			table.meta = &bigquery.TableMetadata{
+				Schema: bigquery.Schema{
+					{Name: "name", Type: bigquery.StringFieldType},
+					{Name: "other_key", Type: bigquery.IntegerFieldType},
+				},
+				ETag: "etag-other",
+			}
+		}
+	}
+	sender := &bigquerySender{Config: createTestConfig(), schemaManager: table, logger: zap.NewNop()}
+	rows := []bigqueryrow{{"name": "span1", "new_key": "value"}}
+
+	require.NoError(t, sender.updateSchema(context.Background(), rows))
+
+	assert.Equal(t, 2, table.metadataCalls, "Schema should be refetched after an ETag conflict")
+	assert.Equal(t, 2, table.updateCalls)
+	assert.Equal(t, bigquery.IntegerFieldType, fieldType(table.meta.Schema, "other_key"), "The concurrent writer's field should be kept")
+	assert.Equal(t, bigquery.StringFieldType, fieldType(table.meta.Schema, "new_key"))
+}
+
+func TestUpdateSchemaGivesUpAfterRepeatedETagConflicts(t *testing.T) {
+	table := newFakeSchemaManager(bigquery.Schema{
+		{Name: "name", Type: bigquery.StringFieldType},
+	})
+	table.updateErr = &googleapi.Error{Code: http.StatusPreconditionFailed}
+	sender := &bigquerySender{Config: createTestConfig(), schemaManager: table, logger: zap.NewNop()}
+	rows := []bigqueryrow{{"name": "span1", "new_key": "value"}}
+
+	err := sender.updateSchema(context.Background(), rows)
+	require.Error(t, err)
+	assert.True(t, isETagConflict(err))
+	assert.Equal(t, maxSchemaUpdateAttempts, table.updateCalls)
+
+	table.updateErr = nil
+	require.NoError(t, sender.updateSchema(context.Background(), rows))
+	assert.Equal(t, maxSchemaUpdateAttempts+1, table.metadataCalls, "Schema should be refetched after giving up")
+}
+
+func TestStartPrefetchesSchema(t *testing.T) {
+	table := newFakeSchemaManager(bigquery.Schema{
+		{Name: "name", Type: bigquery.StringFieldType},
+		{Name: "ts", Type: bigquery.TimestampFieldType},
+	})
+	sender := &bigquerySender{Config: createTestConfig(), schemaManager: table, logger: zap.NewNop()}
+
+	require.NoError(t, sender.start(context.Background(), nil))
+
+	assert.Equal(t, 1, table.metadataCalls)
+	assert.True(t, sender.schema.loaded, "Schema cache should be warm after start")
+	assert.Equal(t, bigquery.TimestampFieldType, sender.schema.types["ts"])
+}
+
+func TestStartFailsWhenTableMissing(t *testing.T) {
+	table := newFakeSchemaManager(nil)
+	table.metadataErr = &googleapi.Error{Code: http.StatusNotFound, Message: "Not found: Table msyvr:otelex.spattex_test"}
+	sender := &bigquerySender{Config: createTestConfig(), schemaManager: table, logger: zap.NewNop()}
+
+	err := sender.start(context.Background(), nil)
+
+	require.Error(t, err)
+	assert.False(t, sender.schema.loaded)
+}
+
+func TestStartFailsWhenTableIsView(t *testing.T) {
+	for _, tableType := range []bigquery.TableType{bigquery.ViewTable, bigquery.MaterializedView} {
+		table := newFakeSchemaManager(bigquery.Schema{{Name: "ts", Type: bigquery.TimestampFieldType}})
+		table.meta.Type = tableType
+		sender := newTestSender(t, withTableClients(&fakeDatasetManager{}, table))
+
+		err := sender.start(context.Background(), nil)
+
+		require.Error(t, err, "start should fail for a %s", tableType)
+		assert.ErrorContains(t, err, "otelex.spattex_test is a "+string(tableType))
+		assert.ErrorContains(t, err, "rows can only be inserted into tables")
+	}
+
+	table := newFakeSchemaManager(bigquery.Schema{{Name: "ts", Type: bigquery.TimestampFieldType}})
+	table.meta.Type = bigquery.RegularTable
+	sender := newTestSender(t, withTableClients(&fakeDatasetManager{}, table))
+	require.NoError(t, sender.start(context.Background(), nil))
+}
+
+func TestShutdownDrainsExportsInProgress(t *testing.T) {
+	inserter := newBlockingInserter()
+	cfg := createTestConfig()
+	sender := &bigquerySender{Config: cfg, inserter: inserter, logger: zap.NewNop(), rows: newRowBuilder(cfg, zap.NewNop())}
+
+	exported := make(chan error, 1)
+	go func() {
+		exported <- sender.consumeTraces(context.Background(), createTestTraces())
+	}()
+	<-inserter.started
+
+	shutdown := make(chan error, 1)
+	go func() {
+		shutdown <- sender.shutdown(context.Background())
+	}()
+	select {
+	case <-shutdown:
+		t.Fatal("Shutdown should wait for the export in progress")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(inserter.release)
+	require.NoError(t, <-shutdown)
+	require.NoError(t, <-exported)
+	assert.Equal(t, []int{2}, inserter.putSizes, "Pending rows should be inserted before shutdown returns")
+}
+
+func TestShutdownDrainTimeout(t *testing.T) {
+	inserter := newBlockingInserter()
+	defer close(inserter.release)
+	cfg := createTestConfig()
+	cfg.ShutdownTimeout = 10 * time.Millisecond
+	sender := &bigquerySender{Config: cfg, tableID: cfg.Table, inserter: inserter, logger: zap.NewNop(), rows: newRowBuilder(cfg, zap.NewNop())}
+
+	go func() {
+		_ = sender.consumeTraces(context.Background(), createTestTraces())
+	}()
+	<-inserter.started
+
+	err := sender.shutdown(context.Background())
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "still in progress")
+}
+
+func TestShutdownWithoutExports(t *testing.T) {
+	sender := &bigquerySender{Config: createTestConfig()}
+
+	require.NoError(t, sender.shutdown(context.Background()))
+}
+
+func TestSleepCtxHonorsDelay(t *testing.T) {
+	const delay = 20 * time.Millisecond
+
+	start := time.Now()
+	err := sleepCtx(context.Background(), delay)
+
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, time.Since(start), delay)
+}
+
+func TestSleepCtxCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+
+	start := time.Now()
+	err := sleepCtx(ctx, time.Minute)
+
+	require.ErrorIs(t, err, context.Canceled)
+	assert.Less(t, time.Since(start), time.Second, "Cancellation should end the wait early")
+}
+
+func TestValueSaversInsertID(t *testing.T) {
+	traces := createTestTraces()
+	span := traces.ResourceSpans().At(0).ScopeSpans().At(0).Spans().At(0)
+	span.SetTraceID(pcommon.TraceID{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16})
+	span.SetSpanID(pcommon.SpanID{1, 2, 3, 4, 5, 6, 7, 8})
+
+	t.Run("deduplicate", func(t *testing.T) {
+		cfg := createTestConfig()
+		cfg.Deduplicate = true
+		sender := &bigquerySender{Config: cfg}
+
+		_, first, err := sender.valueSavers(testRowBuilder().buildRows(traces))[0].Save()
+		require.NoError(t, err)
+		_, second, err := sender.valueSavers(testRowBuilder().buildRows(traces))[0].Save()
+		require.NoError(t, err)
+
+		assert.NotEmpty(t, first)
+		assert.Equal(t, first, second, "Identical spans should have the same insertID")
+	})
+
+	t.Run("no deduplicate", func(t *testing.T) {
+		cfg := createTestConfig()
+		cfg.Deduplicate = false
+		sender := &bigquerySender{Config: cfg}
+
+		row, insertID, err := sender.valueSavers(testRowBuilder().buildRows(traces))[0].Save()
+		require.NoError(t, err)
+
+		assert.Empty(t, insertID, "insertID should be left to the inserter")
+		assert.Equal(t, "span1", row["name"])
+	})
+}
+
+func TestValueSaversLogInsertID(t *testing.T) {
+	logs := plog.NewLogs()
+	records := logs.ResourceLogs().AppendEmpty().ScopeLogs().AppendEmpty().LogRecords()
+	for _, body := range []string{"cache miss", "retrying"} {
+		record := records.AppendEmpty()
+		record.SetTraceID(pcommon.TraceID{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16})
+		record.SetSpanID(pcommon.SpanID{1, 2, 3, 4, 5, 6, 7, 8})
+		record.SetTimestamp(pcommon.Timestamp(1000))
+		record.Body().SetStr(body)
+	}
+	cfg := createTestConfig()
+	cfg.Deduplicate = true
+	sender := &bigquerySender{Config: cfg}
+
+	savers := sender.valueSavers(testRowBuilder().buildLogRows(logs))
+	_, first, err := savers[0].Save()
+	require.NoError(t, err)
+	_, second, err := savers[1].Save()
+	require.NoError(t, err)
+	_, resent, err := sender.valueSavers(testRowBuilder().buildLogRows(logs))[0].Save()
+	require.NoError(t, err)
+
+	assert.NotEmpty(t, first)
+	assert.NotEqual(t, first, second, "Logs in the same span should have distinct insertIDs")
+	assert.Equal(t, first, resent, "A resent log should have the same insertID")
+}
+
+func TestSendRowsRateLimited(t *testing.T) {
+	inserter := &fakeInserter{}
+	cfg := createTestConfig()
+	cfg.MaxRowsPerRequest = 1
+	sender := &bigquerySender{
+		Config:   cfg,
+		logger:   zap.NewNop(),
+		inserter: inserter,
+		limiter:  rate.NewLimiter(20, 1),
+	}
+	rows := []bigqueryrow{{"name": "span1"}, {"name": "span2"}, {"name": "span3"}}
+
+	start := time.Now()
+	require.NoError(t, sender.sendRows(context.Background(), rows))
+
+	assert.Equal(t, []int{1, 1, 1}, inserter.putSizes)
+	assert.GreaterOrEqual(t, time.Since(start), 90*time.Millisecond, "Inserts after the first should wait for the limiter")
+}
+
+func TestSendRowsRateLimitHonorsCancellation(t *testing.T) {
+	inserter := &fakeInserter{}
+	sender := &bigquerySender{
+		Config:   createTestConfig(),
+		inserter: inserter,
+		limiter:  rate.NewLimiter(0.01, 1),
+	}
+	rows := []bigqueryrow{{"name": "span1"}}
+	require.NoError(t, sender.sendRows(context.Background(), rows))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	require.Error(t, sender.sendRows(ctx, rows), "Waiting for the limiter should stop when the context is done")
+	assert.Equal(t, []int{1}, inserter.putSizes)
+}
+
+func TestSendRowsRoutesByAttribute(t *testing.T) {
+	cfg := createTestConfig()
+	cfg.RouteByAttribute = "tenant.id"
+	cfg.RouteTableMapping = map[string]string{"acme": "spattex_acme", "globex": "spattex_globex"}
+	defaultInserter, acmeInserter, globexInserter := &fakeInserter{}, &fakeInserter{}, &fakeInserter{}
+	sender := &bigquerySender{
+		Config:   cfg,
+		inserter: defaultInserter,
+		routes: map[string]*bigquerySender{
+			"spattex_acme":   {Config: cfg, tableID: "spattex_acme", inserter: acmeInserter},
+			"spattex_globex": {Config: cfg, tableID: "spattex_globex", inserter: globexInserter},
+		},
+	}
+
+	traces := ptrace.NewTraces()
+	rs := traces.ResourceSpans().AppendEmpty()
+	rs.Resource().Attributes().PutStr("tenant.id", "acme")
+	spans := rs.ScopeSpans().AppendEmpty().Spans()
+	spans.AppendEmpty().SetName("acme_span")
+	spans.AppendEmpty().SetName("acme_span")
+	spans.AppendEmpty().Attributes().PutStr("tenant.id", "globex")
+	spans.AppendEmpty().Attributes().PutStr("tenant.id", "initech")
+	traces.ResourceSpans().AppendEmpty().ScopeSpans().AppendEmpty().Spans().AppendEmpty().SetName("untagged_span")
+
+	rows := newRowBuilder(cfg, zap.NewNop()).buildRows(traces)
+	require.NoError(t, sender.sendRows(context.Background(), rows))
+
+	assert.Equal(t, []int{2}, acmeInserter.putSizes, "Resource attribute should route spans")
+	assert.Equal(t, []int{1}, globexInserter.putSizes, "Span attribute should take precedence over the resource attribute")
+	assert.Equal(t, []int{2}, defaultInserter.putSizes, "Unmapped and missing values should fall back to the default table")
+}
+
+func TestSendRowsRoutesByStandardResourceColumn(t *testing.T) {
+	cfg := createTestConfig()
+	cfg.StandardResourceColumns = true
+	cfg.AttributeColumnPrefix = "attr_"
+	cfg.RouteByAttribute = "service.name"
+	cfg.RouteTableMapping = map[string]string{"checkout": "spattex_checkout"}
+	defaultInserter, checkoutInserter := &fakeInserter{}, &fakeInserter{}
+	sender := &bigquerySender{
+		Config:   cfg,
+		inserter: defaultInserter,
+		routes: map[string]*bigquerySender{
+			"spattex_checkout": {Config: cfg, tableID: "spattex_checkout", inserter: checkoutInserter},
+		},
+	}
+
+	traces := ptrace.NewTraces()
+	rs := traces.ResourceSpans().AppendEmpty()
+	rs.Resource().Attributes().PutStr("service.name", "checkout")
+	rs.ScopeSpans().AppendEmpty().Spans().AppendEmpty()
+
+	rows := newRowBuilder(cfg, zap.NewNop()).buildRows(traces)
+	require.NoError(t, sender.sendRows(context.Background(), rows))
+
+	assert.Equal(t, []int{1}, checkoutInserter.putSizes, "The standard column should route spans")
+	assert.Empty(t, defaultInserter.putSizes)
+}
+
+func TestSendRowsRouteFailure(t *testing.T) {
+	cfg := createTestConfig()
+	cfg.RouteByAttribute = "tenant"
+	cfg.RouteTableMapping = map[string]string{"acme": "spattex_acme"}
+	acmeInserter := &fakeInserter{errs: []error{errors.New("insert failed")}}
+	sender := &bigquerySender{
+		Config:   cfg,
+		inserter: &fakeInserter{},
+		routes:   map[string]*bigquerySender{"spattex_acme": {Config: cfg, tableID: "spattex_acme", inserter: acmeInserter}},
+	}
+	rows := []bigqueryrow{{"name": "span1", "tenant": "acme"}}
+
+	err := sender.sendRows(context.Background(), rows)
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "spattex_acme", "Error should name the routed table")
+}
+
+func TestSendRowsShardsByDate(t *testing.T) {
+	cfg := createTestConfig()
+	cfg.TableSuffixFormat = "_20060102"
+	shards := map[string]*fakeInserter{}
+	sender := &bigquerySender{
+		Config:   cfg,
+		tableID:  cfg.Table,
+		inserter: &fakeInserter{},
+		shardInserter: func(suffix string) rowInserter {
+			shards[suffix] = &fakeInserter{}
+			return shards[suffix]
+		},
+	}
+	day1 := pcommon.NewTimestampFromTime(time.Date(2024, 1, 31, 23, 59, 0, 0, time.UTC))
+	day2 := pcommon.NewTimestampFromTime(time.Date(2024, 2, 1, 0, 1, 0, 0, time.UTC))
+	rows := []bigqueryrow{
+		{"name": "span1", "ts": day1},
+		{"name": "span2", "ts": day2},
+		{"name": "span3", "ts": day1},
+	}
+
+	require.NoError(t, sender.sendRows(context.Background(), rows))
+
+	require.Len(t, shards, 2, "Rows from two days should be inserted into two shards")
+	assert.Equal(t, []int{2}, shards["_20240131"].putSizes)
+	assert.Equal(t, []int{1}, shards["_20240201"].putSizes)
+}
+
+func TestSendRowsWithoutShards(t *testing.T) {
+	inserter := &fakeInserter{}
+	sender := &bigquerySender{
+		Config:   createTestConfig(),
+		inserter: inserter,
+		shardInserter: func(suffix string) rowInserter {
+			t.Fatalf("unexpected shard %s", suffix)
+			return nil
+		},
+	}
+	rows := []bigqueryrow{{"name": "span1", "ts": pcommon.Timestamp(1)}}
+
+	require.NoError(t, sender.sendRows(context.Background(), rows))
+
+	assert.Equal(t, []int{1}, inserter.putSizes, "Rows should be inserted into the table itself")
+}
+
+func TestSendRowsStampsIngestTime(t *testing.T) {
+	inserter := &fakeInserter{}
+	cfg := createTestConfig()
+	cfg.IngestTimestampColumn = "ingested_at"
+	sender := &bigquerySender{Config: cfg, inserter: inserter, logger: zap.NewNop()}
+	rows := []bigqueryrow{
+		{"name": "span1", "ts": pcommon.Timestamp(1)},
+		{"name": "span2", "ts": pcommon.Timestamp(2)},
+	}
+
+	require.NoError(t, sender.sendRows(context.Background(), rows))
+
+	require.Len(t, inserter.rows, 2)
+	for _, saver := range inserter.rows {
+		row, _, err := saver.Save()
+		require.NoError(t, err)
+		ingested, ok := row["ingested_at"].(pcommon.Timestamp)
+		require.True(t, ok, "Rows should have an ingest timestamp")
+		assert.WithinDuration(t, time.Now(), ingested.AsTime(), time.Minute)
+		assert.NotEqual(t, row["ts"], ingested, "The span timestamp should be kept")
+	}
+}
+
+func TestSendRowsWithoutIngestTime(t *testing.T) {
+	inserter := &fakeInserter{}
+	sender := &bigquerySender{Config: createTestConfig(), inserter: inserter, logger: zap.NewNop()}
+	rows := []bigqueryrow{{"name": "span1"}}
+
+	require.NoError(t, sender.sendRows(context.Background(), rows))
+
+	assert.Equal(t, bigqueryrow{"name": "span1"}, inserter.rows[0])
+}
+
+func TestStartWarmsRoutedTables(t *testing.T) {
+	table, acmeTable := newFakeSchemaManager(nil), newFakeSchemaManager(nil)
+	cfg := createTestConfig()
+	sender := &bigquerySender{
+		Config:        cfg,
+		logger:        zap.NewNop(),
+		schemaManager: table,
+		routes:        map[string]*bigquerySender{"spattex_acme": {Config: cfg, tableID: "spattex_acme", logger: zap.NewNop(), schemaManager: acmeTable}},
+	}
+
+	require.NoError(t, sender.start(context.Background(), nil))
+
+	assert.Equal(t, 1, table.metadataCalls)
+	assert.Equal(t, 1, acmeTable.metadataCalls, "Routed table schemas should be fetched at start")
+}
+
+func TestSendRowsSplitsBatch(t *testing.T) {
+	inserter := &fakeInserter{}
+	sender := &bigquerySender{Config: createTestConfig(), inserter: inserter, logger: zap.NewNop()}
+	rows := make([]bigqueryrow, 1200)
+	for i := range rows {
+		rows[i] = bigqueryrow{"name": fmt.Sprintf("span%d", i)}
+	}
+
+	require.NoError(t, sender.sendRows(context.Background(), rows))
+
+	assert.Equal(t, []int{500, 500, 200}, inserter.putSizes, "1,200 rows should be inserted in three requests")
+}
+
+func TestSendRowsStopsAtFailedChunk(t *testing.T) {
+	inserter := &fakeInserter{errs: []error{nil, errors.New("backend unavailable")}}
+	sender := &bigquerySender{Config: createTestConfig(), inserter: inserter, logger: zap.NewNop()}
+	rows := make([]bigqueryrow, 1200)
+	for i := range rows {
+		rows[i] = bigqueryrow{"name": fmt.Sprintf("span%d", i)}
+	}
+
+	err := sender.sendRows(context.Background(), rows)
+
+	require.Error(t, err)
+	assert.Equal(t, []int{500, 500}, inserter.putSizes, "Chunks after the failed chunk should not be attempted")
+}
+
+func TestSendRowsBoundsConcurrentInserts(t *testing.T) {
+	cfg := createTestConfig()
+	cfg.MaxRowsPerRequest = 1
+	cfg.MaxConcurrentInserts = 4
+	inserter := &concurrencyInserter{}
+	sender := &bigquerySender{Config: cfg, inserter: inserter, logger: zap.NewNop()}
+	rows := make([]bigqueryrow, 8)
+	for i := range rows {
+		rows[i] = bigqueryrow{"name": fmt.Sprintf("span%d", i)}
+	}
+
+	require.NoError(t, sender.sendRows(context.Background(), rows))
+
+	assert.Equal(t, int32(8), inserter.puts.Load(), "Every chunk should be inserted")
+	assert.LessOrEqual(t, inserter.maxInFlight.Load(), int32(4), "At most 4 inserts should be in flight")
+	assert.Greater(t, inserter.maxInFlight.Load(), int32(1), "Chunks should be inserted concurrently")
+}
+
+func TestSendRowsAggregatesConcurrentErrors(t *testing.T) {
+	cfg := createTestConfig()
+	cfg.MaxRowsPerRequest = 1
+	cfg.MaxConcurrentInserts = 2
+	inserter := &concurrencyInserter{fail: map[string]bool{"span1": true, "span3": true}}
+	sender := &bigquerySender{Config: cfg, inserter: inserter, logger: zap.NewNop()}
+	rows := make([]bigqueryrow, 4)
+	for i := range rows {
+		rows[i] = bigqueryrow{"name": fmt.Sprintf("span%d", i)}
+	}
+
+	err := sender.sendRows(context.Background(), rows)
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "span1 failed")
+	assert.Contains(t, err.Error(), "span3 failed")
+	assert.Equal(t, int32(4), inserter.puts.Load(), "Chunks after a failure should still be inserted")
+}
+
+func TestSendRowsUpdatesSchemaAndRetries(t *testing.T) {
+	inserter := &fakeInserter{errs: []error{noSuchFieldError("new_key")}}
+	table := newFakeSchemaManager(bigquery.Schema{
+		{Name: "name", Type: bigquery.StringFieldType},
+	})
+	cfg := createTestConfig()
+	cfg.SchemaFlexible = true
+	cfg.SchemaUpdateSettleDelay = time.Millisecond
+	sender := &bigquerySender{Config: cfg, inserter: inserter, schemaManager: table, logger: zap.NewNop()}
+	rows := []bigqueryrow{{"name": "span1", "new_key": int64(1)}}
+
+	err := sender.sendRows(context.Background(), rows)
+
+	require.NoError(t, err, "Insert should succeed after the schema update")
+	assert.Equal(t, 2, len(inserter.putSizes), "Batch should be retried once after the schema update")
+	assert.Equal(t, 1, table.updateCalls)
+	assert.Equal(t, bigquery.IntegerFieldType, fieldType(table.meta.Schema, "new_key"))
+}
+
+func TestSendRowsRetriesSchemaUpdates(t *testing.T) {
+	inserter := &fakeInserter{errs: []error{noSuchFieldError("new_key"), noSuchFieldError("other_key")}}
+	original := bigquery.Schema{
+		{Name: "name", Type: bigquery.StringFieldType},
+		{Name: "trace_id", Type: bigquery.StringFieldType},
+		{Name: "span_id", Type: bigquery.StringFieldType},
+	}
+	table := newFakeSchemaManager(original)
+	// Another writer replaces the updated schema before the first retry, so
+	// the fields are missing again.
+	inserter.onPut = func() {
+		if len(inserter.putSizes) == 2 {
+			table.meta = &bigquery.TableMetadata{Schema: original, ETag: "replaced"}
+		}
+	}
+	cfg := createTestConfig()
+	cfg.SchemaFlexible = true
+	cfg.SchemaUpdateSettleDelay = time.Millisecond
+	cfg.Deduplicate = true
+	sender := &bigquerySender{Config: cfg, inserter: inserter, schemaManager: table, logger: zap.NewNop()}
+	rows := []bigqueryrow{{"name": "span1", "trace_id": "t1", "span_id": "s1", "new_key": int64(1), "other_key": "a"}}
+
+	err := sender.sendRows(context.Background(), rows)
+
+	require.NoError(t, err, "Insert should succeed after the second schema update")
+	assert.Equal(t, []int{1, 1, 1}, inserter.putSizes, "Batch should be retried after each schema update")
+	assert.Equal(t, 2, table.updateCalls)
+	assert.Equal(t, bigquery.IntegerFieldType, fieldType(table.meta.Schema, "new_key"))
+	assert.Equal(t, bigquery.StringFieldType, fieldType(table.meta.Schema, "other_key"))
+	for _, saver := range inserter.rows {
+		_, insertID, err := saver.Save()
+		require.NoError(t, err)
+		assert.Equal(t, "t1s1", insertID, "Retries should reuse the insertID")
+	}
+}
+
+func TestSendRowsLimitsSchemaUpdateRetries(t *testing.T) {
+	inserter := &fakeInserter{errs: []error{noSuchFieldError("new_key"), noSuchFieldError("new_key"), noSuchFieldError("new_key")}}
+	table := newFakeSchemaManager(bigquery.Schema{
+		{Name: "name", Type: bigquery.StringFieldType},
+	})
+	cfg := createTestConfig()
+	cfg.SchemaFlexible = true
+	cfg.SchemaUpdateSettleDelay = time.Millisecond
+	cfg.MaxSchemaUpdateRetries = 1
+	sender := &bigquerySender{Config: cfg, inserter: inserter, schemaManager: table, logger: zap.NewNop()}
+	rows := []bigqueryrow{{"name": "span1", "new_key": int64(1)}}
+
+	err := sender.sendRows(context.Background(), rows)
+
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, errSchemaMismatch))
+	assert.False(t, consumererror.IsPermanent(classifyError(err, cfg.SchemaFlexible)), "The retry queue should retry the batch later")
+	assert.Equal(t, 2, len(inserter.putSizes), "Batch should be retried at most MaxSchemaUpdateRetries times")
+}
+
+func TestSendRowsStopsAddingColumnsAtMaxColumns(t *testing.T) {
+	missing := bigquery.PutMultiError{
+		{RowIndex: 0, Errors: bigquery.MultiError{&bigquery.Error{Reason: "invalid", Message: "no such field: first_key."}}},
+		{RowIndex: 1, Errors: bigquery.MultiError{&bigquery.Error{Reason: "invalid", Message: "no such field: second_key."}}},
+	}
+	inserter, deadLetters := &fakeInserter{errs: []error{missing}}, &fakeInserter{}
+	table := newFakeSchemaManager(bigquery.Schema{
+		{Name: "name", Type: bigquery.StringFieldType},
+	})
+	cfg := createTestConfig()
+	cfg.SchemaFlexible = true
+	cfg.SchemaUpdateSettleDelay = time.Millisecond
+	cfg.MaxColumns = 2
+	sender := newTestSender(t, withConfig(cfg), withInserter(inserter), withDeadLetters(deadLetters))
+	sender.schemaManager = table
+	core, logs := observer.New(zap.ErrorLevel)
+	sender.logger = zap.New(core)
+	rows := []bigqueryrow{
+		{"name": "span1", "first_key": int64(1)},
+		{"name": "span2", "second_key": int64(2)},
+	}
+
+	require.NoError(t, sender.sendRows(context.Background(), rows))
+
+	assert.Len(t, table.meta.Schema, 2, "New fields should stop at maxColumns")
+	assert.Equal(t, bigquery.IntegerFieldType, fieldType(table.meta.Schema, "first_key"))
+	assert.Equal(t, bigquery.FieldType(""), fieldType(table.meta.Schema, "second_key"))
+	assert.Equal(t, []int{2, 1}, inserter.putSizes, "Only the row that fits should be retried")
+	require.Equal(t, []int{1}, deadLetters.putSizes, "The row with the refused field should be dead-lettered")
+	assert.Contains(t, savedRow(t, deadLetters.rows[0])["error"], "maxColumns")
+	assert.Equal(t, 1, logs.FilterMessage("Table is at maxColumns, so new fields aren't added, and rows with them are dead-lettered").Len())
+}
+
+func TestSendRowsCancelledDuringSchemaUpdate(t *testing.T) {
+	inserter := &fakeInserter{errs: []error{noSuchFieldError("new_key")}}
+	table := newFakeSchemaManager(bigquery.Schema{
+		{Name: "name", Type: bigquery.StringFieldType},
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	table.onUpdate = cancel
+	cfg := createTestConfig()
+	cfg.SchemaFlexible = true
+	cfg.SchemaUpdateSettleDelay = time.Minute
+	sender := &bigquerySender{Config: cfg, inserter: inserter, schemaManager: table, logger: zap.NewNop()}
+	rows := []bigqueryrow{{"name": "span1", "new_key": int64(1)}}
+
+	start := time.Now()
+	err := sender.sendRows(ctx, rows)
+
+	require.ErrorIs(t, err, context.Canceled)
+	assert.Less(t, time.Since(start), time.Second, "Cancellation should cut the settle delay short")
+	assert.Equal(t, 1, len(inserter.putSizes), "Batch should not be retried after cancellation")
+}
+
+func TestSendRowsCancelledBetweenChunks(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	inserter := &cancellingInserter{cancel: cancel}
+	sender := &bigquerySender{Config: createTestConfig(), inserter: inserter, logger: zap.NewNop()}
+	rows := make([]bigqueryrow, 1200)
+	for i := range rows {
+		rows[i] = bigqueryrow{"name": fmt.Sprintf("span%d", i)}
+	}
+
+	err := sender.sendRows(ctx, rows)
+
+	require.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, 1, inserter.puts, "Chunks after cancellation should not be attempted")
+}
+
+func TestSendRowsUpdatesSchemaAndDefersRetry(t *testing.T) {
+	inserter := &fakeInserter{errs: []error{noSuchFieldError("new_key")}}
+	table := newFakeSchemaManager(bigquery.Schema{
+		{Name: "name", Type: bigquery.StringFieldType},
+	})
+	cfg := createTestConfig()
+	cfg.SchemaFlexible = true
+	sender := &bigquerySender{Config: cfg, inserter: inserter, schemaManager: table, logger: zap.NewNop()}
+	rows := []bigqueryrow{{"name": "span1", "new_key": int64(1)}}
+
+	err := sender.sendRows(context.Background(), rows)
+
+	require.Error(t, err, "Without a settle delay the retry is left to the retry queue")
+	assert.False(t, consumererror.IsPermanent(classifyError(err, cfg.SchemaFlexible)))
+	assert.Equal(t, 1, len(inserter.putSizes))
+	assert.Equal(t, 1, table.updateCalls, "Schema should be updated before returning")
+}
+
+func TestSendRowsFixedSchema(t *testing.T) {
+	inserter := &fakeInserter{errs: []error{noSuchFieldError("new_key")}}
+	table := newFakeSchemaManager(bigquery.Schema{
+		{Name: "name", Type: bigquery.StringFieldType},
+	})
+	sender := &bigquerySender{Config: createTestConfig(), inserter: inserter, schemaManager: table, logger: zap.NewNop()}
+	rows := []bigqueryrow{{"name": "span1", "new_key": int64(1)}}
+
+	err := sender.sendRows(context.Background(), rows)
+
+	require.Error(t, err)
+	assert.Equal(t, 0, table.metadataCalls, "Fixed schemas should not be inspected")
+	assert.Equal(t, 0, table.updateCalls, "Fixed schemas should not be updated")
+}
+
+func TestSendRowsFixedSchemaMissingFieldIsPermanent(t *testing.T) {
+	inserter := &fakeInserter{errs: []error{noSuchFieldError("new_key"), noSuchFieldError("new_key")}}
+	table := newFakeSchemaManager(bigquery.Schema{
+		{Name: "name", Type: bigquery.StringFieldType},
+		{Name: "ts", Type: bigquery.TimestampFieldType},
+	})
+	core, logs := observer.New(zap.WarnLevel)
+	sender := &bigquerySender{Config: createTestConfig(), inserter: inserter, schemaManager: table, logger: zap.New(core)}
+	require.NoError(t, sender.start(context.Background(), nil))
+	rows := []bigqueryrow{{"name": "span1", "new_key": int64(1)}}
+
+	for i := 0; i < 2; i++ {
+		err := classifyError(sender.sendRows(context.Background(), rows), sender.SchemaFlexible)
+
+		require.Error(t, err)
+		assert.True(t, consumererror.IsPermanent(err), "Missing fields should not be retried when the schema is fixed")
+	}
+
+	warnings := logs.FilterMessageSnippet("missing from the table schema").All()
+	require.Len(t, warnings, 1, "Each missing column should be reported once")
+	assert.Equal(t, []interface{}{"new_key"}, warnings[0].ContextMap()["columns"])
+	assert.Equal(t, 0, table.updateCalls)
+}
+
+func TestStartWarnsOnFixedSchemaMissingColumns(t *testing.T) {
+	table := newFakeSchemaManager(bigquery.Schema{
+		{Name: "name", Type: bigquery.StringFieldType},
+	})
+	cfg := createTestConfig()
+	cfg.IngestTimestampColumn = "ingested_at"
+	core, logs := observer.New(zap.WarnLevel)
+	sender := &bigquerySender{Config: cfg, schemaManager: table, logger: zap.New(core)}
+
+	require.NoError(t, sender.start(context.Background(), nil))
+
+	warnings := logs.FilterMessageSnippet("every insert will fail").All()
+	require.Len(t, warnings, 1)
+	assert.Equal(t, []interface{}{"ts", "ingested_at"}, warnings[0].ContextMap()["columns"])
+}
+
+func TestStartFlexibleSchemaMissingColumns(t *testing.T) {
+	cfg := createTestConfig()
+	cfg.SchemaFlexible = true
+	core, logs := observer.New(zap.WarnLevel)
+	sender := &bigquerySender{Config: cfg, schemaManager: newFakeSchemaManager(nil), logger: zap.New(core)}
+
+	require.NoError(t, sender.start(context.Background(), nil))
+
+	assert.Zero(t, logs.Len(), "Flexible schemas get missing columns on first insert")
+}
+
+func TestSendRowsRetriesOnlyFailedRows(t *testing.T) {
+	rowErrs := bigquery.PutMultiError{
+		{RowIndex: 0, Errors: bigquery.MultiError{&bigquery.Error{Reason: "stopped"}}},
+		{RowIndex: 1, Errors: bigquery.MultiError{&bigquery.Error{Reason: "invalid", Message: "Cannot convert value to integer."}}},
+		{RowIndex: 2, Errors: bigquery.MultiError{&bigquery.Error{Reason: "stopped"}}},
+	}
+	inserter := &fakeInserter{errs: []error{rowErrs}}
+	core, logs := observer.New(zap.WarnLevel)
+	sender := &bigquerySender{Config: createTestConfig(), inserter: inserter, logger: zap.New(core)}
+	rows := []bigqueryrow{{"name": "span1"}, {"name": "span2"}, {"name": "span3"}}
+
+	err := sender.sendRows(context.Background(), rows)
+
+	require.NoError(t, err, "Valid rows should be inserted on retry")
+	assert.Equal(t, []int{3, 2}, inserter.putSizes, "Only the stopped rows should be retried")
+	dropped := logs.FilterMessage("Dropping rows rejected by BigQuery").All()
+	require.Len(t, dropped, 1, "Dropped rows should be logged")
+	assert.Equal(t, []interface{}{1}, dropped[0].ContextMap()["row_indices"])
+}
+
+func TestSendRowsLogsRejectedTraceIDs(t *testing.T) {
+	rowErrs := bigquery.PutMultiError{
+		{RowIndex: 0, Errors: bigquery.MultiError{&bigquery.Error{Reason: "stopped"}}},
+		{RowIndex: 1, Errors: bigquery.MultiError{&bigquery.Error{Reason: "invalid", Message: "Cannot convert value to integer."}}},
+		{RowIndex: 2, Errors: bigquery.MultiError{&bigquery.Error{Reason: "invalid", Message: "Cannot convert value to boolean."}}},
+	}
+	inserter := &fakeInserter{errs: []error{rowErrs}}
+	core, logs := observer.New(zap.WarnLevel)
+	sender := &bigquerySender{Config: createTestConfig(), inserter: inserter, logger: zap.New(core)}
+	rows := []bigqueryrow{
+		{"name": "span1", "trace_id": "trace1", "span_id": "span1"},
+		{"name": "span2", "trace_id": "trace2", "span_id": "span2"},
+		{"name": "span3", "trace_id": "trace3", "span_id": "span3"},
+	}
+
+	require.NoError(t, sender.sendRows(context.Background(), rows))
+
+	rejected := logs.FilterMessage("Row rejected by BigQuery").All()
+	require.Len(t, rejected, 2, "Only the offending rows should be logged")
+	for i, entry := range rejected {
+		fields := entry.ContextMap()
+		assert.Equal(t, int64(i+1), fields["row_index"])
+		assert.Equal(t, fmt.Sprintf("trace%d", i+2), fields["trace_id"])
+		assert.Equal(t, fmt.Sprintf("span%d", i+2), fields["span_id"])
+		assert.Contains(t, fields["error"], "Cannot convert value")
+	}
+}
+
+func TestSendRowsLimitsRejectedRowLogs(t *testing.T) {
+	var rowErrs bigquery.PutMultiError
+	rows := make([]bigqueryrow, maxLoggedRowErrors+5)
+	for i := range rows {
+		rows[i] = bigqueryrow{"name": fmt.Sprintf("span%d", i)}
+		rowErrs = append(rowErrs, bigquery.RowInsertionError{
+			RowIndex: i,
+			Errors:   bigquery.MultiError{&bigquery.Error{Reason: "invalid", Message: "Cannot convert value to integer."}},
+		})
+	}
+	inserter := &fakeInserter{errs: []error{rowErrs}}
+	core, logs := observer.New(zap.WarnLevel)
+	sender := &bigquerySender{Config: createTestConfig(), inserter: inserter, logger: zap.New(core)}
+
+	require.NoError(t, sender.sendRows(context.Background(), rows))
+
+	assert.Equal(t, maxLoggedRowErrors, logs.FilterMessage("Row rejected by BigQuery").Len())
+	more := logs.FilterMessage("More rows rejected by BigQuery than logged").All()
+	require.Len(t, more, 1)
+	assert.Equal(t, int64(5), more[0].ContextMap()["rows"])
+}
+
+func TestSendRowsDropsAllInvalidRows(t *testing.T) {
+	rowErrs := bigquery.PutMultiError{
+		{RowIndex: 0, Errors: bigquery.MultiError{&bigquery.Error{Reason: "invalid", Message: "Cannot convert value to integer."}}},
+	}
+	inserter := &fakeInserter{errs: []error{rowErrs}}
+	sender := &bigquerySender{Config: createTestConfig(), inserter: inserter, logger: zap.NewNop()}
+	rows := []bigqueryrow{{"name": "span1"}}
+
+	require.NoError(t, sender.sendRows(context.Background(), rows), "Invalid rows should not block the batch")
+	assert.Equal(t, []int{1}, inserter.putSizes, "Nothing should be left to retry")
+}
+
+func TestSendRowsRetriesSchemaMismatchRowsOnly(t *testing.T) {
+	rowErrs := bigquery.PutMultiError{
+		{RowIndex: 0, Errors: bigquery.MultiError{&bigquery.Error{Reason: "stopped"}}},
+		{RowIndex: 1, Errors: bigquery.MultiError{&bigquery.Error{Reason: "invalid", Message: "no such field: new_key."}}},
+		{RowIndex: 2, Errors: bigquery.MultiError{&bigquery.Error{Reason: "invalid", Message: "Cannot convert value to integer."}}},
+	}
+	inserter := &fakeInserter{errs: []error{rowErrs}}
+	table := newFakeSchemaManager(bigquery.Schema{{Name: "name", Type: bigquery.StringFieldType}})
+	cfg := createTestConfig()
+	cfg.SchemaFlexible = true
+	cfg.SchemaUpdateSettleDelay = time.Millisecond
+	sender := &bigquerySender{Config: cfg, inserter: inserter, schemaManager: table, logger: zap.NewNop()}
+	rows := []bigqueryrow{{"name": "span1"}, {"name": "span2", "new_key": "value"}, {"name": "span3"}}
+
+	require.NoError(t, sender.sendRows(context.Background(), rows))
+
+	assert.Equal(t, []int{3, 2}, inserter.putSizes, "The invalid row should be dropped from the retry")
+	assert.Equal(t, bigquery.StringFieldType, fieldType(table.meta.Schema, "new_key"))
+}
+
+// Helper function to create the error returned for a row with a field
+// missing from the table schema
+func noSuchFieldError(key string) error {
+	return bigquery.PutMultiError{
+		bigquery.RowInsertionError{
+			RowIndex: 0,
+			Errors: bigquery.MultiError{
+				&bigquery.Error{Reason: "invalid", Message: "no such field: " + key + "."},
+			},
+		},
+	}
+}
+
+// Fake inserter that records the number of rows per Put call and returns
+// the queued errors in order
+type fakeInserter struct {
+	putSizes []int
+	rows     []bigquery.ValueSaver
+	errs     []error
+	onPut    func()
+}
+
+func (f *fakeInserter) Put(ctx context.Context, src interface{}) error {
+	f.putSizes = append(f.putSizes, len(src.([]bigquery.ValueSaver)))
+	f.rows = append(f.rows, src.([]bigquery.ValueSaver)...)
+	if f.onPut != nil {
+		f.onPut()
+	}
+	if len(f.errs) == 0 {
+		return nil
+	}
+	err := f.errs[0]
+	f.errs = f.errs[1:]
+	return err
+}
+
+// Fake inserter that tracks the most concurrent Put calls, failing rows by
+// name
+type concurrencyInserter struct {
+	fail        map[string]bool
+	inFlight    atomic.Int32
+	maxInFlight atomic.Int32
+	puts        atomic.Int32
+}
+
+func (c *concurrencyInserter) Put(ctx context.Context, src interface{}) error {
+	c.puts.Add(1)
+	n := c.inFlight.Add(1)
+	defer c.inFlight.Add(-1)
+	for {
+		highest := c.maxInFlight.Load()
+		if n <= highest || c.maxInFlight.CompareAndSwap(highest, n) {
+			break
+		}
+	}
+	time.Sleep(20 * time.Millisecond)
+
+	for _, saver := range src.([]bigquery.ValueSaver) {
+		row, _, _ := saver.Save()
+		if name, _ := row["name"].(string); c.fail[name] {
+			return fmt.Errorf("%s failed", name)
+		}
+	}
+	return nil
+}
+
+// Fake inserter that cancels the export on its first Put
+type cancellingInserter struct {
+	cancel context.CancelFunc
+	puts   int
+}
+
+func (c *cancellingInserter) Put(ctx context.Context, src interface{}) error {
+	c.puts++
+	c.cancel()
+	return nil
+}
+
+// Fake inserter whose Put calls block until release is closed
+type blockingInserter struct {
+	fakeInserter
+	started chan struct{}
+	release chan struct{}
+}
+
+func newBlockingInserter() *blockingInserter {
+	return &blockingInserter{started: make(chan struct{}, 1), release: make(chan struct{})}
+}
+
+func (b *blockingInserter) Put(ctx context.Context, src interface{}) error {
+	b.started <- struct{}{}
+	<-b.release
+	return b.fakeInserter.Put(ctx, src)
+}
+
+// Fake table schema that counts Metadata and Update calls
+type fakeSchemaManager struct {
+	meta          *bigquery.TableMetadata
+	metadataCalls int
+	updateCalls   int
+	createCalls   int
+	metadataErr   error
+	updateErr     error
+	updateErrs    []error
+	onUpdate      func()
+}
+
+func (f *fakeSchemaManager) Create(ctx context.Context, tm *bigquery.TableMetadata) error {
+	f.createCalls++
+	f.metadataErr = nil
+	meta := *tm
+	meta.ETag = "etag0"
+	f.meta = &meta
+	return nil
+}
+
+func newFakeSchemaManager(schema bigquery.Schema) *fakeSchemaManager {
+	return &fakeSchemaManager{
+		meta: &bigquery.TableMetadata{Schema: schema, ETag: "etag0"},
+	}
+}
+
+func (f *fakeSchemaManager) Metadata(ctx context.Context, opts ...bigquery.TableMetadataOption) (*bigquery.TableMetadata, error) {
+	f.metadataCalls++
+	if f.metadataErr != nil {
+		return nil, f.metadataErr
+	}
+	meta := *f.meta
+	return &meta, nil
+}
+
+func (f *fakeSchemaManager) Update(ctx context.Context, tm bigquery.TableMetadataToUpdate, etag string, opts ...bigquery.TableUpdateOption) (*bigquery.TableMetadata, error) {
+	f.updateCalls++
+	if f.onUpdate != nil {
+		f.onUpdate()
+	}
+	if f.updateErr != nil {
+		return nil, f.updateErr
+	}
+	if len(f.updateErrs) > 0 {
+		err := f.updateErrs[0]
+		f.updateErrs = f.updateErrs[1:]
+		return nil, err
+	}
+	f.meta = &bigquery.TableMetadata{
+		Schema: tm.Schema,
+		ETag:   fmt.Sprintf("etag%d", f.updateCalls),
+	}
+	meta := *f.meta
+	return &meta, nil
+}
+
+// Helper function to look up a field's type by name
+func fieldType(schema bigquery.Schema, name string) bigquery.FieldType {
+	for _, field := range schema {
+		if field.Name == name {
+			return field.Type
+		}
+	}
+	return ""
+}
@@ -2,22 +2,489 @@ package bigquery
 
 import (
 	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"cloud.google.com/go/bigquery"
+	"go.opentelemetry.io/collector/component"
+	"go.opentelemetry.io/collector/config/configretry"
+	"go.opentelemetry.io/collector/exporter/exporterhelper"
+)
+
+// EmptyAttributeValues options.
+const (
+	emptyAttributeValuesSkip = "skip"
+	emptyAttributeValuesNull = "null"
+)
+
+// TypeConflictStrategy options.
+const (
+	typeConflictCoerce = "coerce"
+	typeConflictSuffix = "suffix"
+	typeConflictDrop   = "drop"
+)
+
+// ColumnNameStyle options.
+const (
+	columnNameStyleSnake        = "snake"
+	columnNameStylePreserveDots = "preserve_dots"
+	columnNameStyleCamel        = "camel"
 )
 
 type Config struct {
+	// Project for the BigQuery client. Defaults to the GOOGLE_CLOUD_PROJECT
+	// environment variable, then the project from the GCE metadata server.
 	ProjectID string `mapstructure:"projectID"`
 	Dataset   string `mapstructure:"dataset"`
 	Table     string `mapstructure:"table"`
 
-	SchemaFlexible bool
+	// Project that Dataset belongs to, if not ProjectID. Requests are still
+	// billed to ProjectID.
+	DatasetProjectID string `mapstructure:"datasetProjectID"`
+
+	// Location of Dataset, e.g. US, EU or us-east4, that the client's jobs
+	// run in and that a dataset created by the exporter is created in.
+	// Defaults to BigQuery's inference from the dataset, or US for new
+	// datasets.
+	Location string `mapstructure:"location"`
+
+	// BigQuery REST API endpoint, e.g. the emulator's. Defaults to the
+	// BIGQUERY_EMULATOR_HOST environment variable if set, otherwise the
+	// production endpoint. Doesn't apply to gRPC; see UseGRPC.
+	Endpoint string `mapstructure:"endpoint"`
+
+	// Service account key file to authenticate with. Defaults to Application
+	// Default Credentials. At most one of CredentialsFile and CredentialsJSON
+	// may be set.
+	CredentialsFile string `mapstructure:"credentialsFile"`
+
+	// Service account key JSON to authenticate with, e.g. from a secret.
+	CredentialsJSON string `mapstructure:"credentialsJSON"`
+
+	// Client auth extension, e.g. googleclientauth, that authenticates
+	// requests, so credentials configured for other components needn't be
+	// repeated, by component ID. The extension must implement
+	// extensionauth.HTTPClient. Can't be combined with the other credentials
+	// options, or with UseStorageWriteAPI or UseGRPC, as the Storage Write
+	// API client doesn't use HTTP. Unset (default) uses those options, or
+	// Application Default Credentials.
+	Auth component.ID `mapstructure:"auth"`
+
+	// Service account to impersonate, so the collector's own identity (from
+	// Application Default Credentials) needs only permission to mint its
+	// tokens. Can't be combined with CredentialsFile or CredentialsJSON.
+	ImpersonateServiceAccount string `mapstructure:"impersonateServiceAccount"`
+
+	// Service accounts in the delegation chain to ImpersonateServiceAccount,
+	// each impersonating the next. Optional.
+	ImpersonateDelegates []string `mapstructure:"impersonateDelegates"`
+
+	// Span or resource attribute whose value selects the table spans are
+	// sent to, e.g. a tenant ID. Span attributes take precedence. The
+	// attribute must be exported, i.e. not excluded by the attribute filters.
+	RouteByAttribute string `mapstructure:"routeByAttribute"`
+
+	// Tables by RouteByAttribute value. Spans without the attribute, or with
+	// an unmapped value, are sent to Table.
+	RouteTableMapping map[string]string `mapstructure:"routeTableMapping"`
+
+	// Table for log records. Defaults to Table.
+	LogsTable string `mapstructure:"logsTable"`
+
+	// Table for metric data points. Defaults to Table.
+	MetricsTable string `mapstructure:"metricsTable"`
+
+	// Table that resources are normalized into, e.g. resources: each
+	// resource's attributes are written there once per batch, keyed by a
+	// hash of the attributes in the resource_id column, and rows carry the
+	// resource_id rather than the resource attributes. Resource rows are
+	// written again by later batches; see resource_table.go. Routing by a
+	// resource attribute isn't possible, as rows don't carry them. Empty
+	// (default) writes resource attributes to every row.
+	ResourceTable string `mapstructure:"resourceTable"`
+
+	SchemaFlexible bool `mapstructure:"schemaFlexible"`
+
+	// Create the dataset and table at startup if they don't exist. The table
+	// is created with a minimal schema, time partitioned on PartitionField.
+	CreateIfMissing bool `mapstructure:"createIfMissing"`
+
+	// With CreateIfMissing, create a missing table when the first batch
+	// arrives rather than at start, with columns for that batch's fields as
+	// well as the minimal schema, so fewer schema updates are needed. The
+	// first batch for each routed table creates that table. Default false.
+	AutodetectSchemaFromFirstBatch bool `mapstructure:"autodetectSchemaFromFirstBatch"`
+
+	// Insert a canary row into each table at start, failing the collector
+	// start with the insert error if it's rejected, e.g. for missing write
+	// permission. The row can't be deleted, so it's left in the table, named
+	// otelex.startup_probe if the table has a SpanNameColumn. Tables created
+	// from the first batch aren't probed. Default false.
+	RunStartupProbe bool `mapstructure:"runStartupProbe"`
+
+	// Column populated with the span name, e.g. span_name, so it can't be
+	// confused with an attribute named name. Defaults to name.
+	SpanNameColumn string `mapstructure:"spanNameColumn"`
+
+	// Column populated with the span start (or log, data point) timestamp,
+	// which tables created by the exporter are partitioned on. Defaults to ts.
+	PartitionField string `mapstructure:"partitionField"`
+
+	// Span attribute, e.g. log.time, that PartitionField is populated with
+	// instead of the span start time, for partitioning on event time: an
+	// int of nanoseconds since the Unix epoch, or an RFC 3339 string. Spans
+	// without the attribute, or with an unparseable value, are partitioned
+	// on their start time. Empty (default) always uses the start time.
+	PartitionTimestampAttribute string `mapstructure:"partitionTimestampAttribute"`
+
+	// Column populated with the time each row is sent to BigQuery, e.g.
+	// ingested_at, as a TIMESTAMP. Useful for monitoring freshness, as
+	// distinct from the span's own timestamp in PartitionField. Empty
+	// (default) disables it.
+	IngestTimestampColumn string `mapstructure:"ingestTimestampColumn"`
+
+	// Column populated with a key for each span, e.g. span_key, as a hex
+	// string: a hash of its trace ID, span ID and start time. Identical spans
+	// get identical keys, so duplicates, e.g. from retries, can be removed
+	// downstream, e.g. by scheduled MERGE jobs. Unlike the insertID sent with
+	// Deduplicate, it's stored in the table. Must not be one of the columns
+	// span rows are otherwise written with. Empty (default) disables it.
+	PrimaryKeyColumn string `mapstructure:"primaryKeyColumn"`
+
+	// Time partitioning granularity of tables created by the exporter: DAY
+	// (default), HOUR, MONTH or YEAR. Not supported with RangePartitioning.
+	PartitionType string `mapstructure:"partitionType"`
+
+	// Integer range partitioning of span, log and metric tables created by
+	// the exporter, instead of time partitioning on PartitionField. Not
+	// supported with PartitionType or PartitionExpiration.
+	RangePartitioning RangePartitioningConfig `mapstructure:"rangePartitioning"`
+
+	// How long partitions of tables created by the exporter are kept before
+	// BigQuery deletes them. Zero (default) keeps them indefinitely.
+	PartitionExpiration time.Duration `mapstructure:"partitionExpiration"`
+
+	// Go time layout, e.g. _20060102, for date-sharded tables: rows are
+	// inserted into Table (or the routed table) suffixed with their
+	// timestamp in this layout, in UTC, e.g. spattex_20240131. BigQuery
+	// creates missing shards with the table's schema. Schema updates apply to
+	// the table, and so to shards created after the update. Not supported
+	// with UseStorageWriteAPI or UseGRPC. Empty (default) disables sharding.
+	TableSuffixFormat string `mapstructure:"tableSuffixFormat"`
+
+	// Require queries of tables created by the exporter to filter on
+	// PartitionField, preventing accidental full table scans. Doesn't affect
+	// inserts.
+	RequirePartitionFilter bool `mapstructure:"requirePartitionFilter"`
+
+	// How long to wait after a schema update before retrying the insert.
+	// New fields take a while to register with BigQuery. Zero (default)
+	// returns the insert error instead, leaving the retry queue to retry
+	// later, which is preferable: the wait blocks the export goroutine.
+	SchemaUpdateSettleDelay time.Duration `mapstructure:"schemaUpdateSettleDelay"`
+
+	// With a SchemaUpdateSettleDelay, how many times rows are retried after
+	// schema updates, if fields are still missing, before the insert error is
+	// returned to the retry queue. Each retry that fails for missing fields
+	// updates the schema again, with any fields found missing since. Default
+	// 3.
+	MaxSchemaUpdateRetries int `mapstructure:"maxSchemaUpdateRetries"`
+
+	// Most columns a flexible schema grows to, e.g. to stay under BigQuery's
+	// 10,000 column limit, past which every insert fails. Fields that would
+	// exceed it aren't added, and the rows with them are dead-lettered.
+	// Nested RECORD fields aren't counted. Zero (default) is unbounded.
+	MaxColumns int `mapstructure:"maxColumns"`
+
+	// Attribute keys (before column name sanitization) to export. When set,
+	// other attributes are dropped. Useful to keep high-cardinality or
+	// sensitive attributes out of the table.
+	IncludeAttributes []string `mapstructure:"includeAttributes"`
+
+	// Attribute keys (before column name sanitization) to drop. Takes
+	// precedence over IncludeAttributes.
+	ExcludeAttributes []string `mapstructure:"excludeAttributes"`
+
+	// Prefix for the columns of attributes, e.g. attr_, so that attributes
+	// can't collide with the columns derived from span (or log, data point)
+	// fields, e.g. name, trace_id and the partition field. Letters, digits
+	// and underscores, not starting with a digit. Empty (default) leaves
+	// attribute columns unprefixed.
+	AttributeColumnPrefix string `mapstructure:"attributeColumnPrefix"`
+
+	// Prefixes for the columns of resource, scope and span (or log record,
+	// data point) attributes, e.g. resource_, scope_ and span_, so each
+	// column's level can be told from its name. They follow
+	// AttributeColumnPrefix, e.g. attr_span_http_method. Empty (default)
+	// prefixes leave columns as they are; see ColumnNamespacingConfig.
+	ColumnNamespacing ColumnNamespacingConfig `mapstructure:"columnNamespacing"`
+
+	// How attribute keys become column names: "snake" (default) replaces
+	// dots, and other characters BigQuery doesn't allow, with underscores,
+	// e.g. service_name; "preserve_dots" escapes each dot as a double
+	// underscore, e.g. service__name, since BigQuery doesn't allow dots in
+	// column names even when quoted, so dotted keys can be told apart from
+	// keys with underscores; "camel" joins the key's parts in camel case,
+	// e.g. serviceName. The prefix, if any, is part of the key.
+	ColumnNameStyle string `mapstructure:"columnNameStyle"`
+
+	// Longest JSON, in bytes, that a map or non-repeated slice attribute is
+	// exported as. Longer values, e.g. deeply nested maps, are dropped, with
+	// the rest of the row exported, rather than push the row past BigQuery's
+	// 10 MB row size limit. Defaults to 1 MiB; zero is unbounded.
+	MaxAttributeJSONBytes int `mapstructure:"maxAttributeJSONBytes"`
+
+	// Columns every span (or log, data point) row is written with, as NULL
+	// if the row has no value for them, e.g. http_method, so rows have a
+	// consistent column set across spans with different attributes. Names
+	// are columns, after sanitization and any prefix, rather than attribute
+	// keys. A flexible schema adds missing ones as STRING.
+	StableColumnSet []string `mapstructure:"stableColumnSet"`
+
+	// Write well-known resource attributes, e.g. service.name and host.name,
+	// to fixed columns, e.g. service_name and host_name, that don't depend on
+	// AttributeColumnPrefix or on how other keys are sanitized. See
+	// standardResourceColumns for the keys. Default false.
+	StandardResourceColumns bool `mapstructure:"standardResourceColumns"`
+
+	// How to export attributes with an empty value: "skip" (default) leaves
+	// the column out of the row; "null" writes NULL, adding the column (as
+	// STRING) to a flexible schema if it's missing.
+	EmptyAttributeValues string `mapstructure:"emptyAttributeValues"`
+
+	// How to export a value whose type differs from its column's, e.g. an int
+	// for an attribute first seen as a string: "coerce" (default) converts
+	// the value to the column type where that's safe, dead-lettering the row
+	// otherwise; "suffix" writes the value to a column suffixed with its
+	// type, e.g. value_int; "drop" leaves the value out of the row.
+	TypeConflictStrategy string `mapstructure:"typeConflictStrategy"`
+
+	// Labels, e.g. team: observability, set on the datasets and tables the
+	// exporter creates, so their storage can be broken down by label in
+	// billing. Existing datasets and tables are left as they are. Inserts
+	// aren't labeled: streaming inserts and the Storage Write API have no
+	// labels. Keys and values follow GCP's label constraints.
+	Labels map[string]string `mapstructure:"labels"`
+
+	// Export only spans with an error status, dropping the rest, to cut
+	// volume where only failures are analyzed.
+	OnlyExportErrors bool `mapstructure:"onlyExportErrors"`
+
+	// Export only spans with the sampled bit set in their trace flags,
+	// dropping spans the SDK recorded without sampling them.
+	RequireSampledFlag bool `mapstructure:"requireSampledFlag"`
+
+	// Fraction of spans to export, above 0 and at most 1 (default, exporting
+	// every span). Spans are kept or dropped by a hash of their IDs, so the
+	// decision for a span is the same across collectors and retries.
+	SampleRatio float64 `mapstructure:"sampleRatio"`
+
+	// Sample by trace ID alone, so a trace's spans are kept or dropped
+	// together, as long as they're exported with the same SampleRatio.
+	SampleByTraceID bool `mapstructure:"sampleByTraceID"`
+
+	// Export resource attributes as fields of a resource RECORD column
+	// rather than alongside the span (or log, data point) attributes. Value
+	// types within the record must match its fields' types: type conflicts
+	// are only resolved for top-level columns.
+	NestResource bool `mapstructure:"nestResource"`
+
+	// Export span events as a JSON array in an events column. Disable to
+	// save storage.
+	IncludeEvents bool `mapstructure:"includeEvents"`
+
+	// Export the earliest and latest span event timestamps as
+	// first_event_time and last_event_time TIMESTAMP columns, for filtering
+	// on event times without parsing the events column. They're NULL for
+	// spans without events.
+	EmitEventTimeBounds bool `mapstructure:"emitEventTimeBounds"`
+
+	// Export span links as a JSON array in a links column, for analysis of
+	// relationships across traces.
+	IncludeLinks bool `mapstructure:"includeLinks"`
+
+	// Export each span, with its resource and scope, as OTLP JSON in a
+	// raw_span column, alongside the flattened columns. A lossless record as
+	// the schema evolves, at the cost of storage.
+	IncludeRawSpan bool `mapstructure:"includeRawSpan"`
+
+	// Append rows with the Storage Write API instead of legacy streaming
+	// inserts. Cheaper, with higher throughput, but schema updates take
+	// longer to apply; see storage_write.go.
+	UseStorageWriteAPI bool `mapstructure:"useStorageWriteAPI"`
+
+	// Send rows over gRPC rather than REST, e.g. where a proxy handles one
+	// better than the other. The client library only supports gRPC for the
+	// Storage Write API, so this implies UseStorageWriteAPI, with its
+	// limitations. Table and schema operations still use REST. The gRPC
+	// client always connects to the production endpoint.
+	UseGRPC bool `mapstructure:"useGRPC"`
+
+	// Build and insert span rows in chunks rather than assembling the full
+	// batch up front. Reduces peak memory for very large batches.
+	StreamingRowBuild bool `mapstructure:"streamingRowBuild"`
+
+	// Coalesce the rows of small exports before inserting them, for
+	// pipelines without a batch processor; see internal_batch.go. Not
+	// supported with StreamingRowBuild. Disabled by default.
+	InternalBatch InternalBatchConfig `mapstructure:"internalBatch"`
+
+	// Insert the valid rows of a request even if others are invalid, rather
+	// than failing the whole request. Invalid rows are still logged and
+	// dead-lettered, but the rest aren't delayed by retrying them. Not
+	// supported with UseStorageWriteAPI or UseGRPC.
+	SkipInvalidRows bool `mapstructure:"skipInvalidRows"`
+
+	// Insert rows with fields missing from the table schema, dropping those
+	// fields, rather than rejecting the rows. Trades the fields' values for
+	// throughput. Can't be combined with SchemaFlexible, which adds the
+	// fields instead. Not supported with UseStorageWriteAPI or UseGRPC.
+	IgnoreUnknownValues bool `mapstructure:"ignoreUnknownValues"`
+
+	// Rows per insert request, at most 50,000. BigQuery recommends 500.
+	// Requests are also kept under the 10 MB request size limit.
+	MaxRowsPerRequest int `mapstructure:"maxRowsPerRequest"`
+
+	// Sub-batches (of MaxRowsPerRequest rows) of an export inserted, or with
+	// UseStorageWriteAPI appended, at once. Defaults to 1, inserting them in
+	// turn.
+	MaxConcurrentInserts int `mapstructure:"maxConcurrentInserts"`
+
+	// Insert requests per second, across tables, to stay under BigQuery's
+	// request rate quota if upstream batching is misconfigured. Zero
+	// (default) disables rate limiting.
+	MaxRequestsPerSecond float64 `mapstructure:"maxRequestsPerSecond"`
+
+	// Send an insertID derived from each span's trace and span IDs, or each
+	// log record's trace and span IDs, timestamp and body, so BigQuery can
+	// drop duplicate rows inserted on retry. Metric data points and resource
+	// rows have no IDs, so get none.
+	Deduplicate bool `mapstructure:"deduplicate"`
+
+	// Table that rows which can never be inserted are written to, as JSON
+	// with the reason they were rejected; see dead_letter.go for its schema.
+	// When unset, such rows are logged and dropped.
+	DeadLetterTable string `mapstructure:"deadLetterTable"`
+
+	// GCS bucket that rows failing to insert with a permanent error, e.g.
+	// access denied, are written to as newline-delimited JSON, for loading
+	// later; see gcs_fallback.go. Empty (default) drops them.
+	GCSFallbackBucket string `mapstructure:"gcsFallbackBucket"`
+
+	// Applied to each row before it's inserted. Not configurable: set by
+	// NewFactoryWithRowTransformer or WithRowTransformer.
+	RowTransformer RowTransformer `mapstructure:"-"`
+
+	// How long shutdown waits for exports in progress to finish, after the
+	// sending queue is drained, before giving up on them.
+	ShutdownTimeout time.Duration `mapstructure:"shutdownTimeout"`
+
+	// Queue settings, e.g. sending_queue.queue_size, may be tuned at deploy.
+	QueueBatchConfig exporterhelper.QueueBatchConfig `mapstructure:"sending_queue"`
+
+	// Retry settings, e.g. retry_on_failure.initial_interval, may be tuned at deploy.
+	BackOffConfig configretry.BackOffConfig `mapstructure:"retry_on_failure"`
+
+	// Per-request timeout, i.e. timeout, may be tuned at deploy.
+	exporterhelper.TimeoutConfig `mapstructure:",squash"`
 }
 
-// The BigQuery API requires these fields. Export will fail otherwise.
-func (cfg *Config) Validate() error {
-	if cfg.ProjectID == "" {
-		return errors.New("projectID required for BigQuery API")
+// Integer range partitioning: a partition for each Interval of Field values
+// from Start (inclusive) to End (exclusive), with values outside the range in
+// an __UNPARTITIONED__ partition. Field, e.g. tenant_id, is created as an
+// INTEGER column; rows get their values from attributes with that name. Empty
+// Field (default) disables it.
+type RangePartitioningConfig struct {
+	Field    string `mapstructure:"field"`
+	Start    int64  `mapstructure:"start"`
+	End      int64  `mapstructure:"end"`
+	Interval int64  `mapstructure:"interval"`
+}
+
+// Per-level attribute column prefixes. Scope attributes are only written
+// with a Scope prefix, so rows without namespacing keep their columns.
+// StandardResourceColumns are fixed, so aren't prefixed.
+type ColumnNamespacingConfig struct {
+	Resource string `mapstructure:"resource"`
+	Scope    string `mapstructure:"scope"`
+	Span     string `mapstructure:"span"`
+}
+
+// Sets a Config option, for NewConfig.
+type Option func(*Config)
+
+// A Config for exporters built into collector distributions
+// programmatically: the defaults, for the given project, dataset and table,
+// with opts applied, and validated. An empty projectID is resolved when the
+// exporter is created, as from collector config.
+func NewConfig(projectID, dataset, table string, opts ...Option) (*Config, error) {
+	cfg := createDefaultConfig().(*Config)
+	cfg.ProjectID = projectID
+	cfg.Dataset = dataset
+	cfg.Table = table
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
 	}
+	return cfg, nil
+}
+
+func WithSchemaFlexible() Option {
+	return func(cfg *Config) { cfg.SchemaFlexible = true }
+}
+
+func WithCreateIfMissing() Option {
+	return func(cfg *Config) { cfg.CreateIfMissing = true }
+}
+
+func WithCredentialsFile(path string) Option {
+	return func(cfg *Config) { cfg.CredentialsFile = path }
+}
 
+func WithCredentialsJSON(json string) Option {
+	return func(cfg *Config) { cfg.CredentialsJSON = json }
+}
+
+func WithDatasetProjectID(projectID string) Option {
+	return func(cfg *Config) { cfg.DatasetProjectID = projectID }
+}
+
+func WithEndpoint(endpoint string) Option {
+	return func(cfg *Config) { cfg.Endpoint = endpoint }
+}
+
+func WithLogsTable(table string) Option {
+	return func(cfg *Config) { cfg.LogsTable = table }
+}
+
+func WithMetricsTable(table string) Option {
+	return func(cfg *Config) { cfg.MetricsTable = table }
+}
+
+func WithDeadLetterTable(table string) Option {
+	return func(cfg *Config) { cfg.DeadLetterTable = table }
+}
+
+func WithPartitionField(field string) Option {
+	return func(cfg *Config) { cfg.PartitionField = field }
+}
+
+func WithUseStorageWriteAPI() Option {
+	return func(cfg *Config) { cfg.UseStorageWriteAPI = true }
+}
+
+func WithRowTransformer(transformer RowTransformer) Option {
+	return func(cfg *Config) { cfg.RowTransformer = transformer }
+}
+
+// The BigQuery API requires these fields. Export will fail otherwise. An
+// empty projectID is resolved when the exporter is created.
+func (cfg *Config) Validate() error {
 	if cfg.Dataset == "" {
 		return errors.New("dataset required for BigQuery API")
 	}
@@ -25,5 +492,473 @@ func (cfg *Config) Validate() error {
 	if cfg.Table == "" {
 		return errors.New("table required for BigQuery API")
 	}
+
+	if err := validateDatasetName(cfg.Dataset); err != nil {
+		return fmt.Errorf("dataset: %w", err)
+	}
+
+	if cfg.Location != "" {
+		if err := validateLocation(cfg.Location); err != nil {
+			return fmt.Errorf("location: %w", err)
+		}
+	}
+
+	tables := map[string]string{
+		"table":           cfg.Table,
+		"logsTable":       cfg.LogsTable,
+		"metricsTable":    cfg.MetricsTable,
+		"deadLetterTable": cfg.DeadLetterTable,
+		"resourceTable":   cfg.ResourceTable,
+	}
+	for value, table := range cfg.RouteTableMapping {
+		tables[fmt.Sprintf("routeTableMapping[%q]", value)] = table
+	}
+	for key, table := range tables {
+		if table == "" {
+			continue
+		}
+		if err := validateTableName(table); err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+	}
+
+	if cfg.AutodetectSchemaFromFirstBatch && !cfg.CreateIfMissing {
+		return errors.New("autodetectSchemaFromFirstBatch requires createIfMissing")
+	}
+
+	if cfg.CredentialsFile != "" && cfg.CredentialsJSON != "" {
+		return errors.New("only one of credentialsFile and credentialsJSON may be set")
+	}
+
+	if cfg.hasAuth() {
+		if cfg.CredentialsFile != "" || cfg.CredentialsJSON != "" || cfg.ImpersonateServiceAccount != "" {
+			return errors.New("auth can't be combined with credentialsFile, credentialsJSON or impersonateServiceAccount")
+		}
+		if cfg.useStorageWriteAPI() {
+			return errors.New("auth isn't supported with useStorageWriteAPI or useGRPC")
+		}
+	}
+
+	if cfg.ImpersonateServiceAccount != "" && (cfg.CredentialsFile != "" || cfg.CredentialsJSON != "") {
+		return errors.New("impersonateServiceAccount can't be combined with credentialsFile or credentialsJSON")
+	}
+
+	if len(cfg.ImpersonateDelegates) > 0 && cfg.ImpersonateServiceAccount == "" {
+		return errors.New("impersonateDelegates requires impersonateServiceAccount")
+	}
+
+	if len(cfg.RouteTableMapping) > 0 && cfg.RouteByAttribute == "" {
+		return errors.New("routeTableMapping requires routeByAttribute")
+	}
+
+	for value, table := range cfg.RouteTableMapping {
+		if table == "" {
+			return fmt.Errorf("routeTableMapping: no table for %q", value)
+		}
+	}
+
+	if cfg.DeadLetterTable != "" && cfg.DeadLetterTable == cfg.Table {
+		return errors.New("deadLetterTable must differ from table")
+	}
+
+	if cfg.GCSFallbackBucket != "" {
+		if err := validateBucketName(cfg.GCSFallbackBucket); err != nil {
+			return fmt.Errorf("gcsFallbackBucket: %w", err)
+		}
+	}
+
+	if cfg.ResourceTable != "" && (cfg.ResourceTable == cfg.Table || cfg.ResourceTable == cfg.LogsTable || cfg.ResourceTable == cfg.MetricsTable) {
+		return errors.New("resourceTable must differ from table, logsTable and metricsTable")
+	}
+
+	if err := validateLabels(cfg.Labels); err != nil {
+		return fmt.Errorf("labels: %w", err)
+	}
+
+	if !isValidColumnName(cfg.spanNameColumn()) {
+		return fmt.Errorf("spanNameColumn %q must contain only letters, digits and underscores, and not start with a digit", cfg.SpanNameColumn)
+	}
+
+	if column := cfg.spanNameColumn(); column == cfg.partitionField() || column == cfg.IngestTimestampColumn || column == cfg.PrimaryKeyColumn {
+		return errors.New("spanNameColumn must differ from partitionField, ingestTimestampColumn and primaryKeyColumn")
+	}
+
+	if cfg.IngestTimestampColumn != "" && cfg.IngestTimestampColumn == cfg.partitionField() {
+		return errors.New("ingestTimestampColumn must differ from partitionField")
+	}
+
+	if cfg.PrimaryKeyColumn != "" {
+		if !isValidColumnName(cfg.PrimaryKeyColumn) {
+			return fmt.Errorf("primaryKeyColumn %q must contain only letters, digits and underscores, and not start with a digit", cfg.PrimaryKeyColumn)
+		}
+		if cfg.PrimaryKeyColumn == cfg.partitionField() || cfg.PrimaryKeyColumn == cfg.IngestTimestampColumn {
+			return errors.New("primaryKeyColumn must differ from partitionField and ingestTimestampColumn")
+		}
+	}
+
+	if cfg.AttributeColumnPrefix != "" {
+		if err := validateColumnPrefix(cfg.AttributeColumnPrefix); err != nil {
+			return fmt.Errorf("attributeColumnPrefix: %w", err)
+		}
+	}
+
+	for level, prefix := range map[string]string{
+		"resource": cfg.ColumnNamespacing.Resource,
+		"scope":    cfg.ColumnNamespacing.Scope,
+		"span":     cfg.ColumnNamespacing.Span,
+	} {
+		if prefix == "" {
+			continue
+		}
+		if err := validateColumnPrefix(prefix); err != nil {
+			return fmt.Errorf("columnNamespacing.%s: %w", level, err)
+		}
+	}
+
+	for _, column := range cfg.StableColumnSet {
+		if !isValidColumnName(column) {
+			return fmt.Errorf("stableColumnSet: %q must be a column name, containing only letters, digits and underscores, and not starting with a digit", column)
+		}
+	}
+
+	switch cfg.EmptyAttributeValues {
+	case "", emptyAttributeValuesSkip, emptyAttributeValuesNull:
+	default:
+		return fmt.Errorf("emptyAttributeValues %q must be skip or null", cfg.EmptyAttributeValues)
+	}
+
+	switch cfg.TypeConflictStrategy {
+	case "", typeConflictCoerce, typeConflictSuffix, typeConflictDrop:
+	default:
+		return fmt.Errorf("typeConflictStrategy %q must be coerce, suffix or drop", cfg.TypeConflictStrategy)
+	}
+
+	switch cfg.ColumnNameStyle {
+	case "", columnNameStyleSnake, columnNameStylePreserveDots, columnNameStyleCamel:
+	default:
+		return fmt.Errorf("columnNameStyle %q must be snake, preserve_dots or camel", cfg.ColumnNameStyle)
+	}
+
+	if (cfg.SkipInvalidRows || cfg.IgnoreUnknownValues) && cfg.useStorageWriteAPI() {
+		return errors.New("skipInvalidRows and ignoreUnknownValues aren't supported with useStorageWriteAPI or useGRPC")
+	}
+
+	if cfg.IgnoreUnknownValues && cfg.SchemaFlexible {
+		return errors.New("ignoreUnknownValues can't be combined with schemaFlexible")
+	}
+
+	if cfg.MaxRowsPerRequest < 1 || cfg.MaxRowsPerRequest > 50000 {
+		return errors.New("maxRowsPerRequest must be between 1 and 50000")
+	}
+
+	if cfg.SampleRatio <= 0 || cfg.SampleRatio > 1 {
+		return errors.New("sampleRatio must be above 0 and at most 1")
+	}
+
+	if cfg.InternalBatch.MaxRows < 0 || cfg.InternalBatch.FlushInterval < 0 {
+		return errors.New("internalBatch.maxRows and internalBatch.flushInterval must be non-negative")
+	}
+
+	if (cfg.InternalBatch.MaxRows > 0) != (cfg.InternalBatch.FlushInterval > 0) {
+		return errors.New("internalBatch.maxRows and internalBatch.flushInterval must be set together")
+	}
+
+	if cfg.InternalBatch.MaxRows > 0 && cfg.StreamingRowBuild {
+		return errors.New("internalBatch isn't supported with streamingRowBuild")
+	}
+
+	if cfg.MaxConcurrentInserts < 1 {
+		return errors.New("maxConcurrentInserts must be at least 1")
+	}
+
+	switch bigquery.TimePartitioningType(cfg.PartitionType) {
+	case "", bigquery.DayPartitioningType, bigquery.HourPartitioningType,
+		bigquery.MonthPartitioningType, bigquery.YearPartitioningType:
+	default:
+		return fmt.Errorf("partitionType %q must be one of DAY, HOUR, MONTH, YEAR", cfg.PartitionType)
+	}
+
+	if err := cfg.validateRangePartitioning(); err != nil {
+		return err
+	}
+
+	if cfg.TableSuffixFormat != "" {
+		if cfg.useStorageWriteAPI() {
+			return errors.New("tableSuffixFormat isn't supported with useStorageWriteAPI or useGRPC")
+		}
+		if !isValidTableSuffix(time.Unix(0, 0).UTC().Format(cfg.TableSuffixFormat)) {
+			return fmt.Errorf("tableSuffixFormat %q must format timestamps as letters, digits and underscores", cfg.TableSuffixFormat)
+		}
+	}
+
+	if cfg.PartitionExpiration < 0 {
+		return errors.New("partitionExpiration must be non-negative")
+	}
+
+	if cfg.MaxRequestsPerSecond < 0 {
+		return errors.New("maxRequestsPerSecond must be non-negative")
+	}
+
+	if cfg.ShutdownTimeout <= 0 {
+		return errors.New("shutdownTimeout must be positive")
+	}
+
+	if cfg.SchemaUpdateSettleDelay < 0 {
+		return errors.New("schemaUpdateSettleDelay must be non-negative")
+	}
+
+	if cfg.MaxSchemaUpdateRetries < 0 {
+		return errors.New("maxSchemaUpdateRetries must be non-negative")
+	}
+
+	if cfg.MaxColumns < 0 {
+		return errors.New("maxColumns must be non-negative")
+	}
+
+	if cfg.MaxAttributeJSONBytes < 0 {
+		return errors.New("maxAttributeJSONBytes must be non-negative")
+	}
+
+	if err := cfg.QueueBatchConfig.Validate(); err != nil {
+		return fmt.Errorf("sending_queue: %w", err)
+	}
+
+	if err := cfg.BackOffConfig.Validate(); err != nil {
+		return fmt.Errorf("retry_on_failure: %w", err)
+	}
+
+	if err := cfg.TimeoutConfig.Validate(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// An auth extension is referenced.
+func (cfg *Config) hasAuth() bool {
+	return cfg.Auth != component.ID{}
+}
+
+// Rows are written with the Storage Write API, either as configured or
+// because it's the only way to write rows over gRPC.
+func (cfg *Config) useStorageWriteAPI() bool {
+	return cfg.UseStorageWriteAPI || cfg.UseGRPC
+}
+
+func (cfg *Config) logsTable() string {
+	if cfg.LogsTable != "" {
+		return cfg.LogsTable
+	}
+	return cfg.Table
+}
+
+func (cfg *Config) metricsTable() string {
+	if cfg.MetricsTable != "" {
+		return cfg.MetricsTable
+	}
+	return cfg.Table
+}
+
+func (cfg *Config) partitionField() string {
+	if cfg.PartitionField != "" {
+		return cfg.PartitionField
+	}
+	return defaultPartitionField
+}
+
+func (cfg *Config) spanNameColumn() string {
+	if cfg.SpanNameColumn != "" {
+		return cfg.SpanNameColumn
+	}
+	return defaultSpanNameColumn
+}
+
+func (cfg *Config) partitionType() bigquery.TimePartitioningType {
+	if cfg.PartitionType != "" {
+		return bigquery.TimePartitioningType(cfg.PartitionType)
+	}
+	return defaultPartitionType
+}
+
+func isValidTableSuffix(suffix string) bool {
+	for i := 0; i < len(suffix); i++ {
+		c := suffix[i]
+		if c != '_' && (c < 'a' || c > 'z') && (c < 'A' || c > 'Z') && (c < '0' || c > '9') {
+			return false
+		}
+	}
+	return suffix != ""
+}
+
+// BigQuery dataset and table names are limited to 1,024 characters (table
+// names to 1,024 UTF-8 bytes).
+const maxNameLength = 1024
+
+// Dataset names may contain letters, digits and underscores.
+func validateDatasetName(name string) error {
+	if len(name) > maxNameLength {
+		return fmt.Errorf("%q is longer than %d characters", name, maxNameLength)
+	}
+	for _, r := range name {
+		if r != '_' && (r < 'a' || r > 'z') && (r < 'A' || r > 'Z') && (r < '0' || r > '9') {
+			return fmt.Errorf("%q may only contain letters, digits and underscores", name)
+		}
+	}
+	return nil
+}
+
+// Table names may contain Unicode letters, marks, numbers, connectors (e.g.
+// underscores), dashes and spaces.
+func validateTableName(name string) error {
+	if len(name) > maxNameLength {
+		return fmt.Errorf("%q is longer than %d bytes", name, maxNameLength)
+	}
+	if !utf8.ValidString(name) {
+		return fmt.Errorf("%q isn't valid UTF-8", name)
+	}
+	for _, r := range name {
+		if !unicode.In(r, unicode.L, unicode.M, unicode.N, unicode.Pc, unicode.Pd, unicode.Zs) {
+			return fmt.Errorf("%q may not contain %q", name, r)
+		}
+	}
+	return nil
+}
+
+// Column names may not start with these prefixes, in any case.
+var reservedColumnPrefixes = []string{"_TABLE_", "_FILE_", "_PARTITION", "_ROW_TIMESTAMP", "__ROOT__", "_COLON_"}
+
+// Locations are multi-regions, e.g. US, or regions, e.g. us-east4: letters
+// and digits, and dashes between them.
+func validateLocation(location string) error {
+	if len(location) > maxLocationLength {
+		return fmt.Errorf("%q is longer than %d characters", location, maxLocationLength)
+	}
+	for i, r := range location {
+		if r == '-' && i > 0 && i < len(location)-1 && location[i-1] != '-' {
+			continue
+		}
+		if (r < 'a' || r > 'z') && (r < 'A' || r > 'Z') && (r < '0' || r > '9') {
+			return fmt.Errorf("%q isn't a BigQuery location, e.g. US, EU or us-east4", location)
+		}
+	}
+	return nil
+}
+
+// BigQuery tables have at most 10,000 partitions.
+const maxRangePartitions = 10000
+
+func (cfg *Config) validateRangePartitioning() error {
+	rp := cfg.RangePartitioning
+	if rp.Field == "" {
+		return nil
+	}
+	if cfg.PartitionType != "" {
+		return errors.New("rangePartitioning isn't supported with partitionType")
+	}
+	if cfg.PartitionExpiration != 0 {
+		return errors.New("rangePartitioning isn't supported with partitionExpiration")
+	}
+	if !isValidColumnName(rp.Field) {
+		return fmt.Errorf("rangePartitioning.field %q must contain only letters, digits and underscores, and not start with a digit", rp.Field)
+	}
+	if rp.Field == cfg.partitionField() || rp.Field == cfg.spanNameColumn() || rp.Field == cfg.IngestTimestampColumn || rp.Field == cfg.PrimaryKeyColumn {
+		return fmt.Errorf("rangePartitioning.field %q must be an integer column, not one the exporter writes", rp.Field)
+	}
+	if rp.Interval <= 0 {
+		return errors.New("rangePartitioning.interval must be positive")
+	}
+	if rp.End <= rp.Start {
+		return errors.New("rangePartitioning.end must be greater than rangePartitioning.start")
+	}
+	// End - Start may overflow int64, but not uint64.
+	if partitions := (uint64(rp.End-rp.Start)-1)/uint64(rp.Interval) + 1; partitions > maxRangePartitions {
+		return fmt.Errorf("rangePartitioning must have at most %d partitions, not %d", maxRangePartitions, partitions)
+	}
+	return nil
+}
+
+// GCS bucket names are 3 to 63 characters (222 if they contain dots) of
+// lowercase letters, digits, dashes, underscores and dots, starting and
+// ending with a letter or digit.
+func validateBucketName(name string) error {
+	maxLength := 63
+	if strings.Contains(name, ".") {
+		maxLength = 222
+	}
+	if len(name) < 3 || len(name) > maxLength {
+		return fmt.Errorf("%q must be 3 to %d characters", name, maxLength)
+	}
+	for i, r := range name {
+		alphanumeric := (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9')
+		if (i == 0 || i == len(name)-1) && !alphanumeric {
+			return fmt.Errorf("%q must start and end with a lowercase letter or digit", name)
+		}
+		if !alphanumeric && r != '-' && r != '_' && r != '.' {
+			return fmt.Errorf("%q may only contain lowercase letters, digits, dashes, underscores and dots", name)
+		}
+	}
+	return nil
+}
+
+// Longer than any BigQuery location, e.g. northamerica-northeast1.
+const maxLocationLength = 64
+
+// GCP resources take at most 64 labels.
+const maxLabels = 64
+
+// GCP label keys and values are at most 63 characters, of lowercase (or
+// uncased, e.g. CJK) letters, digits, underscores and dashes. Keys must start
+// with a letter; values may be empty.
+const maxLabelLength = 63
+
+func validateLabels(labels map[string]string) error {
+	if len(labels) > maxLabels {
+		return fmt.Errorf("at most %d labels may be set", maxLabels)
+	}
+	for k, v := range labels {
+		if k == "" {
+			return errors.New("label keys may not be empty")
+		}
+		if r, _ := utf8.DecodeRuneInString(k); !isLabelLetter(r) {
+			return fmt.Errorf("label key %q must start with a lowercase letter", k)
+		}
+		for _, s := range []string{k, v} {
+			if utf8.RuneCountInString(s) > maxLabelLength {
+				return fmt.Errorf("label %q is longer than %d characters", s, maxLabelLength)
+			}
+			if !isValidLabel(s) {
+				return fmt.Errorf("label %q may only contain lowercase letters, digits, underscores and dashes", s)
+			}
+		}
+	}
+	return nil
+}
+
+func isValidLabel(s string) bool {
+	for _, r := range s {
+		if r != '_' && r != '-' && !unicode.IsDigit(r) && !isLabelLetter(r) {
+			return false
+		}
+	}
+	return true
+}
+
+func isLabelLetter(r rune) bool {
+	return unicode.IsLetter(r) && !unicode.IsUpper(r)
+}
+
+// Column prefixes must themselves be valid column names, leaving room for the
+// rest of the name.
+func validateColumnPrefix(prefix string) error {
+	if len(prefix) >= maxColumnNameLength {
+		return fmt.Errorf("%q must be shorter than %d bytes", prefix, maxColumnNameLength)
+	}
+	if !isValidColumnName(prefix) {
+		return fmt.Errorf("%q must contain only letters, digits and underscores, and not start with a digit", prefix)
+	}
+	for _, reserved := range reservedColumnPrefixes {
+		if strings.HasPrefix(strings.ToUpper(prefix), reserved) {
+			return fmt.Errorf("%q starts with the reserved prefix %s", prefix, reserved)
+		}
+	}
 	return nil
 }
@@ -1,9 +1,15 @@
 package bigquery
 
 import (
+	"math"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/component"
+	"go.opentelemetry.io/collector/confmap"
 )
 
 const (
@@ -11,6 +17,19 @@ const (
 	testDataset        = "otelex"
 	testTable          = "spattex_test"
 	testSchemaFlexible = false
+
+	testMaxSchemaUpdateRetries = 3
+
+	testPartitionField = "ts"
+	testPartitionType  = "DAY"
+
+	testSampleRatio = 1.0
+
+	testMaxRowsPerRequest    = 500
+	testMaxConcurrentInserts = 1
+	testIncludeEvents        = true
+
+	testShutdownTimeout = 5 * time.Second
 )
 
 func createTestConfig() *Config {
@@ -19,10 +38,635 @@ func createTestConfig() *Config {
 		Dataset:        testDataset,
 		Table:          testTable,
 		SchemaFlexible: testSchemaFlexible,
+
+		MaxSchemaUpdateRetries: testMaxSchemaUpdateRetries,
+
+		PartitionField: testPartitionField,
+		PartitionType:  testPartitionType,
+
+		SampleRatio: testSampleRatio,
+
+		MaxRowsPerRequest:    testMaxRowsPerRequest,
+		MaxConcurrentInserts: testMaxConcurrentInserts,
+		IncludeEvents:        testIncludeEvents,
+
+		ShutdownTimeout: testShutdownTimeout,
+
+		QueueBatchConfig: TunedQueueSettings(),
+		BackOffConfig:    TunedRetrySettings(),
+		TimeoutConfig:    TunedTimeoutSettings(),
 	}
 }
+
 func TestValidateConfig(t *testing.T) {
 	cfg := createTestConfig()
 	err := cfg.Validate()
 	require.NoError(t, err, "test config validation should not fail")
 }
+
+func TestNewConfig(t *testing.T) {
+	cfg, err := NewConfig(testProjectID, testDataset, testTable,
+		WithSchemaFlexible(),
+		WithCredentialsFile("/etc/otelex/key.json"),
+		WithLogsTable("spattex_logs"),
+	)
+	require.NoError(t, err)
+
+	expected := createDefaultConfig().(*Config)
+	expected.ProjectID = testProjectID
+	expected.Dataset = testDataset
+	expected.Table = testTable
+	expected.SchemaFlexible = true
+	expected.CredentialsFile = "/etc/otelex/key.json"
+	expected.LogsTable = "spattex_logs"
+	assert.Equal(t, expected, cfg, "options should be applied to the default config")
+}
+
+func TestNewConfigValidates(t *testing.T) {
+	_, err := NewConfig(testProjectID, "", testTable)
+	require.Error(t, err, "missing dataset should fail validation")
+
+	_, err = NewConfig(testProjectID, testDataset, testTable,
+		WithCredentialsFile("/etc/otelex/key.json"),
+		WithCredentialsJSON(`{"type": "service_account"}`),
+	)
+	require.Error(t, err, "options should be validated together")
+}
+
+func TestDefaultQueueSettings(t *testing.T) {
+	cfg := createDefaultConfig().(*Config)
+
+	assert.True(t, cfg.QueueBatchConfig.Enabled, "queue should be enabled by default")
+	assert.Equal(t, int64(1000), cfg.QueueBatchConfig.QueueSize, "queue should hold 1000 batches by default")
+	assert.Equal(t, 10, cfg.QueueBatchConfig.NumConsumers, "queue should have 10 consumers by default")
+	assert.False(t, cfg.QueueBatchConfig.BlockOnOverflow, "full queue should reject batches by default")
+	require.NoError(t, cfg.Validate(), "default config validation should not fail")
+}
+
+func TestLoadQueueSettings(t *testing.T) {
+	cfg := createDefaultConfig().(*Config)
+	conf := confmap.NewFromStringMap(map[string]any{
+		"sending_queue": map[string]any{
+			"queue_size":    42,
+			"num_consumers": 2,
+		},
+	})
+	require.NoError(t, conf.Unmarshal(cfg))
+
+	assert.Equal(t, int64(42), cfg.QueueBatchConfig.QueueSize)
+	assert.Equal(t, 2, cfg.QueueBatchConfig.NumConsumers)
+	assert.True(t, cfg.QueueBatchConfig.Enabled, "unset queue fields should keep their defaults")
+}
+
+func TestValidateQueueSettings(t *testing.T) {
+	cfg := createTestConfig()
+	cfg.QueueBatchConfig.QueueSize = 0
+
+	err := cfg.Validate()
+	require.Error(t, err, "enabled queue with no capacity should fail validation")
+}
+
+func TestDefaultRetrySettings(t *testing.T) {
+	cfg := createDefaultConfig().(*Config)
+
+	assert.Equal(t, TunedRetrySettings(), cfg.BackOffConfig, "default retry settings should be the tuned settings")
+}
+
+func TestLoadRetrySettings(t *testing.T) {
+	cfg := createDefaultConfig().(*Config)
+	conf := confmap.NewFromStringMap(map[string]any{
+		"retry_on_failure": map[string]any{
+			"initial_interval": "5s",
+		},
+	})
+	require.NoError(t, conf.Unmarshal(cfg))
+
+	assert.Equal(t, 5*time.Second, cfg.BackOffConfig.InitialInterval)
+	assert.Equal(t, TunedRetrySettings().MaxInterval, cfg.BackOffConfig.MaxInterval, "unset retry fields should keep their defaults")
+	require.NoError(t, cfg.Validate())
+}
+
+func TestValidateRetrySettings(t *testing.T) {
+	cfg := createTestConfig()
+	cfg.BackOffConfig.InitialInterval = -time.Second
+
+	err := cfg.Validate()
+	require.Error(t, err, "negative retry interval should fail validation")
+}
+
+func TestDefaultTimeoutSettings(t *testing.T) {
+	cfg := createDefaultConfig().(*Config)
+
+	assert.Equal(t, 120*time.Second, cfg.Timeout, "default timeout should accommodate schema updates")
+}
+
+func TestLoadTimeoutSettings(t *testing.T) {
+	cfg := createDefaultConfig().(*Config)
+	conf := confmap.NewFromStringMap(map[string]any{
+		"timeout": "30s",
+	})
+	require.NoError(t, conf.Unmarshal(cfg))
+
+	assert.Equal(t, 30*time.Second, cfg.Timeout)
+	require.NoError(t, cfg.Validate())
+}
+
+func TestValidateTimeoutSettings(t *testing.T) {
+	cfg := createTestConfig()
+	cfg.Timeout = -time.Second
+
+	err := cfg.Validate()
+	require.Error(t, err, "negative timeout should fail validation")
+}
+
+func TestValidateSchemaUpdateSettleDelay(t *testing.T) {
+	cfg := createTestConfig()
+	cfg.SchemaUpdateSettleDelay = -time.Second
+
+	err := cfg.Validate()
+	require.Error(t, err, "negative settle delay should fail validation")
+}
+
+func TestValidateMaxSchemaUpdateRetries(t *testing.T) {
+	cfg := createTestConfig()
+	cfg.MaxSchemaUpdateRetries = -1
+
+	err := cfg.Validate()
+	require.Error(t, err, "negative retries should fail validation")
+}
+
+func TestValidateAutodetectSchemaFromFirstBatch(t *testing.T) {
+	cfg := createTestConfig()
+	cfg.AutodetectSchemaFromFirstBatch = true
+	require.Error(t, cfg.Validate(), "autodetectSchemaFromFirstBatch should require createIfMissing")
+
+	cfg.CreateIfMissing = true
+	require.NoError(t, cfg.Validate())
+}
+
+func TestValidateColumnNameStyle(t *testing.T) {
+	for _, style := range []string{"", "snake", "preserve_dots", "camel"} {
+		cfg := createTestConfig()
+		cfg.ColumnNameStyle = style
+		require.NoError(t, cfg.Validate(), "columnNameStyle %q should be valid", style)
+	}
+
+	cfg := createTestConfig()
+	cfg.ColumnNameStyle = "kebab"
+	require.Error(t, cfg.Validate(), "unknown columnNameStyle should fail validation")
+}
+
+func TestValidateMaxColumns(t *testing.T) {
+	cfg := createTestConfig()
+	cfg.MaxColumns = -1
+
+	err := cfg.Validate()
+	require.Error(t, err, "negative max columns should fail validation")
+}
+
+func TestValidateMaxAttributeJSONBytes(t *testing.T) {
+	cfg := createTestConfig()
+	cfg.MaxAttributeJSONBytes = -1
+	err := cfg.Validate()
+	require.Error(t, err, "negative maxAttributeJSONBytes should fail validation")
+}
+
+func TestValidateShutdownTimeout(t *testing.T) {
+	cfg := createTestConfig()
+	cfg.ShutdownTimeout = 0
+
+	err := cfg.Validate()
+	require.Error(t, err, "zero shutdown timeout should fail validation")
+}
+
+func TestValidateAttributeColumnPrefix(t *testing.T) {
+	for _, prefix := range []string{"attr_", "a", "_otel_"} {
+		cfg := createTestConfig()
+		cfg.AttributeColumnPrefix = prefix
+		assert.NoError(t, cfg.Validate(), "prefix %q should pass validation", prefix)
+	}
+	for _, prefix := range []string{"1attr_", "attr.", "_partition_", strings.Repeat("a", maxColumnNameLength)} {
+		cfg := createTestConfig()
+		cfg.AttributeColumnPrefix = prefix
+		assert.Error(t, cfg.Validate(), "prefix %q should fail validation", prefix)
+	}
+}
+
+func TestValidateColumnNamespacing(t *testing.T) {
+	cfg := createTestConfig()
+	cfg.ColumnNamespacing = ColumnNamespacingConfig{Resource: "resource_", Scope: "scope_", Span: "span_"}
+	require.NoError(t, cfg.Validate(), "level prefixes should pass validation")
+
+	for _, namespacing := range []ColumnNamespacingConfig{
+		{Resource: "resource."},
+		{Scope: "1scope_"},
+		{Span: "_partition_"},
+	} {
+		cfg := createTestConfig()
+		cfg.ColumnNamespacing = namespacing
+		assert.Error(t, cfg.Validate(), "namespacing %+v should fail validation", namespacing)
+	}
+}
+
+func TestValidateLocation(t *testing.T) {
+	cfg := createTestConfig()
+	for _, location := range []string{"US", "EU", "us-east4", "northamerica-northeast1"} {
+		cfg.Location = location
+		assert.NoError(t, cfg.Validate(), "location %q should pass validation", location)
+	}
+
+	for _, location := range []string{"us east4", "us_east4", "-us", "us-", "us--east4", strings.Repeat("a", 65)} {
+		cfg.Location = location
+		assert.Error(t, cfg.Validate(), "location %q should fail validation", location)
+	}
+}
+
+func TestValidateNames(t *testing.T) {
+	tests := []struct {
+		name    string
+		dataset string
+		table   string
+		valid   bool
+	}{
+		{name: "underscores and digits", dataset: "otel_traces_2", table: "spattex_v2", valid: true},
+		{name: "table with dashes and spaces", dataset: "otelex", table: "span data-2024", valid: true},
+		{name: "unicode table", dataset: "otelex", table: "spans_日本", valid: true},
+		{name: "longest table", dataset: "otelex", table: strings.Repeat("t", 1024), valid: true},
+		{name: "dataset with dash", dataset: "otel-traces", table: "spattex"},
+		{name: "dataset with dot", dataset: "project.otelex", table: "spattex"},
+		{name: "dataset too long", dataset: strings.Repeat("d", 1025), table: "spattex"},
+		{name: "table with dot", dataset: "otelex", table: "spans.v1"},
+		{name: "table with slash", dataset: "otelex", table: "spans/v1"},
+		{name: "table with dollar", dataset: "otelex", table: "spans$20240101"},
+		{name: "table too long", dataset: "otelex", table: strings.Repeat("t", 1025)},
+		{name: "table too long in bytes", dataset: "otelex", table: strings.Repeat("日", 342)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := createTestConfig()
+			cfg.Dataset = tt.dataset
+			cfg.Table = tt.table
+
+			err := cfg.Validate()
+
+			if tt.valid {
+				require.NoError(t, err)
+			} else {
+				require.Error(t, err)
+			}
+		})
+	}
+}
+
+func TestValidateOtherTableNames(t *testing.T) {
+	for _, set := range []func(*Config){
+		func(cfg *Config) { cfg.LogsTable = "logs.v1" },
+		func(cfg *Config) { cfg.MetricsTable = "metrics.v1" },
+		func(cfg *Config) { cfg.DeadLetterTable = "dead.letters" },
+		func(cfg *Config) { cfg.ResourceTable = "resources.v1" },
+		func(cfg *Config) {
+			cfg.RouteByAttribute = "tenant"
+			cfg.RouteTableMapping = map[string]string{"acme": "acme.spans"}
+		},
+	} {
+		cfg := createTestConfig()
+		set(cfg)
+
+		err := cfg.Validate()
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "may not contain")
+	}
+}
+
+func TestValidateResourceTable(t *testing.T) {
+	cfg := createTestConfig()
+	cfg.ResourceTable = cfg.Table
+	require.Error(t, cfg.Validate(), "resourceTable should differ from table")
+
+	cfg.ResourceTable = "resources"
+	require.NoError(t, cfg.Validate())
+}
+
+func TestValidatePartitionType(t *testing.T) {
+	for _, partitionType := range []string{"DAY", "HOUR", "MONTH", "YEAR"} {
+		cfg := createTestConfig()
+		cfg.PartitionType = partitionType
+
+		err := cfg.Validate()
+		require.NoError(t, err, "partitionType %s should pass validation", partitionType)
+	}
+
+	for _, partitionType := range []string{"day", "WEEK", "MINUTE"} {
+		cfg := createTestConfig()
+		cfg.PartitionType = partitionType
+
+		err := cfg.Validate()
+		require.Error(t, err, "partitionType %s should fail validation", partitionType)
+	}
+}
+
+func TestValidateTableSuffixFormat(t *testing.T) {
+	cfg := createTestConfig()
+	cfg.TableSuffixFormat = "_20060102"
+	require.NoError(t, cfg.Validate(), "date layout should pass validation")
+
+	cfg.TableSuffixFormat = "2006-01-02"
+	require.Error(t, cfg.Validate(), "layout with invalid table name characters should fail validation")
+
+	cfg.TableSuffixFormat = "_20060102"
+	cfg.UseStorageWriteAPI = true
+	require.Error(t, cfg.Validate(), "sharding with the Storage Write API should fail validation")
+
+	cfg.UseStorageWriteAPI = false
+	cfg.UseGRPC = true
+	require.Error(t, cfg.Validate(), "sharding over gRPC should fail validation")
+}
+
+func TestValidatePartitionExpiration(t *testing.T) {
+	cfg := createTestConfig()
+	cfg.PartitionExpiration = -time.Hour
+
+	err := cfg.Validate()
+	require.Error(t, err, "negative partition expiration should fail validation")
+}
+
+func TestValidateRangePartitioning(t *testing.T) {
+	cfg := createTestConfig()
+	cfg.PartitionType = ""
+	cfg.RangePartitioning = RangePartitioningConfig{Field: "tenant_id", Start: 0, End: 1000, Interval: 10}
+	require.NoError(t, cfg.Validate(), "valid range partitioning should pass validation")
+
+	cfg.PartitionType = "DAY"
+	require.ErrorContains(t, cfg.Validate(), "partitionType", "range partitioning with partitionType should fail validation")
+
+	for _, rp := range []RangePartitioningConfig{
+		{Field: "tenant-id", End: 1000, Interval: 10},
+		{Field: testPartitionField, End: 1000, Interval: 10},
+		{Field: "tenant_id", End: 1000},
+		{Field: "tenant_id", Start: 1000, End: 1000, Interval: 10},
+		{Field: "tenant_id", End: 100001, Interval: 10},
+		{Field: "tenant_id", Start: math.MinInt64, End: math.MaxInt64, Interval: 1},
+	} {
+		cfg := createTestConfig()
+		cfg.PartitionType = ""
+		cfg.RangePartitioning = rp
+		require.Error(t, cfg.Validate(), "range partitioning %+v should fail validation", rp)
+	}
+}
+
+func TestValidateGCSFallbackBucket(t *testing.T) {
+	for _, bucket := range []string{"otelex-fallback", "otelex_fallback_2", "fallback.otelex.example.com"} {
+		cfg := createTestConfig()
+		cfg.GCSFallbackBucket = bucket
+		require.NoError(t, cfg.Validate(), "bucket %s should pass validation", bucket)
+	}
+
+	for _, bucket := range []string{"ab", "Otelex-Fallback", "-otelex", "otelex-", "otelex/fallback", strings.Repeat("a", 64)} {
+		cfg := createTestConfig()
+		cfg.GCSFallbackBucket = bucket
+		require.Error(t, cfg.Validate(), "bucket %s should fail validation", bucket)
+	}
+}
+
+func TestValidateLabels(t *testing.T) {
+	cfg := createTestConfig()
+	cfg.Labels = map[string]string{"team": "observability", "env": "", "cost-center": "cc_42", "チーム": "観測"}
+	require.NoError(t, cfg.Validate(), "valid labels should pass validation")
+
+	for _, labels := range []map[string]string{
+		{"": "observability"},
+		{"Team": "observability"},
+		{"1team": "observability"},
+		{"team": "Observability"},
+		{"team": "observability.dev"},
+		{"team": strings.Repeat("a", 64)},
+		{strings.Repeat("a", 64): "observability"},
+	} {
+		cfg.Labels = labels
+		assert.Error(t, cfg.Validate(), "labels %v should fail validation", labels)
+	}
+}
+
+func TestValidatePrimaryKeyColumn(t *testing.T) {
+	cfg := createTestConfig()
+	cfg.PrimaryKeyColumn = "span_key"
+	require.NoError(t, cfg.Validate())
+
+	cfg.PrimaryKeyColumn = "span-key"
+	require.Error(t, cfg.Validate(), "invalid column name should fail validation")
+
+	cfg.PrimaryKeyColumn = cfg.partitionField()
+	require.Error(t, cfg.Validate(), "primaryKeyColumn must differ from partitionField")
+}
+
+func TestValidateSpanNameColumn(t *testing.T) {
+	cfg := createTestConfig()
+	cfg.SpanNameColumn = "span_name"
+	require.NoError(t, cfg.Validate())
+
+	cfg.SpanNameColumn = "span.name"
+	require.Error(t, cfg.Validate(), "invalid column name should fail validation")
+
+	cfg.SpanNameColumn = cfg.partitionField()
+	require.Error(t, cfg.Validate(), "spanNameColumn must differ from partitionField")
+}
+
+func TestValidateIngestTimestampColumn(t *testing.T) {
+	cfg := createTestConfig()
+	cfg.IngestTimestampColumn = "ingested_at"
+	require.NoError(t, cfg.Validate(), "ingest timestamp column should pass validation")
+
+	cfg.IngestTimestampColumn = cfg.partitionField()
+	require.Error(t, cfg.Validate(), "ingest timestamp in the partition field should fail validation")
+}
+
+func TestValidateImpersonation(t *testing.T) {
+	cfg := createTestConfig()
+	cfg.ImpersonateServiceAccount = "writer@msyvr.iam.gserviceaccount.com"
+	cfg.ImpersonateDelegates = []string{"delegate@msyvr.iam.gserviceaccount.com"}
+	require.NoError(t, cfg.Validate(), "impersonation should pass validation")
+
+	cfg.CredentialsJSON = `{"type": "service_account"}`
+	require.Error(t, cfg.Validate(), "impersonation with credentials JSON should fail validation")
+
+	cfg = createTestConfig()
+	cfg.ImpersonateDelegates = []string{"delegate@msyvr.iam.gserviceaccount.com"}
+	require.Error(t, cfg.Validate(), "delegates without a service account to impersonate should fail validation")
+}
+
+func TestValidateAuth(t *testing.T) {
+	cfg := createTestConfig()
+	cfg.Auth = component.MustNewID("googleclientauth")
+	require.NoError(t, cfg.Validate())
+
+	cfg.CredentialsFile = "/etc/otelex/key.json"
+	require.Error(t, cfg.Validate(), "auth should not be combined with credentialsFile")
+
+	cfg.CredentialsFile = ""
+	cfg.UseStorageWriteAPI = true
+	require.Error(t, cfg.Validate(), "auth should not be combined with useStorageWriteAPI")
+}
+
+func TestLoadAuth(t *testing.T) {
+	cfg := createDefaultConfig().(*Config)
+	conf := confmap.NewFromStringMap(map[string]any{
+		"auth": "googleclientauth/bigquery",
+	})
+	require.NoError(t, conf.Unmarshal(cfg))
+
+	assert.Equal(t, component.MustNewIDWithName("googleclientauth", "bigquery"), cfg.Auth)
+}
+
+func TestValidateCredentials(t *testing.T) {
+	cfg := createTestConfig()
+	cfg.CredentialsFile = "/etc/otelex/key.json"
+	require.NoError(t, cfg.Validate())
+
+	cfg.CredentialsJSON = `{"type":"service_account"}`
+	require.Error(t, cfg.Validate(), "setting both credentials sources should fail validation")
+}
+
+func TestValidateRouteTableMapping(t *testing.T) {
+	cfg := createTestConfig()
+	cfg.RouteTableMapping = map[string]string{"acme": "spattex_acme"}
+	require.Error(t, cfg.Validate(), "routeTableMapping without routeByAttribute should fail validation")
+
+	cfg.RouteByAttribute = "tenant"
+	require.NoError(t, cfg.Validate())
+
+	cfg.RouteTableMapping["globex"] = ""
+	require.Error(t, cfg.Validate(), "empty table name should fail validation")
+}
+
+func TestValidateMaxRequestsPerSecond(t *testing.T) {
+	cfg := createTestConfig()
+	cfg.MaxRequestsPerSecond = -1
+
+	err := cfg.Validate()
+	require.Error(t, err, "negative rate should fail validation")
+}
+
+func TestValidateStableColumnSet(t *testing.T) {
+	cfg := createTestConfig()
+	cfg.StableColumnSet = []string{"http_method", "db_system"}
+	require.NoError(t, cfg.Validate())
+
+	cfg.StableColumnSet = []string{"http.method"}
+	require.Error(t, cfg.Validate(), "unsanitized names should fail validation")
+}
+
+func TestValidateEmptyAttributeValues(t *testing.T) {
+	for _, option := range []string{"skip", "null"} {
+		cfg := createTestConfig()
+		cfg.EmptyAttributeValues = option
+		require.NoError(t, cfg.Validate(), "emptyAttributeValues %s should pass validation", option)
+	}
+
+	cfg := createTestConfig()
+	cfg.EmptyAttributeValues = "zero"
+	require.Error(t, cfg.Validate(), "unknown emptyAttributeValues should fail validation")
+}
+
+func TestValidateTypeConflictStrategy(t *testing.T) {
+	for _, option := range []string{"coerce", "suffix", "drop"} {
+		cfg := createTestConfig()
+		cfg.TypeConflictStrategy = option
+		require.NoError(t, cfg.Validate(), "typeConflictStrategy %s should pass validation", option)
+	}
+
+	cfg := createTestConfig()
+	cfg.TypeConflictStrategy = "rename"
+	require.Error(t, cfg.Validate(), "unknown typeConflictStrategy should fail validation")
+}
+
+func TestValidateInsertOptions(t *testing.T) {
+	cfg := createTestConfig()
+	cfg.SkipInvalidRows = true
+	cfg.IgnoreUnknownValues = true
+	require.NoError(t, cfg.Validate())
+
+	cfg.SchemaFlexible = true
+	require.Error(t, cfg.Validate(), "ignoreUnknownValues should not be combined with schemaFlexible")
+
+	cfg.SchemaFlexible = false
+	cfg.IgnoreUnknownValues = false
+	cfg.UseStorageWriteAPI = true
+	require.Error(t, cfg.Validate(), "skipInvalidRows should not be combined with useStorageWriteAPI")
+}
+
+func TestValidateMaxRowsPerRequest(t *testing.T) {
+	for _, maxRows := range []int{0, 50001} {
+		cfg := createTestConfig()
+		cfg.MaxRowsPerRequest = maxRows
+
+		err := cfg.Validate()
+		require.Error(t, err, "maxRowsPerRequest %d should fail validation", maxRows)
+	}
+}
+
+func TestValidateSampleRatio(t *testing.T) {
+	for _, ratio := range []float64{0.001, 0.5, 1} {
+		cfg := createTestConfig()
+		cfg.SampleRatio = ratio
+		require.NoError(t, cfg.Validate(), "sampleRatio %v should pass validation", ratio)
+	}
+
+	for _, ratio := range []float64{0, -0.5, 1.5} {
+		cfg := createTestConfig()
+		cfg.SampleRatio = ratio
+		require.Error(t, cfg.Validate(), "sampleRatio %v should fail validation", ratio)
+	}
+}
+
+func TestValidateInternalBatch(t *testing.T) {
+	cfg := createTestConfig()
+	cfg.InternalBatch = InternalBatchConfig{MaxRows: 500, FlushInterval: time.Second}
+	require.NoError(t, cfg.Validate())
+
+	cfg.InternalBatch = InternalBatchConfig{MaxRows: 500}
+	require.Error(t, cfg.Validate(), "maxRows without flushInterval should fail validation")
+
+	cfg.InternalBatch = InternalBatchConfig{MaxRows: -1, FlushInterval: time.Second}
+	require.Error(t, cfg.Validate(), "negative maxRows should fail validation")
+
+	cfg.InternalBatch = InternalBatchConfig{MaxRows: 500, FlushInterval: time.Second}
+	cfg.StreamingRowBuild = true
+	require.Error(t, cfg.Validate(), "internalBatch should not be combined with streamingRowBuild")
+}
+
+func TestValidateMaxConcurrentInserts(t *testing.T) {
+	cfg := createTestConfig()
+	cfg.MaxConcurrentInserts = 0
+
+	err := cfg.Validate()
+	require.Error(t, err, "maxConcurrentInserts below 1 should fail validation")
+}
+
+func TestLogsTableDefaultsToTable(t *testing.T) {
+	cfg := createTestConfig()
+	assert.Equal(t, testTable, cfg.logsTable())
+
+	cfg.LogsTable = "spattex_logs"
+	assert.Equal(t, "spattex_logs", cfg.logsTable())
+}
+
+func TestMetricsTableDefaultsToTable(t *testing.T) {
+	cfg := createTestConfig()
+	assert.Equal(t, testTable, cfg.metricsTable())
+
+	cfg.MetricsTable = "spattex_metrics"
+	assert.Equal(t, "spattex_metrics", cfg.metricsTable())
+}
+
+func TestLoadSchemaFlexible(t *testing.T) {
+	cfg := createDefaultConfig().(*Config)
+	require.False(t, cfg.SchemaFlexible, "schema should be fixed by default")
+
+	conf := confmap.NewFromStringMap(map[string]any{
+		"schemaFlexible": true,
+	})
+	require.NoError(t, conf.Unmarshal(cfg))
+
+	assert.True(t, cfg.SchemaFlexible, "schemaFlexible should be settable from config")
+}
@@ -0,0 +1,128 @@
+package bigquery
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.uber.org/zap"
+)
+
+// Rows that can never be inserted, e.g. with a value that has no BigQuery
+// type or that BigQuery rejects as invalid, are written to the dead-letter
+// table so the data isn't lost. The table must have the columns
+//
+//	ts TIMESTAMP, source_table STRING, row STRING, error STRING
+//
+// where row is the rejected row serialized as JSON. Without a dead-letter
+// table, the rows are logged and dropped.
+type deadLetterSink struct {
+	tableID  string
+	inserter rowInserter
+}
+
+// Write rows to the dead-letter table, each with the reason it was rejected.
+// Failures are logged rather than returned: the rows were already given up
+// on, and shouldn't hold up the rest of the batch. Either way, the rows are
+// settled, so retries of the batch don't resend them.
+func (sender *bigquerySender) deadLetter(ctx context.Context, rows []bigqueryrow, reasons []error) {
+	settledRowsFromContext(ctx).add(rows, sender.partitionField())
+	if sender.deadLetters == nil || len(rows) == 0 {
+		return
+	}
+
+	now := pcommon.NewTimestampFromTime(time.Now())
+	savers := make([]bigquery.ValueSaver, len(rows))
+	for i, row := range rows {
+		savers[i] = bigqueryrow{
+			"ts":           now,
+			"source_table": sender.tableID,
+			"row":          deadLetterJSON(row),
+			"error":        reasons[i].Error(),
+		}
+	}
+
+	if err := sender.deadLetters.inserter.Put(ctx, savers); err != nil {
+		sender.logger.Error("Failed to write rows to the dead-letter table",
+			zap.String("table", sender.deadLetters.tableID),
+			zap.Int("rows", len(rows)),
+			zap.Error(err))
+	}
+}
+
+// Serialize a row for the dead-letter table. Values that can't be serialized
+// as JSON are formatted with %v instead.
+func deadLetterJSON(row bigqueryrow) string {
+	if s := jsonString(row); s != "" {
+		return s
+	}
+	values := make(map[string]string, len(row))
+	for k, v := range row {
+		values[k] = fmt.Sprintf("%v", v)
+	}
+	return jsonString(values)
+}
+
+// Split rows with a value that has no BigQuery type from the rest. Such
+// values can't be added to the schema, so the rows would fail every retry.
+func splitUnmappableRows(rows []bigqueryrow) (mappable, unmappable []bigqueryrow, reasons []error) {
+	for _, row := range rows {
+		if err := unmappableValue(row); err != nil {
+			unmappable = append(unmappable, row)
+			reasons = append(reasons, err)
+		} else {
+			mappable = append(mappable, row)
+		}
+	}
+	return mappable, unmappable, reasons
+}
+
+// Split rows with fields the table schema lacks, after a schema update that
+// MaxColumns kept from adding them, from the rest. The rows would fail every
+// retry.
+func (sender *bigquerySender) splitRowsOverColumnLimit(rows []bigqueryrow) (fitting, over []bigqueryrow, reasons []error) {
+	sender.schema.mu.Lock()
+	defer sender.schema.mu.Unlock()
+	for _, row := range rows {
+		if column := missingColumn(row, sender.schema.types); column != "" {
+			over = append(over, row)
+			reasons = append(reasons, fmt.Errorf("no column for %s: the table is at maxColumns (%d)", column, sender.MaxColumns))
+		} else {
+			fitting = append(fitting, row)
+		}
+	}
+	return fitting, over, reasons
+}
+
+// The first of the row's columns that isn't in types, or "" if there's none.
+func missingColumn(row bigqueryrow, types map[string]bigquery.FieldType) string {
+	for key := range row {
+		if _, ok := types[key]; !ok {
+			return key
+		}
+	}
+	return ""
+}
+
+// The number of values in the row with no field type.
+func unmappableValues(row bigqueryrow) int {
+	n := 0
+	for key, value := range row {
+		if _, err := inferFieldType(key, value); err != nil {
+			n++
+		}
+	}
+	return n
+}
+
+// The inference error for the first value in the row with no field type.
+func unmappableValue(row bigqueryrow) error {
+	for key, value := range row {
+		if _, err := inferFieldType(key, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
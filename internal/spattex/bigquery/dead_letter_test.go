@@ -0,0 +1,83 @@
+package bigquery
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestUnmappableValueDeadLettered(t *testing.T) {
+	rowErrs := bigquery.PutMultiError{
+		{RowIndex: 0, Errors: bigquery.MultiError{&bigquery.Error{Reason: "invalid", Message: "no such field: new_key."}}},
+		{RowIndex: 1, Errors: bigquery.MultiError{&bigquery.Error{Reason: "invalid", Message: "no such field: odd_key."}}},
+	}
+	inserter := &fakeInserter{errs: []error{rowErrs}}
+	deadLetters := &fakeInserter{}
+	table := newFakeSchemaManager(bigquery.Schema{{Name: "name", Type: bigquery.StringFieldType}})
+	cfg := createTestConfig()
+	cfg.SchemaFlexible = true
+	cfg.SchemaUpdateSettleDelay = time.Millisecond
+	sender := newTestSender(t, withConfig(cfg), withInserter(inserter), withDeadLetters(deadLetters))
+	sender.schemaManager = table
+	rows := []bigqueryrow{
+		{"name": "span1", "new_key": "value"},
+		{"name": "span2", "odd_key": []int{1, 2}},
+	}
+
+	require.NoError(t, sender.sendRows(context.Background(), rows))
+
+	assert.Equal(t, []int{2, 1}, inserter.putSizes, "Only the mappable row should be retried")
+	assert.Equal(t, bigquery.StringFieldType, fieldType(table.meta.Schema, "new_key"))
+	assert.Empty(t, fieldType(table.meta.Schema, "odd_key"), "Unmappable fields should not be added to the schema")
+
+	require.Equal(t, []int{1}, deadLetters.putSizes, "The unmappable row should be dead-lettered")
+	row := savedRow(t, deadLetters.rows[0])
+	assert.Equal(t, testTable, row["source_table"])
+	assert.JSONEq(t, `{"name": "span2", "odd_key": [1, 2]}`, row["row"].(string))
+	assert.Contains(t, row["error"], "odd_key")
+}
+
+func TestInvalidRowDeadLettered(t *testing.T) {
+	rowErrs := bigquery.PutMultiError{
+		{RowIndex: 0, Errors: bigquery.MultiError{&bigquery.Error{Reason: "invalid", Message: "Cannot convert value to integer."}}},
+	}
+	deadLetters := &fakeInserter{}
+	sender := newTestSender(t, withInserter(&fakeInserter{errs: []error{rowErrs}}), withDeadLetters(deadLetters))
+	rows := []bigqueryrow{{"name": "span1", "count": "many"}}
+
+	require.NoError(t, sender.sendRows(context.Background(), rows))
+
+	require.Equal(t, []int{1}, deadLetters.putSizes)
+	row := savedRow(t, deadLetters.rows[0])
+	assert.JSONEq(t, `{"name": "span1", "count": "many"}`, row["row"].(string))
+	assert.Contains(t, row["error"], "Cannot convert value to integer.")
+}
+
+func TestDeadLetterFailureLogged(t *testing.T) {
+	rowErrs := bigquery.PutMultiError{
+		{RowIndex: 0, Errors: bigquery.MultiError{&bigquery.Error{Reason: "invalid", Message: "Cannot convert value to integer."}}},
+	}
+	deadLetters := &fakeInserter{errs: []error{errors.New("dead-letter table not found")}}
+	sender := newTestSender(t, withInserter(&fakeInserter{errs: []error{rowErrs}}), withDeadLetters(deadLetters))
+	core, logs := observer.New(zap.ErrorLevel)
+	sender.logger = zap.New(core)
+
+	err := sender.sendRows(context.Background(), []bigqueryrow{{"name": "span1"}})
+
+	require.NoError(t, err, "Dead-letter failures should not fail the batch")
+	assert.Equal(t, 1, logs.FilterMessage("Failed to write rows to the dead-letter table").Len())
+}
+
+// Helper function to get the values of an inserted row
+func savedRow(t *testing.T, saver bigquery.ValueSaver) map[string]bigquery.Value {
+	row, _, err := saver.Save()
+	require.NoError(t, err)
+	return row
+}
@@ -0,0 +1,92 @@
+package bigquery
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+// Reasons attribute values are dropped rather than exported.
+const (
+	// Empty values, with EmptyAttributeValues skip.
+	dropReasonEmptyValue = "empty_value"
+	// Values that can't be encoded, e.g. mixed slices holding NaN doubles,
+	// which JSON can't represent.
+	dropReasonUnencodable = "unencodable"
+	// Values with no BigQuery type, e.g. set by a RowTransformer. The rows
+	// holding them are dead-lettered.
+	dropReasonUnsupportedType = "unsupported_type"
+	// Maps and slices whose JSON is longer than MaxAttributeJSONBytes.
+	dropReasonOversized = "oversized"
+	// Values that don't match their column type, with TypeConflictStrategy
+	// drop.
+	dropReasonTypeConflict = "type_conflict"
+)
+
+// Counts of attribute values dropped from a batch, by reason. Safe for
+// concurrent use. A nil *attributeDrops counts nothing.
+type attributeDrops struct {
+	mu     sync.Mutex
+	counts map[string]int
+}
+
+func (d *attributeDrops) add(reason string, n int) {
+	if d == nil || n == 0 {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.counts == nil {
+		d.counts = map[string]int{}
+	}
+	d.counts[reason] += n
+}
+
+// The counts so far, resetting them.
+func (d *attributeDrops) take() map[string]int {
+	if d == nil {
+		return nil
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	counts := d.counts
+	d.counts = nil
+	return counts
+}
+
+type attributeDropsKey struct{}
+
+// A context carrying a batch's drop counts from row building to sendRows,
+// which reports them.
+func contextWithAttributeDrops(ctx context.Context, drops *attributeDrops) context.Context {
+	return context.WithValue(ctx, attributeDropsKey{}, drops)
+}
+
+func attributeDropsFromContext(ctx context.Context) *attributeDrops {
+	drops, _ := ctx.Value(attributeDropsKey{}).(*attributeDrops)
+	return drops
+}
+
+// Log a summary of the attribute values dropped since the last report, and
+// count them in the attributes dropped metric, so operators can tell when
+// instrumentation produces data the exporter can't represent.
+func (sender *bigquerySender) reportAttributeDrops(ctx context.Context, drops *attributeDrops) {
+	counts := drops.take()
+	if len(counts) == 0 {
+		return
+	}
+
+	reasons := make([]string, 0, len(counts))
+	for reason := range counts {
+		reasons = append(reasons, reason)
+	}
+	sort.Strings(reasons)
+	fields := []zap.Field{zap.String("table", sender.tableID)}
+	for _, reason := range reasons {
+		fields = append(fields, zap.Int(reason, counts[reason]))
+		sender.telemetry.recordAttributesDropped(ctx, sender.tableID, reason, counts[reason])
+	}
+	sender.logger.Debug("Dropped attribute values that can't be exported", fields...)
+}
@@ -0,0 +1,131 @@
+package bigquery
+
+import (
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+
+	"cloud.google.com/go/bigquery"
+	"google.golang.org/api/googleapi"
+)
+
+// The kinds of BigQuery errors the exporter acts on. Errors from BigQuery are
+// tagged with their kind as they're returned (see kindError), so the retry
+// and schema update logic can match them with errors.Is.
+var (
+	// Rows have fields missing from the table schema.
+	errSchemaMismatch = errors.New("no such field")
+	// The table, or its dataset, doesn't exist.
+	errTableNotFound = errors.New("table not found")
+	// The request exceeded a rate limit or quota.
+	errQuotaExceeded = errors.New("quota exceeded")
+	// The credentials are invalid or lack permission for the table.
+	errAccessDenied = errors.New("access denied")
+	// BigQuery rejected the request as invalid, e.g. too large, so it will
+	// be rejected however often it's sent.
+	errInvalidRequest = errors.New("invalid request")
+	// The request failed in transit, e.g. timed out or had its connection
+	// reset, or BigQuery failed to handle it. Sending it again may succeed.
+	errTransient = errors.New("transient error")
+)
+
+// An error tagged with its kind, one of the err* errors above. It reads as
+// the error itself.
+type kindError struct {
+	kind error
+	err  error
+}
+
+func (e *kindError) Error() string { return e.err.Error() }
+
+func (e *kindError) Unwrap() []error { return []error{e.kind, e.err} }
+
+// Tag err with its kind, if it has one the exporter acts on. Errors already
+// tagged, and errors of other kinds, are returned as is.
+func tagErrorKind(err error) error {
+	var tagged *kindError
+	if err == nil || errors.As(err, &tagged) || errors.Is(err, errSchemaMismatch) {
+		return err
+	}
+
+	var kind error
+	var apiErr *googleapi.Error
+	var rowErrs bigquery.PutMultiError
+	switch {
+	// Checked before access errors: quota errors may also be 403s.
+	case isQuotaExceeded(err):
+		kind = errQuotaExceeded
+	case errors.As(err, &apiErr):
+		switch apiErr.Code {
+		case http.StatusNotFound:
+			kind = errTableNotFound
+		case http.StatusUnauthorized, http.StatusForbidden:
+			kind = errAccessDenied
+		case http.StatusBadRequest:
+			kind = errInvalidRequest
+		case http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			kind = errTransient
+		}
+	case errors.As(err, &rowErrs):
+		for i := range rowErrs {
+			if isRowSchemaMismatch(&rowErrs[i]) {
+				kind = errSchemaMismatch
+				break
+			}
+		}
+	case isNetworkError(err):
+		kind = errTransient
+	}
+	if kind == nil {
+		return err
+	}
+	return &kindError{kind: kind, err: err}
+}
+
+// The request failed in transit: a net.Error, e.g. a timeout or connection
+// reset, or a connection closed mid-response.
+func isNetworkError(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// The request was rejected for exceeding a rate limit or quota.
+func isQuotaExceeded(err error) bool {
+	var apiErr *googleapi.Error
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	if apiErr.Code == http.StatusTooManyRequests {
+		return true
+	}
+	if apiErr.Code != http.StatusForbidden {
+		return false
+	}
+	for _, item := range apiErr.Errors {
+		switch item.Reason {
+		case "rateLimitExceeded", "quotaExceeded":
+			return true
+		}
+	}
+	return false
+}
+
+// The insert was rejected because row fields are missing from the table schema.
+func isSchemaMismatch(err error) bool {
+	return errors.Is(tagErrorKind(err), errSchemaMismatch)
+}
+
+// The row was rejected because it has fields missing from the table schema.
+// BigQuery gives these the same reason, invalid, as values that don't fit
+// their column, so only the message tells them apart.
+func isRowSchemaMismatch(rowErr *bigquery.RowInsertionError) bool {
+	for _, err := range rowErr.Errors {
+		var bqErr *bigquery.Error
+		if errors.As(err, &bqErr) && bqErr.Reason == "invalid" && strings.HasPrefix(bqErr.Message, errSchemaMismatch.Error()) {
+			return true
+		}
+	}
+	return false
+}
@@ -3,38 +3,131 @@ package bigquery
 import (
 	"context"
 	"errors"
+	"time"
 
+	"cloud.google.com/go/bigquery"
 	"go.opentelemetry.io/collector/component"
 	"go.opentelemetry.io/collector/exporter"
 )
 
 var (
-	typeStr = component.MustNewType("exporter")
+	// Components are referenced in collector config by type, i.e. as
+	// `bigquery`. Prior versions registered the type as "exporter", so
+	// configs using that key need to be updated.
+	typeStr = component.MustNewType("bigquery")
 )
 
 const (
 	stability component.StabilityLevel = component.StabilityLevelStable
 
-	defaultProjectID      = "msyvr"
 	defaultDataset        = "otelex"
 	defaultTable          = "spattex"
 	defaultSchemaFlexible = false
+
+	defaultCreateIfMissing = false
+
+	defaultSpanNameColumn = "name"
+
+	// Partitioning the table into single days is useful for efficient queries.
+	defaultPartitionField = "ts"
+	defaultPartitionType  = bigquery.DayPartitioningType
+
+	defaultSchemaUpdateSettleDelay = 0
+	defaultMaxSchemaUpdateRetries  = 3
+
+	defaultEmptyAttributeValues = emptyAttributeValuesSkip
+	defaultTypeConflictStrategy = typeConflictCoerce
+	defaultColumnNameStyle      = columnNameStyleSnake
+
+	// Well under BigQuery's 10 MB row size limit, leaving room for the
+	// row's other columns.
+	defaultMaxAttributeJSONBytes = 1 << 20
+
+	defaultOnlyExportErrors   = false
+	defaultRequireSampledFlag = false
+	defaultSampleRatio        = 1.0
+	defaultSampleByTraceID    = false
+
+	defaultNestResource = false
+
+	defaultIncludeEvents       = true
+	defaultEmitEventTimeBounds = false
+	defaultIncludeLinks        = false
+	defaultIncludeRawSpan      = false
+
+	defaultStreamingRowBuild    = false
+	defaultMaxRowsPerRequest    = 500
+	defaultMaxConcurrentInserts = 1
+	defaultDeduplicate          = false
+
+	defaultShutdownTimeout = 30 * time.Second
 )
 
 func NewFactory() exporter.Factory {
+	return newFactory(createDefaultConfig)
+}
+
+// A factory for exporters that apply transformer to each row before it's
+// inserted, for collector distributions that build in custom row handling.
+func NewFactoryWithRowTransformer(transformer RowTransformer) exporter.Factory {
+	return newFactory(func() component.Config {
+		cfg := createDefaultConfig().(*Config)
+		cfg.RowTransformer = transformer
+		return cfg
+	})
+}
+
+func newFactory(createDefaultConfig component.CreateDefaultConfigFunc) exporter.Factory {
 	return exporter.NewFactory(
 		typeStr,
 		createDefaultConfig,
 		exporter.WithTraces(CreateBigQueryExporterFunc, stability),
+		exporter.WithLogs(CreateBigQueryLogsExporterFunc, stability),
+		exporter.WithMetrics(CreateBigQueryMetricsExporterFunc, stability),
 	)
 }
 
 func createDefaultConfig() component.Config {
 	return &Config{
-		ProjectID:      defaultProjectID,
 		Dataset:        defaultDataset,
 		Table:          defaultTable,
 		SchemaFlexible: defaultSchemaFlexible,
+
+		CreateIfMissing: defaultCreateIfMissing,
+		SpanNameColumn:  defaultSpanNameColumn,
+		PartitionField:  defaultPartitionField,
+
+		SchemaUpdateSettleDelay: defaultSchemaUpdateSettleDelay,
+		MaxSchemaUpdateRetries:  defaultMaxSchemaUpdateRetries,
+
+		EmptyAttributeValues: defaultEmptyAttributeValues,
+		TypeConflictStrategy: defaultTypeConflictStrategy,
+		ColumnNameStyle:      defaultColumnNameStyle,
+
+		MaxAttributeJSONBytes: defaultMaxAttributeJSONBytes,
+
+		OnlyExportErrors:   defaultOnlyExportErrors,
+		RequireSampledFlag: defaultRequireSampledFlag,
+		SampleRatio:        defaultSampleRatio,
+		SampleByTraceID:    defaultSampleByTraceID,
+
+		NestResource: defaultNestResource,
+
+		IncludeEvents:       defaultIncludeEvents,
+		EmitEventTimeBounds: defaultEmitEventTimeBounds,
+		IncludeLinks:        defaultIncludeLinks,
+		IncludeRawSpan:      defaultIncludeRawSpan,
+
+		StreamingRowBuild:    defaultStreamingRowBuild,
+		MaxRowsPerRequest:    defaultMaxRowsPerRequest,
+		MaxConcurrentInserts: defaultMaxConcurrentInserts,
+		Deduplicate:          defaultDeduplicate,
+
+		ShutdownTimeout: defaultShutdownTimeout,
+
+		QueueBatchConfig: TunedQueueSettings(),
+		BackOffConfig:    TunedRetrySettings(),
+		TimeoutConfig:    TunedTimeoutSettings(),
 	}
 }
 
@@ -55,3 +148,39 @@ func CreateBigQueryExporterFunc(
 
 	return exporter, nil
 }
+
+func CreateBigQueryLogsExporterFunc(
+	ctx context.Context,
+	settings exporter.Settings,
+	config component.Config,
+) (exporter.Logs, error) {
+	if config == nil {
+		return nil, errors.New("exporter configuration required")
+	}
+
+	cfg := config.(*Config)
+	exporter, err := newLogsExporter(cfg, settings)
+	if err != nil {
+		return nil, err
+	}
+
+	return exporter, nil
+}
+
+func CreateBigQueryMetricsExporterFunc(
+	ctx context.Context,
+	settings exporter.Settings,
+	config component.Config,
+) (exporter.Metrics, error) {
+	if config == nil {
+		return nil, errors.New("exporter configuration required")
+	}
+
+	cfg := config.(*Config)
+	exporter, err := newMetricsExporter(cfg, settings)
+	if err != nil {
+		return nil, err
+	}
+
+	return exporter, nil
+}
@@ -0,0 +1,60 @@
+package bigquery
+
+import (
+	"context"
+	"testing"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/component"
+	"go.opentelemetry.io/collector/component/componenttest"
+	"go.opentelemetry.io/collector/exporter"
+	"google.golang.org/api/option"
+)
+
+func TestExportersDontMutateData(t *testing.T) {
+	t.Setenv(emulatorHostEnv, "localhost:9050")
+	factory := NewFactory()
+	cfg := createTestConfig()
+	settings := exporter.Settings{
+		ID:                component.NewID(typeStr),
+		TelemetrySettings: componenttest.NewNopTelemetrySettings(),
+		BuildInfo:         component.NewDefaultBuildInfo(),
+	}
+
+	traces, err := factory.CreateTraces(context.Background(), settings, cfg)
+	require.NoError(t, err)
+	assert.False(t, traces.Capabilities().MutatesData, "Traces exporter should not mutate data")
+
+	logs, err := factory.CreateLogs(context.Background(), settings, cfg)
+	require.NoError(t, err)
+	assert.False(t, logs.Capabilities().MutatesData, "Logs exporter should not mutate data")
+
+	metrics, err := factory.CreateMetrics(context.Background(), settings, cfg)
+	require.NoError(t, err)
+	assert.False(t, metrics.Capabilities().MutatesData, "Metrics exporter should not mutate data")
+}
+
+func TestFactoryType(t *testing.T) {
+	factory := NewFactory()
+
+	assert.Equal(t, "bigquery", factory.Type().String(), "component should be referenced as bigquery in collector config")
+}
+
+func TestDefaultConfigResolvesProjectFromEnvironment(t *testing.T) {
+	t.Setenv(projectEnv, "env-project")
+	stubMetadataProjectID(t, "metadata-project", nil)
+	var got string
+	stubClientFactory(t, func(ctx context.Context, projectID string, opts ...option.ClientOption) (*bigquery.Client, error) {
+		got = projectID
+		return &bigquery.Client{}, nil
+	})
+	cfg := NewFactory().CreateDefaultConfig().(*Config)
+	require.Empty(t, cfg.ProjectID, "The default config should leave the project to be resolved")
+
+	_, err := newBigQuerySender(cfg, cfg.Table, componenttest.NewNopTelemetrySettings())
+	require.NoError(t, err)
+
+	assert.Equal(t, "env-project", got, "An unset projectID should resolve from the environment")
+}
@@ -0,0 +1,119 @@
+package bigquery
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"cloud.google.com/go/storage"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.uber.org/zap"
+)
+
+/*
+With GCSFallbackBucket, rows that fail to insert with a permanent error, e.g.
+access denied or a missing table, are written to the bucket as
+newline-delimited JSON rather than dropped, to be loaded into their tables
+later, e.g. with
+
+	bq load --source_format=NEWLINE_DELIMITED_JSON
+
+Each failed send writes an object per destination table, named
+
+	<table>/<yyyy>/<mm>/<dd>/<hh>/<unix nanoseconds>-<random>.ndjson
+
+in UTC, with the rows as they would have been inserted. Timestamps are
+written as RFC 3339 strings, which load jobs parse as TIMESTAMPs.
+
+Rows that failed with other errors are retried by the retry queue, and
+aren't written when the retries are exhausted. Rows of a failed send that
+were inserted before it failed, e.g. into another routed table, are written
+too, so loads should deduplicate, e.g. on trace_id and span_id.
+*/
+
+// Objects in the fallback bucket. Satisfied by gcsBucket.
+type objectWriter interface {
+	writeObject(ctx context.Context, name string, data []byte) error
+}
+
+type gcsBucket struct {
+	handle *storage.BucketHandle
+}
+
+func (b gcsBucket) writeObject(ctx context.Context, name string, data []byte) error {
+	w := b.handle.Object(name).NewWriter(ctx)
+	w.ContentType = "application/x-ndjson"
+	_, err := w.Write(data)
+	// The object is only created once the writer is closed.
+	return errors.Join(err, w.Close())
+}
+
+type gcsFallback struct {
+	bucket string
+	writer objectWriter
+	// Closed at shutdown. Nil in tests.
+	client *storage.Client
+}
+
+// Creates the GCS client. Replaced in tests.
+var newStorageClient = storage.NewClient
+
+// Write rows that failed to insert into the sender's table to the fallback
+// bucket. Failures are logged rather than returned, like dead-letter
+// failures: the rows were already given up on.
+func (sender *bigquerySender) writeFallback(ctx context.Context, rows []bigqueryrow) {
+	if sender.fallback == nil || len(rows) == 0 {
+		return
+	}
+
+	var data bytes.Buffer
+	for _, row := range rows {
+		data.WriteString(deadLetterJSON(fallbackRow(row)))
+		data.WriteByte('\n')
+	}
+	name := fallbackObjectName(sender.tableID, time.Now())
+	if err := sender.fallback.writer.writeObject(ctx, name, data.Bytes()); err != nil {
+		sender.logger.Error("Failed to write rows to the GCS fallback bucket",
+			zap.String("bucket", sender.fallback.bucket),
+			zap.String("object", name),
+			zap.Int("rows", len(rows)),
+			zap.Error(err))
+		return
+	}
+	sender.logger.Warn("Rows that couldn't be inserted were written to the GCS fallback bucket",
+		zap.String("table", sender.tableID),
+		zap.String("bucket", sender.fallback.bucket),
+		zap.String("object", name),
+		zap.Int("rows", len(rows)))
+}
+
+// The object for rows of table that failed at now. The random suffix keeps
+// collectors writing at the same time from overwriting each other's objects.
+func fallbackObjectName(table string, now time.Time) string {
+	suffix := make([]byte, 4)
+	rand.Read(suffix)
+	now = now.UTC()
+	return fmt.Sprintf("%s/%s/%d-%s.ndjson", table, now.Format("2006/01/02/15"), now.UnixNano(), hex.EncodeToString(suffix))
+}
+
+// A copy of row with timestamps as time.Time, which serializes as RFC 3339,
+// rather than as the nanosecond counts they're held as.
+func fallbackRow(row map[string]bigquery.Value) map[string]bigquery.Value {
+	out := make(map[string]bigquery.Value, len(row))
+	for k, v := range row {
+		switch v := v.(type) {
+		case pcommon.Timestamp:
+			out[k] = v.AsTime().UTC()
+		case map[string]bigquery.Value:
+			out[k] = fallbackRow(v)
+		default:
+			out[k] = v
+		}
+	}
+	return out
+}
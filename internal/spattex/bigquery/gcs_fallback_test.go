@@ -0,0 +1,87 @@
+package bigquery
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+	"google.golang.org/api/googleapi"
+)
+
+func TestPermanentFailureWrittenToGCSFallback(t *testing.T) {
+	accessErr := &googleapi.Error{Code: http.StatusForbidden, Errors: []googleapi.ErrorItem{{Reason: "accessDenied"}}}
+	bucket := &fakeBucket{}
+	sender := newTestSender(t, withInserter(&fakeInserter{errs: []error{accessErr}}), withFallback(bucket))
+	rows := []bigqueryrow{
+		{"name": "span1", "ts": pcommon.Timestamp(1_706_702_400_000_000_500)},
+		{"name": "span2", "ts": pcommon.Timestamp(1_706_702_401_000_000_000)},
+	}
+
+	err := sender.sendRows(context.Background(), rows)
+
+	require.Error(t, err)
+	require.Len(t, bucket.objects, 1, "The failed rows should be written to one object")
+	for name, data := range bucket.objects {
+		assert.Regexp(t, `^spattex_test/\d{4}/\d{2}/\d{2}/\d{2}/\d+-[0-9a-f]{8}\.ndjson$`, name)
+		lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+		require.Len(t, lines, 2, "Each row should be a line of JSON")
+		assert.JSONEq(t, `{"name": "span1", "ts": "2024-01-31T12:00:00.0000005Z"}`, lines[0])
+		assert.JSONEq(t, `{"name": "span2", "ts": "2024-01-31T12:00:01Z"}`, lines[1])
+	}
+}
+
+func TestTransientFailureNotWrittenToGCSFallback(t *testing.T) {
+	serverErr := &googleapi.Error{Code: http.StatusServiceUnavailable}
+	bucket := &fakeBucket{}
+	sender := newTestSender(t, withInserter(&fakeInserter{errs: []error{serverErr}}), withFallback(bucket))
+
+	require.Error(t, sender.sendRows(context.Background(), []bigqueryrow{{"name": "span1"}}))
+
+	assert.Empty(t, bucket.objects, "Rows that will be retried should not be written")
+}
+
+func TestGCSFallbackFailureLogged(t *testing.T) {
+	notFound := &googleapi.Error{Code: http.StatusNotFound, Message: "Not found: Table msyvr:otelex.spattex_test"}
+	bucket := &fakeBucket{err: errors.New("bucket not found")}
+	sender := newTestSender(t, withInserter(&fakeInserter{errs: []error{notFound}}), withFallback(bucket))
+	core, logs := observer.New(zap.ErrorLevel)
+	sender.logger = zap.New(core)
+
+	err := sender.sendRows(context.Background(), []bigqueryrow{{"name": "span1"}})
+
+	require.Error(t, err)
+	assert.Equal(t, 1, logs.FilterMessage("Failed to write rows to the GCS fallback bucket").Len())
+}
+
+// Fake bucket that records the objects written to it
+type fakeBucket struct {
+	objects map[string][]byte
+	err     error
+}
+
+func (f *fakeBucket) writeObject(ctx context.Context, name string, data []byte) error {
+	if f.err != nil {
+		return f.err
+	}
+	if f.objects == nil {
+		f.objects = make(map[string][]byte)
+	}
+	f.objects[name] = data
+	return nil
+}
+
+func TestFallbackRowNestedTimestamps(t *testing.T) {
+	row := fallbackRow(bigqueryrow{
+		"resource": map[string]bigquery.Value{"ts": pcommon.Timestamp(1_706_702_400_000_000_000)},
+	})
+
+	assert.JSONEq(t, `{"resource": {"ts": "2024-01-31T12:00:00Z"}}`, deadLetterJSON(row))
+}
@@ -0,0 +1,85 @@
+package bigquery
+
+import (
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Configures a sender built by newTestSender.
+type testSenderOption func(*bigquerySender)
+
+// Helper function to create a sender for tests, with createTestConfig and no
+// clients. Options apply in order, so withConfig must come first.
+func newTestSender(t *testing.T, opts ...testSenderOption) *bigquerySender {
+	t.Helper()
+	sender := &bigquerySender{
+		Config: createTestConfig(),
+		logger: zap.NewNop(),
+	}
+	for _, opt := range opts {
+		opt(sender)
+	}
+	if sender.tableID == "" {
+		sender.tableID = sender.Table
+	}
+	if sender.rows == nil {
+		sender.rows = newRowBuilder(sender.Config, sender.logger)
+	}
+	return sender
+}
+
+func withConfig(cfg *Config) testSenderOption {
+	return func(s *bigquerySender) { s.Config = cfg }
+}
+
+func withInserter(inserter rowInserter) testSenderOption {
+	return func(s *bigquerySender) { s.inserter = inserter }
+}
+
+// Fake dataset and table clients, e.g. for table creation.
+func withTableClients(dataset datasetManager, table schemaManager) testSenderOption {
+	return func(s *bigquerySender) {
+		s.datasetManager = dataset
+		s.schemaManager = table
+	}
+}
+
+func withDeadLetters(inserter rowInserter) testSenderOption {
+	return func(s *bigquerySender) {
+		s.DeadLetterTable = "spattex_dead_letters"
+		s.deadLetters = &deadLetterSink{tableID: s.DeadLetterTable, inserter: inserter}
+	}
+}
+
+func withFallback(bucket objectWriter) testSenderOption {
+	return func(s *bigquerySender) {
+		s.GCSFallbackBucket = "otelex-fallback"
+		s.fallback = &gcsFallback{bucket: s.GCSFallbackBucket, writer: bucket}
+	}
+}
+
+func withInternalBatch(maxRows int, flushInterval time.Duration) testSenderOption {
+	return func(s *bigquerySender) {
+		s.InternalBatch = InternalBatchConfig{MaxRows: maxRows, FlushInterval: flushInterval}
+		s.buffer = &rowBuffer{}
+	}
+}
+
+// A ResourceTable, resources, with its own inserter.
+func withResourceTable(inserter rowInserter) testSenderOption {
+	return func(s *bigquerySender) {
+		s.ResourceTable = "resources"
+		s.resources = &bigquerySender{
+			Config:   s.Config,
+			tableID:  s.ResourceTable,
+			logger:   s.logger,
+			inserter: inserter,
+		}
+	}
+}
+
+func withTelemetry(telemetry *exporterTelemetry) testSenderOption {
+	return func(s *bigquerySender) { s.telemetry = telemetry }
+}
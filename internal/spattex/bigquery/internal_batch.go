@@ -0,0 +1,141 @@
+package bigquery
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+/*
+With InternalBatch, rows from small exports are coalesced before they're
+inserted, for pipelines without a batch processor. Rows are buffered until
+there are MaxRows of them, when the export that filled the buffer inserts
+them, or until FlushInterval after the first row was buffered, when they're
+inserted in the background. Shutdown inserts whatever is left.
+
+Exports return once their rows are buffered, so the retry queue can't retry
+rows whose insert later fails: failed flushes are logged, and the rows are
+dropped. Rows that can never be inserted are still dead-lettered.
+*/
+
+type InternalBatchConfig struct {
+	// Rows buffered before they're inserted. Zero (default) disables
+	// internal batching.
+	MaxRows int `mapstructure:"maxRows"`
+
+	// Longest rows are buffered before they're inserted, however few there
+	// are. Required with MaxRows.
+	FlushInterval time.Duration `mapstructure:"flushInterval"`
+}
+
+// Rows buffered by InternalBatch.
+type rowBuffer struct {
+	mu   sync.Mutex
+	rows []bigqueryrow
+	// Flushes the buffer after FlushInterval. Set when the first row is
+	// buffered.
+	timer *time.Timer
+	// Set at shutdown, after which rows are sent as they arrive.
+	closed bool
+}
+
+// The buffered rows, emptying the buffer and stopping its timer. The buffer
+// must be locked.
+func (b *rowBuffer) take() []bigqueryrow {
+	rows := b.rows
+	b.rows = nil
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+	return rows
+}
+
+// Send rows, or with InternalBatch, buffer them, inserting the buffered rows
+// if there are now MaxRows of them. Attribute values dropped building the
+// rows are reported as they're buffered.
+func (s *bigquerySender) sendOrBufferRows(ctx context.Context, rows []bigqueryrow) error {
+	if s.buffer == nil {
+		return s.sendRows(ctx, rows)
+	}
+
+	s.buffer.mu.Lock()
+	if s.buffer.closed {
+		s.buffer.mu.Unlock()
+		return s.sendRows(ctx, rows)
+	}
+	s.reportAttributeDrops(ctx, attributeDropsFromContext(ctx))
+	s.buffer.rows = append(s.buffer.rows, rows...)
+	if len(s.buffer.rows) < s.InternalBatch.MaxRows {
+		if s.buffer.timer == nil {
+			s.buffer.timer = time.AfterFunc(s.InternalBatch.FlushInterval, s.flushOnTimer)
+		}
+		s.buffer.mu.Unlock()
+		return nil
+	}
+	rows = s.buffer.take()
+	s.buffer.mu.Unlock()
+
+	s.flushRows(ctx, rows)
+	return nil
+}
+
+// Insert the buffered rows, FlushInterval after the first was buffered. The
+// timer may fire as shutdown stops it, so the flush is counted as in
+// progress with the buffer locked, before shutdown can close it and wait for
+// exports in progress. Once it's closed, shutdown inserts the rows instead.
+func (s *bigquerySender) flushOnTimer() {
+	s.buffer.mu.Lock()
+	if s.buffer.closed {
+		s.buffer.mu.Unlock()
+		return
+	}
+	s.inflight.Add(1)
+	defer s.inflight.Done()
+	rows := s.buffer.take()
+	s.buffer.mu.Unlock()
+	if len(rows) == 0 {
+		return
+	}
+
+	ctx := context.Background()
+	if s.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.Timeout)
+		defer cancel()
+	}
+	s.flushRows(ctx, rows)
+}
+
+// Insert buffered rows, logging rather than returning the error: the exports
+// they came from have returned.
+func (s *bigquerySender) flushRows(ctx context.Context, rows []bigqueryrow) {
+	if err := s.sendRows(ctx, rows); err != nil {
+		s.logger.Error("Buffered rows couldn't be inserted, and are dropped",
+			zap.String("table", s.tableID),
+			zap.Int("rows", len(rows)),
+			zap.Error(err))
+	}
+}
+
+// Insert the rows left in the buffer at shutdown. Rows from exports still in
+// progress are sent as they arrive.
+func (s *bigquerySender) flushBuffer(ctx context.Context) error {
+	if s.buffer == nil {
+		return nil
+	}
+	s.buffer.mu.Lock()
+	s.buffer.closed = true
+	rows := s.buffer.take()
+	s.buffer.mu.Unlock()
+	if len(rows) == 0 {
+		return nil
+	}
+	if err := s.sendRows(ctx, rows); err != nil {
+		return fmt.Errorf("insert %d buffered rows: %w", len(rows), err)
+	}
+	return nil
+}
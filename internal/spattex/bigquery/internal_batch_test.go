@@ -0,0 +1,61 @@
+package bigquery
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInternalBatchFlushesOnMaxRows(t *testing.T) {
+	inserter := &fakeInserter{}
+	sender := newTestSender(t, withInserter(inserter), withInternalBatch(4, time.Hour))
+
+	require.NoError(t, sender.consumeTraces(context.Background(), createTestTraces()))
+	assert.Empty(t, inserter.putSizes, "Rows should be buffered until there are maxRows")
+
+	require.NoError(t, sender.consumeTraces(context.Background(), createTestTraces()))
+	assert.Equal(t, []int{4}, inserter.putSizes, "Buffered rows should be inserted together once there are maxRows")
+	assert.Nil(t, sender.buffer.timer, "The flush interval should restart with the next buffered row")
+}
+
+func TestInternalBatchFlushesOnInterval(t *testing.T) {
+	put := make(chan struct{}, 1)
+	inserter := &fakeInserter{onPut: func() { put <- struct{}{} }}
+	sender := newTestSender(t, withInserter(inserter), withInternalBatch(100, 10*time.Millisecond))
+
+	require.NoError(t, sender.consumeTraces(context.Background(), createTestTraces()))
+
+	select {
+	case <-put:
+	case <-time.After(time.Second):
+		t.Fatal("Buffered rows should be inserted after the flush interval")
+	}
+	assert.Equal(t, []int{2}, inserter.putSizes)
+}
+
+func TestShutdownFlushesInternalBatch(t *testing.T) {
+	inserter := &fakeInserter{}
+	sender := newTestSender(t, withInserter(inserter), withInternalBatch(100, time.Hour))
+
+	require.NoError(t, sender.consumeTraces(context.Background(), createTestTraces()))
+	require.NoError(t, sender.shutdown(context.Background()))
+
+	assert.Equal(t, []int{2}, inserter.putSizes, "Shutdown should insert the buffered rows")
+	require.NoError(t, sender.consumeTraces(context.Background(), createTestTraces()))
+	assert.Equal(t, []int{2, 2}, inserter.putSizes, "Rows arriving after shutdown should be sent, not buffered")
+}
+
+func TestInternalBatchTimerAfterShutdown(t *testing.T) {
+	inserter := &fakeInserter{}
+	sender := newTestSender(t, withInserter(inserter), withInternalBatch(100, time.Hour))
+	require.NoError(t, sender.shutdown(context.Background()))
+
+	// A timer that fired as shutdown stopped it finds the buffer closed.
+	sender.buffer.rows = []bigqueryrow{{"name": "span1"}}
+	sender.flushOnTimer()
+
+	assert.Empty(t, inserter.putSizes, "A flush after shutdown should leave the rows to shutdown")
+}
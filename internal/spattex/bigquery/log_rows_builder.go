@@ -0,0 +1,46 @@
+package bigquery
+
+import (
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/plog"
+)
+
+// The OpenTelemetry plog.Logs type nests log records the same way spans are
+// nested in ptrace.Traces. Each log record becomes one row.
+func (b *rowBuilder) buildLogRows(ld plog.Logs) []bigqueryrow {
+	var rows []bigqueryrow
+	rlogs := ld.ResourceLogs()
+	for i := 0; i < rlogs.Len(); i++ {
+		rlog := rlogs.At(i)
+		slogs := rlog.ScopeLogs()
+		for j := 0; j < slogs.Len(); j++ {
+			slog := slogs.At(j)
+			records := slog.LogRecords()
+			for k := 0; k < records.Len(); k++ {
+				record := records.At(k)
+				ts := logTimestamp(record)
+				row := bigqueryrow{
+					"body":             record.Body().AsString(),
+					"severity_text":    record.SeverityText(),
+					"severity_number":  int64(record.SeverityNumber()),
+					"trace_id":         record.TraceID().String(),
+					"span_id":          record.SpanID().String(),
+					b.partitionField(): ts,
+				}
+				b.addRowAttributes(row, rlog.Resource(), slog.Scope(), record.Attributes())
+				rows = append(rows, row)
+			}
+		}
+	}
+
+	return rows
+}
+
+// The record's event time or, as not all sources set it, the time the
+// collector observed the record.
+func logTimestamp(record plog.LogRecord) pcommon.Timestamp {
+	if ts := record.Timestamp(); ts != 0 {
+		return ts
+	}
+	return record.ObservedTimestamp()
+}
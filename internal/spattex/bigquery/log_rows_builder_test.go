@@ -0,0 +1,110 @@
+package bigquery
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/plog"
+)
+
+func TestBuildLogRows(t *testing.T) {
+	// Create test logs with known values
+	logs := createTestLogs()
+
+	// Build rows from the logs
+	rows := testRowBuilder().buildLogRows(logs)
+
+	// Validate the results
+	assert.Equal(t, 2, len(rows), "Should have created 2 rows")
+
+	// Verify first row
+	assert.Equal(t, "log1", rows[0]["body"], "First row body should be 'log1'")
+	assert.Equal(t, "INFO", rows[0]["severity_text"], "Severity text should be properly added")
+	assert.Equal(t, int64(plog.SeverityNumberInfo), rows[0]["severity_number"], "Severity number should be properly added")
+	assert.Equal(t, pcommon.Timestamp(1000), rows[0]["ts"], "Timestamp should be properly added")
+	assert.Equal(t, "0102030405060708090a0b0c0d0e0f10", rows[0]["trace_id"], "Trace ID should be properly added")
+	assert.Equal(t, "0102030405060708", rows[0]["span_id"], "Span ID should be properly added")
+	assert.Equal(t, "service1", rows[0]["service_name"], "Resource attribute should be properly added")
+	assert.Equal(t, "value1", rows[0]["str_key"], "Log attribute should be properly added")
+
+	// Verify second row
+	assert.Equal(t, "log2", rows[1]["body"], "Second row body should be 'log2'")
+	assert.Equal(t, "ERROR", rows[1]["severity_text"], "Severity text should be properly added")
+	assert.Equal(t, pcommon.Timestamp(2500), rows[1]["ts"], "Observed timestamp should be used when timestamp is unset")
+	assert.Equal(t, "", rows[1]["trace_id"], "Unset trace ID should be empty")
+	assert.Equal(t, "service1", rows[1]["service_name"], "Resource attribute should be properly added")
+	assert.Equal(t, int64(42), rows[1]["int_key"], "Int attribute should be properly added")
+}
+
+func TestBuildLogRowsMapBody(t *testing.T) {
+	logs := plog.NewLogs()
+	record := logs.ResourceLogs().AppendEmpty().ScopeLogs().AppendEmpty().LogRecords().AppendEmpty()
+	record.Body().SetEmptyMap().PutStr("msg", "hello")
+
+	rows := testRowBuilder().buildLogRows(logs)
+
+	assert.Equal(t, `{"msg":"hello"}`, rows[0]["body"], "Structured bodies should be serialized to JSON")
+}
+
+func TestEmptyLogs(t *testing.T) {
+	// Test with empty logs
+	logs := plog.NewLogs()
+	rows := testRowBuilder().buildLogRows(logs)
+
+	assert.Equal(t, 0, len(rows), "Empty logs should produce no rows")
+}
+
+func TestMultipleResourceLogs(t *testing.T) {
+	logs := plog.NewLogs()
+
+	// Add first resource log
+	rl1 := logs.ResourceLogs().AppendEmpty()
+	rl1.Resource().Attributes().PutStr("service.name", "service1")
+	rl1.ScopeLogs().AppendEmpty().LogRecords().AppendEmpty().Body().SetStr("log1")
+
+	// Add second resource log
+	rl2 := logs.ResourceLogs().AppendEmpty()
+	rl2.Resource().Attributes().PutStr("service.name", "service2")
+	rl2.ScopeLogs().AppendEmpty().LogRecords().AppendEmpty().Body().SetStr("log2")
+
+	rows := testRowBuilder().buildLogRows(logs)
+
+	assert.Equal(t, 2, len(rows), "Should have 2 rows")
+	assert.Equal(t, "service1", rows[0]["service_name"], "First row should have service1")
+	assert.Equal(t, "service2", rows[1]["service_name"], "Second row should have service2")
+}
+
+// Helper function to create test logs with predictable data
+func createTestLogs() plog.Logs {
+	logs := plog.NewLogs()
+
+	// Add a resource log
+	rl := logs.ResourceLogs().AppendEmpty()
+	rl.Resource().Attributes().PutStr("service.name", "service1")
+
+	// Add a scope log
+	sl := rl.ScopeLogs().AppendEmpty()
+	sl.Scope().SetName("test_scope")
+
+	// Add first log record
+	log1 := sl.LogRecords().AppendEmpty()
+	log1.Body().SetStr("log1")
+	log1.SetSeverityText("INFO")
+	log1.SetSeverityNumber(plog.SeverityNumberInfo)
+	log1.SetTimestamp(1000)
+	log1.SetObservedTimestamp(1500)
+	log1.SetTraceID(pcommon.TraceID{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16})
+	log1.SetSpanID(pcommon.SpanID{1, 2, 3, 4, 5, 6, 7, 8})
+	log1.Attributes().PutStr("str_key", "value1")
+
+	// Add second log record
+	log2 := sl.LogRecords().AppendEmpty()
+	log2.Body().SetStr("log2")
+	log2.SetSeverityText("ERROR")
+	log2.SetSeverityNumber(plog.SeverityNumberError)
+	log2.SetObservedTimestamp(2500)
+	log2.Attributes().PutInt("int_key", 42)
+
+	return logs
+}
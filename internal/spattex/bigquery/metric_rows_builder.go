@@ -0,0 +1,88 @@
+package bigquery
+
+import (
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/pmetric"
+)
+
+// Flatten each gauge, sum, and histogram data point into a row. Other metric
+// types are skipped.
+func (b *rowBuilder) buildMetricRows(md pmetric.Metrics) []bigqueryrow {
+	var rows []bigqueryrow
+	rmetrics := md.ResourceMetrics()
+	for i := 0; i < rmetrics.Len(); i++ {
+		rmetric := rmetrics.At(i)
+		smetrics := rmetric.ScopeMetrics()
+		for j := 0; j < smetrics.Len(); j++ {
+			smetric := smetrics.At(j)
+			metrics := smetric.Metrics()
+			for k := 0; k < metrics.Len(); k++ {
+				metric := metrics.At(k)
+				switch metric.Type() {
+				case pmetric.MetricTypeGauge:
+					rows = b.appendNumberPointRows(rows, rmetric.Resource(), smetric.Scope(), metric, metric.Gauge().DataPoints())
+				case pmetric.MetricTypeSum:
+					rows = b.appendNumberPointRows(rows, rmetric.Resource(), smetric.Scope(), metric, metric.Sum().DataPoints())
+				case pmetric.MetricTypeHistogram:
+					rows = b.appendHistogramPointRows(rows, rmetric.Resource(), smetric.Scope(), metric, metric.Histogram().DataPoints())
+				}
+			}
+		}
+	}
+
+	return rows
+}
+
+// Start a data point row with the columns common to all metric types.
+// Attributes are added once the point's value columns are set, so they can't
+// overwrite them.
+func (b *rowBuilder) newMetricRow(metric pmetric.Metric, ts pcommon.Timestamp) bigqueryrow {
+	return bigqueryrow{
+		"metric_name":      metric.Name(),
+		"metric_type":      metric.Type().String(),
+		"metric_unit":      metric.Unit(),
+		b.partitionField(): ts,
+	}
+}
+
+// Int and double values share a FLOAT column so that a metric's values
+// can be queried together.
+func (b *rowBuilder) appendNumberPointRows(rows []bigqueryrow, resource pcommon.Resource, scope pcommon.InstrumentationScope, metric pmetric.Metric, points pmetric.NumberDataPointSlice) []bigqueryrow {
+	for i := 0; i < points.Len(); i++ {
+		point := points.At(i)
+		row := b.newMetricRow(metric, point.Timestamp())
+		switch point.ValueType() {
+		case pmetric.NumberDataPointValueTypeDouble:
+			row["value"] = point.DoubleValue()
+		case pmetric.NumberDataPointValueTypeInt:
+			row["value"] = float64(point.IntValue())
+		}
+		b.addRowAttributes(row, resource, scope, point.Attributes())
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// Histogram buckets are structured, so bucket bounds and counts are stored
+// as JSON array strings.
+func (b *rowBuilder) appendHistogramPointRows(rows []bigqueryrow, resource pcommon.Resource, scope pcommon.InstrumentationScope, metric pmetric.Metric, points pmetric.HistogramDataPointSlice) []bigqueryrow {
+	for i := 0; i < points.Len(); i++ {
+		point := points.At(i)
+		row := b.newMetricRow(metric, point.Timestamp())
+		row["count"] = int64(point.Count())
+		row["bucket_bounds"] = jsonString(point.ExplicitBounds().AsRaw())
+		row["bucket_counts"] = jsonString(point.BucketCounts().AsRaw())
+		if point.HasSum() {
+			row["sum"] = point.Sum()
+		}
+		if point.HasMin() {
+			row["min"] = point.Min()
+		}
+		if point.HasMax() {
+			row["max"] = point.Max()
+		}
+		b.addRowAttributes(row, resource, scope, point.Attributes())
+		rows = append(rows, row)
+	}
+	return rows
+}
@@ -0,0 +1,107 @@
+package bigquery
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/pmetric"
+)
+
+func TestBuildMetricRowsGauge(t *testing.T) {
+	metrics := createTestMetrics()
+	gauge := metrics.ResourceMetrics().At(0).ScopeMetrics().At(0).Metrics().AppendEmpty()
+	gauge.SetName("cpu.utilization")
+	gauge.SetUnit("1")
+	dp := gauge.SetEmptyGauge().DataPoints().AppendEmpty()
+	dp.SetTimestamp(1000)
+	dp.SetDoubleValue(0.75)
+	dp.Attributes().PutStr("cpu", "0")
+
+	rows := testRowBuilder().buildMetricRows(metrics)
+
+	assert.Equal(t, 1, len(rows), "Should have created 1 row")
+	assert.Equal(t, "cpu.utilization", rows[0]["metric_name"], "Metric name should be properly added")
+	assert.Equal(t, "Gauge", rows[0]["metric_type"], "Metric type should be properly added")
+	assert.Equal(t, "1", rows[0]["metric_unit"], "Metric unit should be properly added")
+	assert.Equal(t, pcommon.Timestamp(1000), rows[0]["ts"], "Timestamp should be properly added")
+	assert.Equal(t, 0.75, rows[0]["value"], "Double value should be properly added")
+	assert.Equal(t, "0", rows[0]["cpu"], "Data point attribute should be properly added")
+	assert.Equal(t, "service1", rows[0]["service_name"], "Resource attribute should be properly added")
+}
+
+func TestBuildMetricRowsSum(t *testing.T) {
+	metrics := createTestMetrics()
+	sum := metrics.ResourceMetrics().At(0).ScopeMetrics().At(0).Metrics().AppendEmpty()
+	sum.SetName("http.requests")
+	points := sum.SetEmptySum().DataPoints()
+	dp1 := points.AppendEmpty()
+	dp1.SetTimestamp(1000)
+	dp1.SetIntValue(41)
+	dp2 := points.AppendEmpty()
+	dp2.SetTimestamp(2000)
+	dp2.SetIntValue(42)
+
+	rows := testRowBuilder().buildMetricRows(metrics)
+
+	assert.Equal(t, 2, len(rows), "Should have a row per data point")
+	assert.Equal(t, "http.requests", rows[0]["metric_name"])
+	assert.Equal(t, "Sum", rows[0]["metric_type"])
+	assert.Equal(t, 41.0, rows[0]["value"], "Int value should be stored as a float")
+	assert.Equal(t, 42.0, rows[1]["value"], "Int value should be stored as a float")
+	assert.Equal(t, pcommon.Timestamp(2000), rows[1]["ts"])
+}
+
+func TestBuildMetricRowsHistogram(t *testing.T) {
+	metrics := createTestMetrics()
+	histogram := metrics.ResourceMetrics().At(0).ScopeMetrics().At(0).Metrics().AppendEmpty()
+	histogram.SetName("http.duration")
+	dp := histogram.SetEmptyHistogram().DataPoints().AppendEmpty()
+	dp.SetTimestamp(1000)
+	dp.SetCount(6)
+	dp.SetSum(12.5)
+	dp.ExplicitBounds().FromRaw([]float64{1, 5})
+	dp.BucketCounts().FromRaw([]uint64{1, 2, 3})
+
+	rows := testRowBuilder().buildMetricRows(metrics)
+
+	assert.Equal(t, 1, len(rows), "Should have created 1 row")
+	assert.Equal(t, "Histogram", rows[0]["metric_type"])
+	assert.Equal(t, int64(6), rows[0]["count"])
+	assert.Equal(t, 12.5, rows[0]["sum"])
+	assert.Equal(t, "[1,5]", rows[0]["bucket_bounds"], "Bucket bounds should be serialized to JSON")
+	assert.Equal(t, "[1,2,3]", rows[0]["bucket_counts"], "Bucket counts should be serialized to JSON")
+	assert.NotContains(t, rows[0], "min", "Unset min should be omitted")
+}
+
+func TestBuildMetricRowsRemapsReservedColumns(t *testing.T) {
+	metrics := pmetric.NewMetrics()
+	gauge := metrics.ResourceMetrics().AppendEmpty().ScopeMetrics().AppendEmpty().Metrics().AppendEmpty()
+	gauge.SetName("queue.depth")
+	point := gauge.SetEmptyGauge().DataPoints().AppendEmpty()
+	point.SetDoubleValue(3)
+	point.Attributes().PutStr("value", "attribute_value")
+
+	rows := testRowBuilder().buildMetricRows(metrics)
+
+	assert.Equal(t, 3.0, rows[0]["value"], "An attribute named value should not clobber the point value")
+	assert.Equal(t, "attribute_value", rows[0]["attr_value"])
+}
+
+func TestEmptyMetrics(t *testing.T) {
+	// Test with empty metrics
+	metrics := pmetric.NewMetrics()
+	rows := testRowBuilder().buildMetricRows(metrics)
+
+	assert.Equal(t, 0, len(rows), "Empty metrics should produce no rows")
+}
+
+// Helper function to create test metrics with a resource and scope but no
+// metrics, for tests to add their own
+func createTestMetrics() pmetric.Metrics {
+	metrics := pmetric.NewMetrics()
+	rm := metrics.ResourceMetrics().AppendEmpty()
+	rm.Resource().Attributes().PutStr("service.name", "service1")
+	rm.ScopeMetrics().AppendEmpty().Scope().SetName("test_scope")
+	return metrics
+}
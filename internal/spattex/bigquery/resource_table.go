@@ -0,0 +1,137 @@
+package bigquery
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/plog"
+	"go.opentelemetry.io/collector/pdata/pmetric"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+)
+
+/*
+With ResourceTable, resources are normalized into a dimension table: each
+resource is written once per batch, as a row of its attributes keyed by
+resource_id, a hash of the attributes, and span (or log, data point) rows
+carry the resource_id instead of the resource attributes. The same resource
+is written again by later batches, so queries should deduplicate resource
+rows by resource_id, e.g.:
+
+SELECT * FROM resources WHERE true
+QUALIFY ROW_NUMBER() OVER (PARTITION BY resource_id ORDER BY ts DESC) = 1
+*/
+
+// The column holding a resource's ID, in resource rows and the rows that
+// reference them.
+const resourceIDColumn = "resource_id"
+
+// A stable ID for the resource, from its attributes: resources with the same
+// attributes, in any order, have the same ID.
+func resourceID(resource pcommon.Resource) string {
+	attrs := resource.Attributes()
+	keys := make([]string, 0, attrs.Len())
+	attrs.Range(func(k string, _ pcommon.Value) bool {
+		keys = append(keys, k)
+		return true
+	})
+	sort.Strings(keys)
+
+	h := fnv.New128a()
+	for _, k := range keys {
+		v, _ := attrs.Get(k)
+		s := v.AsString()
+		// Length prefixed, so keys and values can't run together.
+		fmt.Fprintf(h, "%d:%s%d:%d:%s", len(k), k, v.Type(), len(s), s)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Build a row for each distinct resource, with its ID, its attributes,
+// flattened, and the partition field set to the current time.
+func (b *rowBuilder) buildResourceRows(resources []pcommon.Resource) []bigqueryrow {
+	now := pcommon.NewTimestampFromTime(time.Now())
+	seen := make(map[string]bool, len(resources))
+	var rows []bigqueryrow
+	for _, resource := range resources {
+		id := resourceID(resource)
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+
+		row := make(bigqueryrow, resource.Attributes().Len()+2)
+		row[resourceIDColumn] = id
+		row[b.partitionField()] = now
+		sources := columnSources{resourceIDColumn: "", b.partitionField(): ""}
+		b.addAttributes(row, sources, resource.Attributes(), b.resourceAttributeColumn)
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+func traceResources(td ptrace.Traces) []pcommon.Resource {
+	resources := make([]pcommon.Resource, td.ResourceSpans().Len())
+	for i := range resources {
+		resources[i] = td.ResourceSpans().At(i).Resource()
+	}
+	return resources
+}
+
+func logResources(ld plog.Logs) []pcommon.Resource {
+	resources := make([]pcommon.Resource, ld.ResourceLogs().Len())
+	for i := range resources {
+		resources[i] = ld.ResourceLogs().At(i).Resource()
+	}
+	return resources
+}
+
+func metricResources(md pmetric.Metrics) []pcommon.Resource {
+	resources := make([]pcommon.Resource, md.ResourceMetrics().Len())
+	for i := range resources {
+		resources[i] = md.ResourceMetrics().At(i).Resource()
+	}
+	return resources
+}
+
+// Add the sender for the ResourceTable, if one is configured. It shares the
+// sender's clients, rate limiter, telemetry and dead letter table.
+func (s *bigquerySender) addResourceTable() {
+	if s.ResourceTable == "" {
+		return
+	}
+	s.resources = newTableSender(s.Config, s.bigqueryClient, s.writeClient, s.ResourceTable, s.logger)
+	s.resources.limiter = s.limiter
+	s.resources.telemetry = s.telemetry
+	s.resources.deadLetters = s.deadLetters
+	s.resources.fallback = s.fallback
+}
+
+// Send the batch's resource rows to the ResourceTable, if one is configured.
+// They're sent before the rows that reference them.
+func (s *bigquerySender) sendResourceRows(ctx context.Context, builder *rowBuilder, resources []pcommon.Resource) error {
+	if s.resources == nil {
+		return nil
+	}
+	return s.resources.sendRows(ctx, builder.buildResourceRows(resources))
+}
+
+// The schema for a new ResourceTable: the resource ID and the partition
+// field. Attribute columns are added as they're seen if the schema is
+// flexible. Resource rows have no RangePartitioning field, so the table is
+// partitioned by time regardless.
+func newResourceTableMetadata(cfg *Config) *bigquery.TableMetadata {
+	meta := newTableMetadata(cfg)
+	meta.Schema = bigquery.Schema{
+		{Name: resourceIDColumn, Type: bigquery.StringFieldType},
+		{Name: cfg.partitionField(), Type: bigquery.TimestampFieldType},
+	}
+	meta.TimePartitioning = newTimePartitioning(cfg)
+	meta.RangePartitioning = nil
+	return meta
+}
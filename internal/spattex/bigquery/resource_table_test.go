@@ -0,0 +1,81 @@
+package bigquery
+
+import (
+	"context"
+	"testing"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+)
+
+func TestConsumeTracesWritesResourceRows(t *testing.T) {
+	spanInserter, resourceInserter := &fakeInserter{}, &fakeInserter{}
+	sender := newTestSender(t, withInserter(spanInserter), withResourceTable(resourceInserter))
+	traces := ptrace.NewTraces()
+	rs := traces.ResourceSpans().AppendEmpty()
+	rs.Resource().Attributes().PutStr("service.name", "checkout")
+	rs.Resource().Attributes().PutStr("host.name", "node-1")
+	spans := rs.ScopeSpans().AppendEmpty().Spans()
+	spans.AppendEmpty().SetName("span1")
+	spans.AppendEmpty().SetName("span2")
+
+	require.NoError(t, sender.consumeTraces(context.Background(), traces))
+
+	require.Len(t, resourceInserter.rows, 1, "Spans from the same resource should produce a single resource row")
+	resourceRow := savedRow(t, resourceInserter.rows[0])
+	assert.Equal(t, "checkout", resourceRow["service_name"])
+	assert.Equal(t, "node-1", resourceRow["host_name"])
+	assert.Contains(t, resourceRow, "ts")
+
+	require.Len(t, spanInserter.rows, 2)
+	for _, saver := range spanInserter.rows {
+		spanRow := savedRow(t, saver)
+		assert.Equal(t, resourceRow[resourceIDColumn], spanRow[resourceIDColumn], "Span rows should reference the resource row")
+		assert.NotContains(t, spanRow, "service_name", "Resource attributes should only be in the resource table")
+	}
+}
+
+func TestConsumeTracesDeduplicatesResourceRows(t *testing.T) {
+	resourceInserter := &fakeInserter{}
+	sender := newTestSender(t, withInserter(&fakeInserter{}), withResourceTable(resourceInserter))
+	traces := ptrace.NewTraces()
+	for _, service := range []string{"checkout", "cart", "checkout"} {
+		rs := traces.ResourceSpans().AppendEmpty()
+		rs.Resource().Attributes().PutStr("service.name", service)
+		rs.ScopeSpans().AppendEmpty().Spans().AppendEmpty()
+	}
+
+	require.NoError(t, sender.consumeTraces(context.Background(), traces))
+
+	assert.Equal(t, []int{2}, resourceInserter.putSizes, "Resources repeated within a batch should be written once")
+}
+
+func TestResourceIDIsStable(t *testing.T) {
+	first := pcommon.NewResource()
+	first.Attributes().PutStr("service.name", "checkout")
+	first.Attributes().PutInt("pid", 7)
+	second := pcommon.NewResource()
+	second.Attributes().PutInt("pid", 7)
+	second.Attributes().PutStr("service.name", "checkout")
+	other := pcommon.NewResource()
+	other.Attributes().PutStr("service.name", "checkout")
+	other.Attributes().PutStr("pid", "7")
+
+	assert.Equal(t, resourceID(first), resourceID(second), "Attribute order should not change the ID")
+	assert.NotEqual(t, resourceID(first), resourceID(other), "Value types should be part of the ID")
+}
+
+func TestResourceTableMetadata(t *testing.T) {
+	cfg := createTestConfig()
+	cfg.ResourceTable = "resources"
+	sender := &bigquerySender{Config: cfg, tableID: cfg.ResourceTable}
+
+	meta := sender.newTableMetadata()
+
+	assert.Equal(t, bigquery.StringFieldType, fieldType(meta.Schema, resourceIDColumn))
+	assert.Equal(t, bigquery.TimestampFieldType, fieldType(meta.Schema, "ts"))
+	assert.Len(t, meta.Schema, 2)
+}
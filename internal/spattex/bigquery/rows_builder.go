@@ -1,57 +1,662 @@
 package bigquery
 
 import (
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"maps"
+	"math"
 	"strings"
+	"time"
 
+	"cloud.google.com/go/bigquery"
 	"go.opentelemetry.io/collector/pdata/pcommon"
 	"go.opentelemetry.io/collector/pdata/ptrace"
+	"go.uber.org/zap"
 )
 
 // Enable row insertion into a BigQuery table by formatting each row
 // as a map, with keys matching the table schema fields. A batch of
 // rows may be inserted in one API call by creating an array of row-maps.
-type bigqueryrow map[string]interface{}
+type bigqueryrow map[string]bigquery.Value
+
+// Save implements bigquery.ValueSaver. The empty insertID leaves the inserter
+// to assign a random one, so rows resent on retry aren't deduplicated.
+func (row bigqueryrow) Save() (map[string]bigquery.Value, string, error) {
+	return row, "", nil
+}
+
+// A row saved with an insertID derived from its contents, so BigQuery can
+// drop copies of the row resent on retry (best effort).
+type dedupedRow struct {
+	row      bigqueryrow
+	insertID string
+}
+
+// Save implements bigquery.ValueSaver.
+func (row dedupedRow) Save() (map[string]bigquery.Value, string, error) {
+	return row.row, row.insertID, nil
+}
+
+// Identical spans get identical insertIDs: their trace and span IDs. Log
+// records share the IDs of the span they were emitted in, so log rows, which
+// have a body, get a hash of the IDs with their timestamp, in tsColumn, and
+// body instead. Rows without IDs get none.
+func (row bigqueryrow) insertID(tsColumn string) string {
+	traceID, _ := row["trace_id"].(string)
+	spanID, _ := row["span_id"].(string)
+	body, ok := row["body"].(string)
+	if !ok {
+		return traceID + spanID
+	}
+	ts, _ := row[tsColumn].(pcommon.Timestamp)
+	return logInsertID(traceID, spanID, ts, body)
+}
+
+// The insertID of a log record's row, or "" if it wasn't emitted in a span.
+func logInsertID(traceID, spanID string, ts pcommon.Timestamp, body string) string {
+	if traceID == "" && spanID == "" {
+		return ""
+	}
+	h := fnv.New128a()
+	h.Write([]byte(traceID))
+	h.Write([]byte(spanID))
+	binary.Write(h, binary.BigEndian, uint64(ts))
+	h.Write([]byte(body))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// A key for the span, for PrimaryKeyColumn: a hash of its trace ID, span ID
+// and start time. Unlike the insertID, it's stored in the row, so identical
+// spans, e.g. exported twice, can be deduplicated by queries or MERGE jobs
+// after BigQuery's insertID deduplication window.
+func primaryKey(span ptrace.Span) string {
+	h := fnv.New128a()
+	traceID, spanID := span.TraceID(), span.SpanID()
+	h.Write(traceID[:])
+	h.Write(spanID[:])
+	binary.Write(h, binary.BigEndian, uint64(span.StartTimestamp()))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// The span's PartitionField value: its PartitionTimestampAttribute, if set
+// and parseable, or else its start time.
+func (b *rowBuilder) partitionTimestamp(span ptrace.Span) pcommon.Timestamp {
+	if b.PartitionTimestampAttribute == "" {
+		return span.StartTimestamp()
+	}
+	v, ok := span.Attributes().Get(b.PartitionTimestampAttribute)
+	if !ok {
+		return span.StartTimestamp()
+	}
+	switch v.Type() {
+	case pcommon.ValueTypeInt:
+		return pcommon.Timestamp(v.Int())
+	case pcommon.ValueTypeStr:
+		if t, err := time.Parse(time.RFC3339Nano, v.Str()); err == nil {
+			return pcommon.NewTimestampFromTime(t)
+		}
+	}
+	b.logger.Debug("Partition timestamp attribute isn't epoch nanoseconds or RFC 3339, using the span start time",
+		zap.String("attribute", b.PartitionTimestampAttribute),
+		zap.String("value", v.AsString()))
+	return span.StartTimestamp()
+}
+
+// Builds rows from telemetry, as configured for the exporter.
+type rowBuilder struct {
+	*Config
+	logger *zap.Logger
+
+	includeAttributes map[string]bool
+	excludeAttributes map[string]bool
+
+	// Counts attribute values dropped while building rows. Set per batch by
+	// withDrops.
+	drops *attributeDrops
+}
+
+func newRowBuilder(cfg *Config, logger *zap.Logger) *rowBuilder {
+	return &rowBuilder{
+		Config:            cfg,
+		logger:            logger,
+		includeAttributes: keySet(cfg.IncludeAttributes),
+		excludeAttributes: keySet(cfg.ExcludeAttributes),
+	}
+}
+
+// A copy of the builder that counts dropped attribute values in drops.
+func (b *rowBuilder) withDrops(drops *attributeDrops) *rowBuilder {
+	builder := *b
+	builder.drops = drops
+	return &builder
+}
+
+func keySet(keys []string) map[string]bool {
+	set := make(map[string]bool, len(keys))
+	for _, k := range keys {
+		set[k] = true
+	}
+	return set
+}
+
+// Excludes take precedence over includes. Without includes, every attribute
+// that isn't excluded is exported.
+func (b *rowBuilder) exportAttribute(k string) bool {
+	if b.excludeAttributes[k] {
+		return false
+	}
+	return len(b.includeAttributes) == 0 || b.includeAttributes[k]
+}
+
+// The W3C trace flags sampled bit, in the low byte of span.Flags().
+const traceFlagsSampled = 0x01
+
+// Spans filtered out by OnlyExportErrors or RequireSampledFlag, or sampled
+// out by SampleRatio, aren't exported. Filtering is per span: a resource's
+// other spans are unaffected.
+func (b *rowBuilder) exportSpan(span ptrace.Span) bool {
+	if b.OnlyExportErrors && span.Status().Code() != ptrace.StatusCodeError {
+		return false
+	}
+	if b.RequireSampledFlag && span.Flags()&traceFlagsSampled == 0 {
+		return false
+	}
+	return b.SampleRatio >= 1 || b.sampled(span.TraceID(), span.SpanID())
+}
+
+// Whether a span is in the SampleRatio fraction of spans kept, by a hash of
+// its trace ID and, unless SampleByTraceID is set, span ID.
+func (b *rowBuilder) sampled(traceID pcommon.TraceID, spanID pcommon.SpanID) bool {
+	h := fnv.New64a()
+	h.Write(traceID[:])
+	if !b.SampleByTraceID {
+		h.Write(spanID[:])
+	}
+	return float64(h.Sum64()) < b.SampleRatio*math.MaxUint64
+}
+
+// Span row columns other than attributes, events and links: name, trace_id,
+// span_id, trace_state, trace_flags, scope_name, scope_version, the two schema
+// URLs, the partition field and the three dropped counts.
+const spanRowColumns = 13
+
+// Build all rows for a batch of traces up front.
+func (b *rowBuilder) buildRows(td ptrace.Traces) []bigqueryrow {
+	rows := make([]bigqueryrow, 0, td.SpanCount())
+	_ = b.rangeRows(td, func(row bigqueryrow) error {
+		rows = append(rows, row)
+		return nil
+	})
+	return rows
+}
+
+// Split rows into consecutive sub-batches of at most maxRows rows and
+// maxBytes bytes, by estimateBatchBytes. A row larger than maxBytes gets a
+// sub-batch of its own.
+func splitRows(rows []bigqueryrow, maxRows, maxBytes int) [][]bigqueryrow {
+	var chunks [][]bigqueryrow
+	start, size := 0, insertRequestOverhead
+	for i, row := range rows {
+		rowSize := estimateRowBytes(row) + insertRowOverhead
+		if i > start && (i-start == maxRows || size+rowSize > maxBytes) {
+			chunks = append(chunks, rows[start:i])
+			start, size = i, insertRequestOverhead
+		}
+		size += rowSize
+	}
+	if start < len(rows) {
+		chunks = append(chunks, rows[start:])
+	}
+	return chunks
+}
+
+// The insert request body around its rows: {"rows":[...]} and the request
+// flags.
+const insertRequestOverhead = 64
+
+// Each row's JSON is wrapped as {"insertId":"...","json":...}, with an
+// insertID of up to 48 characters (hex trace and span IDs).
+const insertRowOverhead = 72
+
+// Approximate the size of an insert request body for rows.
+func estimateBatchBytes(rows []bigqueryrow) int {
+	size := insertRequestOverhead
+	for _, row := range rows {
+		size += estimateRowBytes(row) + insertRowOverhead
+	}
+	return size
+}
+
+// Approximate the size of a row's JSON in the insert request body.
+func estimateRowBytes(row bigqueryrow) int {
+	// Braces around the row.
+	size := 2
+	for k, v := range row {
+		// Quoted key, colon, comma.
+		size += len(k) + 4
+		switch v := v.(type) {
+		case string:
+			size += len(v) + 2
+		case []byte:
+			// Base64 encoded.
+			size += (len(v)+2)/3*4 + 2
+		case bool:
+			size += 5
+		case map[string]bigquery.Value:
+			size += estimateRowBytes(v)
+		// Arrays, for REPEATED columns: brackets, and each element with a
+		// comma.
+		case []string:
+			size += 2
+			for _, e := range v {
+				size += len(e) + 3
+			}
+		case []int64:
+			size += 2 + len(v)*25
+		case []float64:
+			size += 2 + len(v)*25
+		case []bool:
+			size += 2 + len(v)*6
+		default:
+			// Numbers and timestamps.
+			size += 24
+		}
+	}
+	return size
+}
+
+// Build rows in chunks of at most size rows, handing each chunk to yield as
+// soon as it fills. The chunk's backing array is reused, so yield must not
+// retain it. Only one chunk is held in memory at a time.
+func (b *rowBuilder) rangeRowChunks(td ptrace.Traces, size int, yield func([]bigqueryrow) error) error {
+	chunk := make([]bigqueryrow, 0, size)
+	err := b.rangeRows(td, func(row bigqueryrow) error {
+		chunk = append(chunk, row)
+		if len(chunk) < size {
+			return nil
+		}
+		err := yield(chunk)
+		clear(chunk)
+		chunk = chunk[:0]
+		return err
+	})
+	if err != nil || len(chunk) == 0 {
+		return err
+	}
+	return yield(chunk)
+}
 
 // The OpenTelemetry ptrace.Traces type has a defined nested structure.
 // Navigate to the nest level of span attributes to extract those for the map.
-func buildRows(td ptrace.Traces) []bigqueryrow {
-	var rows []bigqueryrow
+// Each row is handed to yield as it's built; iteration stops at the first error.
+func (b *rowBuilder) rangeRows(td ptrace.Traces, yield func(bigqueryrow) error) error {
+	columns := spanRowColumns
+	if b.IncludeEvents {
+		columns++
+	}
+	if b.IncludeLinks {
+		columns++
+	}
+	if b.IncludeRawSpan {
+		columns++
+	}
+	if b.PrimaryKeyColumn != "" {
+		columns++
+	}
+	if b.EmitEventTimeBounds {
+		columns += 2
+	}
+
 	rspans := td.ResourceSpans()
 	for i := 0; i < rspans.Len(); i++ {
 		rspan := rspans.At(i)
+		// Built with the resource's first exported span.
+		var resource *resourceColumns
 		sspans := rspan.ScopeSpans()
 		for j := 0; j < sspans.Len(); j++ {
 			sspan := sspans.At(j)
 			spans := sspan.Spans()
 			for k := 0; k < spans.Len(); k++ {
 				span := spans.At(k)
-				row := bigqueryrow{
-					"name":                 span.Name(),
-					tablePartitionFieldKey: span.StartTimestamp(),
+				if !b.exportSpan(span) {
+					continue
+				}
+				// Sized for every column, so the map isn't grown as
+				// attributes are added.
+				row := make(bigqueryrow, columns+rspan.Resource().Attributes().Len()+span.Attributes().Len())
+				row[b.spanNameColumn()] = span.Name()
+				row["trace_id"] = span.TraceID().String()
+				row["span_id"] = span.SpanID().String()
+				// An empty string rather than NULL when there's no
+				// tracestate, so queries needn't handle both.
+				row["trace_state"] = span.TraceState().AsRaw()
+				row["trace_flags"] = int64(span.Flags())
+				row["scope_name"] = sspan.Scope().Name()
+				row["scope_version"] = sspan.Scope().Version()
+				// The semantic conventions versions of the resource and
+				// span attributes, empty if unset.
+				row["resource_schema_url"] = rspan.SchemaUrl()
+				row["scope_schema_url"] = sspan.SchemaUrl()
+				row[b.partitionField()] = b.partitionTimestamp(span)
+				// Nonzero counts flag truncation upstream, so zero is
+				// written rather than omitted.
+				row["dropped_attributes_count"] = int64(span.DroppedAttributesCount())
+				row["dropped_events_count"] = int64(span.DroppedEventsCount())
+				row["dropped_links_count"] = int64(span.DroppedLinksCount())
+				if b.IncludeEvents {
+					row["events"] = eventsJSON(span.Events())
+				}
+				if b.IncludeLinks {
+					row["links"] = linksJSON(span.Links())
+				}
+				if b.EmitEventTimeBounds {
+					addEventTimeBounds(row, span.Events())
+				}
+				if b.IncludeRawSpan {
+					row["raw_span"] = rawSpanJSON(rspan.Resource(), rspan.SchemaUrl(), sspan, span)
+				}
+				if b.PrimaryKeyColumn != "" {
+					row[b.PrimaryKeyColumn] = primaryKey(span)
 				}
 				// Span attributes exist at both the 'resource' (i.e., parent trace) level
 				// and at the individual span level.
-				rspan.Resource().Attributes().Range(func(k string, v pcommon.Value) bool {
-					row.addKeyValue(k, v)
-					return true
-				})
-				span.Attributes().Range(func(k string, v pcommon.Value) bool {
-					row.addKeyValue(k, v)
-					return true
-				})
-				rows = append(rows, row)
+				if resource == nil {
+					resource = b.buildResourceColumns(row, rspan.Resource(), b.eventTimeBoundsColumns()...)
+				}
+				b.addResourceColumns(row, resource, sspan.Scope(), span.Attributes())
+				if err := yield(row); err != nil {
+					return err
+				}
 			}
 		}
 	}
 
-	return rows
+	return nil
+}
+
+// A span event as serialized in the events column.
+type spanEvent struct {
+	Name       string         `json:"name"`
+	Timestamp  string         `json:"timestamp"`
+	Attributes map[string]any `json:"attributes"`
+}
+
+// Serialize span events to a JSON array string, so they fit a STRING column
+// and remain queryable with BigQuery's JSON functions.
+func eventsJSON(events ptrace.SpanEventSlice) string {
+	serialized := make([]spanEvent, 0, events.Len())
+	for i := 0; i < events.Len(); i++ {
+		event := events.At(i)
+		serialized = append(serialized, spanEvent{
+			Name:       event.Name(),
+			Timestamp:  event.Timestamp().AsTime().Format(time.RFC3339Nano),
+			Attributes: event.Attributes().AsRaw(),
+		})
+	}
+	return jsonString(serialized)
+}
+
+// Set the first_event_time and last_event_time columns to the earliest and
+// latest of the events' timestamps. Without events, the columns are left out
+// of the row, so they're NULL: a nil value would be typed as STRING by a
+// flexible schema.
+func addEventTimeBounds(row bigqueryrow, events ptrace.SpanEventSlice) {
+	if events.Len() == 0 {
+		return
+	}
+	first, last := events.At(0).Timestamp(), events.At(0).Timestamp()
+	for i := 1; i < events.Len(); i++ {
+		ts := events.At(i).Timestamp()
+		first, last = min(first, ts), max(last, ts)
+	}
+	row[firstEventTimeColumn] = first
+	row[lastEventTimeColumn] = last
+}
+
+const (
+	firstEventTimeColumn = "first_event_time"
+	lastEventTimeColumn  = "last_event_time"
+)
+
+// The event time bounds columns, with EmitEventTimeBounds. Only spans with
+// events have them, so they're reserved for every span row rather than only
+// those of spans like the first.
+func (b *rowBuilder) eventTimeBoundsColumns() []string {
+	if !b.EmitEventTimeBounds {
+		return nil
+	}
+	return []string{firstEventTimeColumn, lastEventTimeColumn}
+}
+
+// A span link as serialized in the links column.
+type spanLink struct {
+	TraceID    string         `json:"trace_id"`
+	SpanID     string         `json:"span_id"`
+	Attributes map[string]any `json:"attributes"`
+}
+
+// Serialize span links to a JSON array string, with hex encoded IDs that
+// match the trace_id and span_id columns of the linked spans.
+func linksJSON(links ptrace.SpanLinkSlice) string {
+	serialized := make([]spanLink, 0, links.Len())
+	for i := 0; i < links.Len(); i++ {
+		link := links.At(i)
+		serialized = append(serialized, spanLink{
+			TraceID:    link.TraceID().String(),
+			SpanID:     link.SpanID().String(),
+			Attributes: link.Attributes().AsRaw(),
+		})
+	}
+	return jsonString(serialized)
+}
+
+var rawSpanMarshaler = &ptrace.JSONMarshaler{}
+
+// Serialize the span, with its resource and scope, as OTLP JSON, i.e. a
+// traces message holding just this span, which OTLP tooling can read back.
+func rawSpanJSON(resource pcommon.Resource, schemaURL string, sspan ptrace.ScopeSpans, span ptrace.Span) string {
+	td := ptrace.NewTraces()
+	rspan := td.ResourceSpans().AppendEmpty()
+	resource.CopyTo(rspan.Resource())
+	rspan.SetSchemaUrl(schemaURL)
+	scope := rspan.ScopeSpans().AppendEmpty()
+	sspan.Scope().CopyTo(scope.Scope())
+	scope.SetSchemaUrl(sspan.SchemaUrl())
+	span.CopyTo(scope.Spans().AppendEmpty())
+
+	b, err := rawSpanMarshaler.MarshalTraces(td)
+	if err != nil {
+		return ""
+	}
+	return string(b)
+}
+
+func jsonString(v any) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return ""
+	}
+	return string(b)
+}
+
+// The attribute key that each of a row's attribute columns was derived from.
+type columnSources map[string]string
+
+// Add attributes to the row, unless filtered out by the include and exclude
+// lists (matched against the original key). When distinct keys sanitize to
+// the same column name (e.g. a.b and a_b), the first key keeps the column and
+// later keys get a column suffixed with a hash of the key, so no values are
+// lost. A key that repeats, e.g. on both the resource and the span,
+// overwrites its column. columnFor names each key's column.
+func (b *rowBuilder) addAttributes(row bigqueryrow, sources columnSources, attrs pcommon.Map, columnFor func(k string) string) {
+	attrs.Range(func(k string, v pcommon.Value) bool {
+		if !b.exportAttribute(k) {
+			return true
+		}
+		if v.Type() == pcommon.ValueTypeEmpty && b.EmptyAttributeValues != emptyAttributeValuesNull {
+			b.drops.add(dropReasonEmptyValue, 1)
+			return true
+		}
+		column := columnFor(k)
+		if source, ok := sources[column]; ok && source == "" {
+			remapped := sanitizeColumnName(remappedAttributePrefix + column)
+			b.logger.Debug("Attribute column remapped to keep a reserved column",
+				zap.String("key", k),
+				zap.String("reserved_column", column),
+				zap.String("column", remapped))
+			column = remapped
+		}
+		if source, ok := sources[column]; ok && source != k {
+			column = withKeyHash(column, k)
+			b.logger.Debug("Attribute column name collision resolved",
+				zap.String("key", k),
+				zap.String("colliding_key", source),
+				zap.String("column", column))
+		}
+		sources[column] = k
+		if !row.setValue(column, v) {
+			b.drops.add(dropReasonUnencodable, 1)
+			return true
+		}
+		b.dropOversizedJSON(row, column, k, v)
+		return true
+	})
+}
+
+// Drop the value in column, from attribute k, if it's a map or slice
+// serialized to JSON that's longer than MaxAttributeJSONBytes, so that one
+// deeply nested attribute can't push its row past BigQuery's row size limit
+// and fail the insert. Truncated JSON wouldn't parse, so the value is dropped
+// rather than truncated.
+func (b *rowBuilder) dropOversizedJSON(row bigqueryrow, column, k string, v pcommon.Value) {
+	if b.MaxAttributeJSONBytes == 0 || (v.Type() != pcommon.ValueTypeMap && v.Type() != pcommon.ValueTypeSlice) {
+		return
+	}
+	serialized, ok := row[column].(string)
+	if !ok || len(serialized) <= b.MaxAttributeJSONBytes {
+		return
+	}
+	delete(row, column)
+	b.drops.add(dropReasonOversized, 1)
+	b.logger.Debug("Attribute JSON dropped for exceeding maxAttributeJSONBytes",
+		zap.String("key", k),
+		zap.Int("bytes", len(serialized)))
+}
+
+// Prefixes the column of an attribute whose own column is reserved, e.g. a
+// span attribute named name, which would otherwise overwrite the span name.
+const remappedAttributePrefix = "attr_"
+
+// Add the resource's, the scope's (with a ColumnNamespacing.Scope prefix) and
+// the record's attributes to a row holding the record's own columns. Those
+// columns, and the ingest timestamp column sendRows adds later, are reserved,
+// so attributes are remapped rather than overwrite them. With ResourceTable,
+// the resource's ID is added instead of its attributes. Columns in
+// StableColumnSet that the row doesn't have are added as NULL.
+func (b *rowBuilder) addRowAttributes(row bigqueryrow, resource pcommon.Resource, scope pcommon.InstrumentationScope, attrs pcommon.Map) {
+	b.addResourceColumns(row, b.buildResourceColumns(row, resource), scope, attrs)
+}
+
+// The columns a resource contributes to rows with the reserved columns of
+// row, with the keys they were derived from, and the attribute values
+// dropped building them. Built once per resource for spans, whose rows all
+// have the same reserved columns, and copied into each span's row, so a
+// resource with hundreds of attributes isn't flattened again for every span.
+type resourceColumns struct {
+	values  bigqueryrow
+	sources columnSources
+	drops   map[string]int
+}
+
+// Columns in reserved are reserved as well as those of row, for columns only
+// some rows have.
+func (b *rowBuilder) buildResourceColumns(row bigqueryrow, resource pcommon.Resource, reserved ...string) *resourceColumns {
+	rc := &resourceColumns{
+		values:  make(bigqueryrow, resource.Attributes().Len()),
+		sources: make(columnSources, len(row)+len(reserved)+resource.Attributes().Len()+2),
+	}
+	for column := range row {
+		rc.sources[column] = ""
+	}
+	for _, column := range reserved {
+		rc.sources[column] = ""
+	}
+	if b.IngestTimestampColumn != "" {
+		rc.sources[b.IngestTimestampColumn] = ""
+	}
+	if b.ResourceTable != "" {
+		rc.values[resourceIDColumn] = resourceID(resource)
+		rc.sources[resourceIDColumn] = ""
+		return rc
+	}
+	drops := &attributeDrops{}
+	b.withDrops(drops).addResourceAttributes(rc.values, rc.sources, resource)
+	rc.drops = drops.take()
+	return rc
+}
+
+// Add the resource's columns, from buildResourceColumns, and the scope's and
+// the record's attributes to the row. See addRowAttributes.
+func (b *rowBuilder) addResourceColumns(row bigqueryrow, resource *resourceColumns, scope pcommon.InstrumentationScope, attrs pcommon.Map) {
+	for column, value := range resource.values {
+		// The nested resource row is copied, so rows don't share it.
+		if nested, ok := value.(map[string]bigquery.Value); ok {
+			value = maps.Clone(nested)
+		}
+		row[column] = value
+	}
+	for reason, n := range resource.drops {
+		b.drops.add(reason, n)
+	}
+	sources := maps.Clone(resource.sources)
+	if b.ColumnNamespacing.Scope != "" {
+		b.addAttributes(row, sources, scope.Attributes(), b.scopeAttributeColumn)
+	}
+	b.addAttributes(row, sources, attrs, b.attributeColumn)
+	for _, column := range b.StableColumnSet {
+		if _, ok := row[column]; !ok {
+			row[column] = nil
+		}
+	}
+}
+
+// The RECORD column resource attributes are nested in when NestResource is
+// set.
+const resourceColumn = "resource"
+
+// Add the resource's attributes to the row: flattened, like other attributes,
+// or, if NestResource is set, as a nested row in the resource column. The
+// nested row is left out if no resource attributes are exported.
+func (b *rowBuilder) addResourceAttributes(row bigqueryrow, sources columnSources, resource pcommon.Resource) {
+	if !b.NestResource {
+		b.addAttributes(row, sources, resource.Attributes(), b.resourceAttributeColumn)
+		return
+	}
+
+	nested := make(bigqueryrow, resource.Attributes().Len())
+	b.addAttributes(nested, columnSources{}, resource.Attributes(), b.resourceAttributeColumn)
+	if len(nested) > 0 {
+		row[resourceColumn] = map[string]bigquery.Value(nested)
+	}
+	// Reserve the column, so that an attribute named resource gets a
+	// column of its own.
+	sources[resourceColumn] = ""
 }
 
 // Parse key value pairs to align with field name preferences
 // and BigQuery type equivalents for span attribute value types.
 func (row bigqueryrow) addKeyValue(k string, v pcommon.Value) {
-	// Names with periods are inconvenient for SQL.
-	k = strings.Replace(k, ".", "_", -1)
+	// Names with periods are inconvenient for SQL, and other characters
+	// aren't allowed at all.
+	row.setValue(sanitizeColumnName(k), v)
+}
+
+// Convert the value to its BigQuery type equivalent and set it in column k,
+// reporting whether it could be converted.
+func (row bigqueryrow) setValue(k string, v pcommon.Value) bool {
 	// BigQuery types vs OTel span attribute types.
 	// https://pkg.go.dev/cloud.google.com/go/bigquery#Table.Metadata
 	// https://github.com/googleapis/google-cloud-go/blob/ed488b94b46b50585f91e065dd877c06d85ce879/bigquery/value.go#L32
@@ -60,16 +665,292 @@ func (row bigqueryrow) addKeyValue(k string, v pcommon.Value) {
 	case pcommon.ValueTypeBool:
 		row[k] = v.Bool()
 	case pcommon.ValueTypeBytes:
-		row[k] = v.Bytes()
+		// A copy, as a []byte: the inserter base64 encodes it for a BYTES
+		// column.
+		row[k] = v.Bytes().AsRaw()
 	case pcommon.ValueTypeDouble:
 		row[k] = v.Double()
 	case pcommon.ValueTypeInt:
 		row[k] = v.Int()
 	case pcommon.ValueTypeMap:
-		row[k] = v.Map()
+		// Stored as a JSON object string, with nested maps and slices as
+		// nested objects and arrays.
+		b, err := json.Marshal(v.Map().AsRaw())
+		if err != nil {
+			return false
+		}
+		row[k] = string(b)
 	case pcommon.ValueTypeSlice:
-		row[k] = v.Slice()
+		// Slices of a single primitive type are stored as a Go slice of that
+		// type, for a REPEATED column.
+		if values, ok := repeatedValue(v.Slice()); ok {
+			row[k] = values
+			return true
+		}
+		// The inserter can't encode a pcommon.Slice, so store other slices
+		// as a JSON array string. AsRaw() handles nested and mixed element
+		// types.
+		b, err := json.Marshal(v.Slice().AsRaw())
+		if err != nil {
+			// E.g. NaN doubles, which JSON can't represent.
+			return false
+		}
+		row[k] = string(b)
 	case pcommon.ValueTypeStr:
 		row[k] = v.Str()
+	case pcommon.ValueTypeEmpty:
+		row[k] = nil
+	}
+	return true
+}
+
+// The slice as a []string, []int64, []float64 or []bool, if its elements are
+// all strings, ints, doubles or bools respectively. Empty slices have no
+// element type, so they aren't converted.
+func repeatedValue(s pcommon.Slice) (bigquery.Value, bool) {
+	if s.Len() == 0 {
+		return nil, false
+	}
+	elementType := s.At(0).Type()
+	for i := 1; i < s.Len(); i++ {
+		if s.At(i).Type() != elementType {
+			return nil, false
+		}
+	}
+
+	switch elementType {
+	case pcommon.ValueTypeStr:
+		values := make([]string, s.Len())
+		for i := range values {
+			values[i] = s.At(i).Str()
+		}
+		return values, true
+	case pcommon.ValueTypeInt:
+		values := make([]int64, s.Len())
+		for i := range values {
+			values[i] = s.At(i).Int()
+		}
+		return values, true
+	case pcommon.ValueTypeDouble:
+		values := make([]float64, s.Len())
+		for i := range values {
+			values[i] = s.At(i).Double()
+		}
+		return values, true
+	case pcommon.ValueTypeBool:
+		values := make([]bool, s.Len())
+		for i := range values {
+			values[i] = s.At(i).Bool()
+		}
+		return values, true
+	}
+	return nil, false
+}
+
+// The elements of a value for a REPEATED column, as set by repeatedValue.
+func repeatedElements(value bigquery.Value) ([]bigquery.Value, bool) {
+	var elements []bigquery.Value
+	switch v := value.(type) {
+	case []string:
+		for _, e := range v {
+			elements = append(elements, e)
+		}
+	case []int64:
+		for _, e := range v {
+			elements = append(elements, e)
+		}
+	case []float64:
+		for _, e := range v {
+			elements = append(elements, e)
+		}
+	case []bool:
+		for _, e := range v {
+			elements = append(elements, e)
+		}
+	default:
+		return nil, false
+	}
+	return elements, true
+}
+
+// The value belongs in a REPEATED column.
+func isRepeatedValue(value bigquery.Value) bool {
+	switch value.(type) {
+	case []string, []int64, []float64, []bool:
+		return true
+	}
+	return false
+}
+
+// BigQuery column names are limited to 300 characters.
+const maxColumnNameLength = 300
+
+// Derive a valid BigQuery column name, i.e. [A-Za-z_][A-Za-z0-9_]*, from an
+// attribute key. Each invalid character becomes an underscore. Names that
+// start with a digit or, in any case, one of BigQuery's reserved prefixes,
+// e.g. _PARTITION, get a leading underscore. Names over the length limit are
+// truncated, with a hash of the full key appended so that keys sharing a
+// long prefix don't collide.
+func sanitizeColumnName(k string) string {
+	// Most keys need no changes, or only dots replaced. Skip the copy for
+	// the former.
+	if isValidColumnName(k) && !hasReservedColumnPrefix(k) {
+		return k
+	}
+
+	var b strings.Builder
+	b.Grow(len(k) + 1)
+	if k == "" || (k[0] >= '0' && k[0] <= '9') {
+		b.WriteByte('_')
+	}
+	for _, r := range k {
+		if r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+		} else {
+			b.WriteByte('_')
+		}
+	}
+
+	name := b.String()
+	if hasReservedColumnPrefix(name) {
+		name = "_" + name
+	}
+	if len(name) > maxColumnNameLength {
+		return withKeyHash(name, k)
+	}
+	return name
+}
+
+// The column for span (or log record, data point) attribute key k.
+func (cfg *Config) attributeColumn(k string) string {
+	return cfg.columnName(cfg.ColumnNamespacing.Span + k)
+}
+
+// The column for scope attribute key k.
+func (cfg *Config) scopeAttributeColumn(k string) string {
+	return cfg.columnName(cfg.ColumnNamespacing.Scope + k)
+}
+
+// The column for attribute key k, after any ColumnNamespacing prefix: the
+// key, prefixed with AttributeColumnPrefix, as a valid column name in the
+// ColumnNameStyle. Columns the exporter derives from span fields, e.g. name
+// and trace_id, aren't prefixed, so a prefix keeps attributes from colliding
+// with them.
+func (cfg *Config) columnName(k string) string {
+	k = cfg.AttributeColumnPrefix + k
+	switch cfg.ColumnNameStyle {
+	case columnNameStylePreserveDots:
+		k = strings.ReplaceAll(k, ".", "__")
+	case columnNameStyleCamel:
+		k = camelCase(k)
+	}
+	return sanitizeColumnName(k)
+}
+
+// Join the parts of k, separated by characters other than letters and
+// digits, in camel case: the first part as is, the rest capitalized, e.g.
+// http.status_code becomes httpStatusCode.
+func camelCase(k string) string {
+	var b strings.Builder
+	b.Grow(len(k))
+	startPart := false
+	for _, r := range k {
+		if !(r >= 'a' && r <= 'z') && !(r >= 'A' && r <= 'Z') && !(r >= '0' && r <= '9') {
+			startPart = b.Len() > 0
+			continue
+		}
+		if startPart && r >= 'a' && r <= 'z' {
+			r -= 'a' - 'A'
+		}
+		startPart = false
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// The column for resource attribute key k: with StandardResourceColumns, the
+// standard column for well-known keys, otherwise as for other attributes.
+func (cfg *Config) resourceAttributeColumn(k string) string {
+	if cfg.StandardResourceColumns {
+		if column, ok := standardResourceColumns[k]; ok {
+			return column
+		}
+	}
+	return cfg.columnName(cfg.ColumnNamespacing.Resource + k)
+}
+
+// Columns for well-known resource attributes, with StandardResourceColumns.
+// They're fixed, rather than derived by sanitizeColumnName and prefixed with
+// AttributeColumnPrefix, so queries can rely on them whatever the
+// configuration.
+var standardResourceColumns = map[string]string{
+	"service.name":           "service_name",
+	"service.namespace":      "service_namespace",
+	"service.version":        "service_version",
+	"service.instance.id":    "service_instance_id",
+	"host.name":              "host_name",
+	"k8s.namespace.name":     "k8s_namespace_name",
+	"k8s.pod.name":           "k8s_pod_name",
+	"deployment.environment": "deployment_environment",
+	"cloud.region":           "cloud_region",
+}
+
+func isValidColumnName(k string) bool {
+	if k == "" || len(k) > maxColumnNameLength || (k[0] >= '0' && k[0] <= '9') {
+		return false
+	}
+	for i := 0; i < len(k); i++ {
+		c := k[i]
+		if c != '_' && (c < 'a' || c > 'z') && (c < 'A' || c > 'Z') && (c < '0' || c > '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// Whether the column name starts with one of reservedColumnPrefixes, in any
+// case. BigQuery rejects schema updates adding such columns.
+func hasReservedColumnPrefix(name string) bool {
+	for _, reserved := range reservedColumnPrefixes {
+		if len(name) >= len(reserved) && strings.EqualFold(name[:len(reserved)], reserved) {
+			return true
+		}
+	}
+	return false
+}
+
+// Append a short hash of the attribute key k to the column name, truncating
+// the name as needed to stay within the length limit.
+func withKeyHash(name, k string) string {
+	h := fnv.New32a()
+	h.Write([]byte(k))
+	suffix := fmt.Sprintf("_%08x", h.Sum32())
+	if len(name)+len(suffix) > maxColumnNameLength {
+		name = name[:maxColumnNameLength-len(suffix)]
+	}
+	return name + suffix
+}
+
+// Column name suffixes by value type, for TypeConflictStrategy suffix.
+var typeSuffixes = map[bigquery.FieldType]string{
+	bigquery.StringFieldType:    "str",
+	bigquery.IntegerFieldType:   "int",
+	bigquery.FloatFieldType:     "float",
+	bigquery.BooleanFieldType:   "bool",
+	bigquery.BytesFieldType:     "bytes",
+	bigquery.TimestampFieldType: "ts",
+}
+
+// The column for values of fieldType whose own column, name, has a
+// different type, e.g. value_int, or value_int_array for repeated values.
+// The name is truncated as needed to stay within the length limit.
+func typedColumnName(name string, fieldType bigquery.FieldType, repeated bool) string {
+	suffix := "_" + typeSuffixes[fieldType]
+	if repeated {
+		suffix += "_array"
+	}
+	if len(name)+len(suffix) > maxColumnNameLength {
+		name = name[:maxColumnNameLength-len(suffix)]
 	}
+	return name + suffix
 }
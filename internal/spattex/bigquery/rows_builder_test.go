@@ -1,11 +1,22 @@
 package bigquery
 
 import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"runtime"
+	"strings"
 	"testing"
+	"time"
 
+	"cloud.google.com/go/bigquery"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"go.opentelemetry.io/collector/pdata/pcommon"
 	"go.opentelemetry.io/collector/pdata/ptrace"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
 )
 
 func TestBuildRows(t *testing.T) {
@@ -13,7 +24,7 @@ func TestBuildRows(t *testing.T) {
 	traces := createTestTraces()
 
 	// Build rows from the trace
-	rows := buildRows(traces)
+	rows := testRowBuilder().buildRows(traces)
 
 	// Validate the results
 	assert.Equal(t, 2, len(rows), "Should have created 2 rows")
@@ -29,6 +40,11 @@ func TestBuildRows(t *testing.T) {
 	assert.Equal(t, "service1", rows[1]["service_name"], "Resource attribute should be properly added")
 	assert.Equal(t, "value2", rows[1]["str_key"], "Span attribute should be properly added")
 	assert.Equal(t, 3.24, rows[1]["double_key"], "Double attribute should be properly added")
+
+	// Verify instrumentation scope on both rows
+	assert.Equal(t, "test_scope", rows[0]["scope_name"], "Scope name should be properly added")
+	assert.Equal(t, "test_scope", rows[1]["scope_name"], "Scope name should be properly added")
+	assert.Equal(t, "", rows[0]["scope_version"], "Unset scope version should be empty")
 }
 
 func TestAddKeyValue(t *testing.T) {
@@ -113,11 +129,11 @@ func TestAddKeyValueComplexTypes(t *testing.T) {
 		val := pcommon.NewValueEmpty()
 		m := val.SetEmptyMap()
 		m.PutStr("nested_key", "nested_value")
+		m.PutEmptyMap("nested_map").PutInt("count", 2)
 
 		row.addKeyValue("map_key", val)
 
-		// Since Map() returns the internal representation, we just check that it exists
-		assert.NotNil(t, row["map_key"])
+		assert.Equal(t, `{"nested_key":"nested_value","nested_map":{"count":2}}`, row["map_key"], "Maps should be serialized to JSON")
 	})
 
 	// Test slice value
@@ -130,8 +146,43 @@ func TestAddKeyValueComplexTypes(t *testing.T) {
 
 		row.addKeyValue("slice_key", val)
 
-		// Since Slice() returns the internal representation, we just check that it exists
-		assert.NotNil(t, row["slice_key"])
+		assert.Equal(t, []string{"item1", "item2"}, row["slice_key"], "Homogeneous slices should be kept as a Go slice")
+	})
+
+	// Test empty slice value
+	t.Run("empty slice value", func(t *testing.T) {
+		row := bigqueryrow{}
+		val := pcommon.NewValueEmpty()
+		val.SetEmptySlice()
+
+		row.addKeyValue("slice_key", val)
+
+		assert.Equal(t, `[]`, row["slice_key"])
+	})
+
+	// Test heterogeneous slice value
+	t.Run("mixed slice value", func(t *testing.T) {
+		row := bigqueryrow{}
+		val := pcommon.NewValueEmpty()
+		s := val.SetEmptySlice()
+		s.AppendEmpty().SetStr("item1")
+		s.AppendEmpty().SetInt(2)
+		s.AppendEmpty().SetEmptySlice().AppendEmpty().SetBool(true)
+
+		row.addKeyValue("slice_key", val)
+
+		assert.Equal(t, `["item1",2,[true]]`, row["slice_key"], "Mixed slices should fall back to JSON")
+	})
+
+	// Test empty value
+	t.Run("empty value", func(t *testing.T) {
+		row := bigqueryrow{}
+
+		row.addKeyValue("empty_key", pcommon.NewValueEmpty())
+
+		value, ok := row["empty_key"]
+		assert.True(t, ok, "Empty values should be written")
+		assert.Nil(t, value, "Empty values should be NULL")
 	})
 
 	// Test bytes value
@@ -142,11 +193,25 @@ func TestAddKeyValueComplexTypes(t *testing.T) {
 
 		row.addKeyValue("bytes_key", val)
 
-		// We check that bytes were properly added
-		assert.NotNil(t, row["bytes_key"])
+		assert.Equal(t, []byte("test bytes"), row["bytes_key"], "Bytes should be stored as a []byte")
+
+		// The inserter encodes the row as JSON, base64 encoding []byte
+		// values for the BYTES column.
+		encoded, err := json.Marshal(row)
+		require.NoError(t, err)
+		var decoded struct {
+			BytesKey []byte `json:"bytes_key"`
+		}
+		require.NoError(t, json.Unmarshal(encoded, &decoded))
+		assert.Equal(t, []byte("test bytes"), decoded.BytesKey, "Bytes should round-trip through the insert encoding")
 	})
 }
 
+// Helper function to create a row builder with the test config
+func testRowBuilder() *rowBuilder {
+	return newRowBuilder(createTestConfig(), zap.NewNop())
+}
+
 // Helper function to create test traces with predictable data
 func createTestTraces() ptrace.Traces {
 	traces := ptrace.NewTraces()
@@ -182,7 +247,7 @@ func createTestTraces() ptrace.Traces {
 func TestEmptyTraces(t *testing.T) {
 	// Test with empty traces
 	traces := ptrace.NewTraces()
-	rows := buildRows(traces)
+	rows := testRowBuilder().buildRows(traces)
 
 	assert.Equal(t, 0, len(rows), "Empty traces should produce no rows")
 }
@@ -204,7 +269,7 @@ func TestMultipleResourceSpans(t *testing.T) {
 	span2 := ss2.Spans().AppendEmpty()
 	span2.SetName("span2")
 
-	rows := buildRows(traces)
+	rows := testRowBuilder().buildRows(traces)
 
 	assert.Equal(t, 2, len(rows), "Should have 2 rows")
 	assert.Equal(t, "service1", rows[0]["service_name"], "First row should have service1")
@@ -230,11 +295,1143 @@ func TestMultipleScopeSpans(t *testing.T) {
 	span2 := ss2.Spans().AppendEmpty()
 	span2.SetName("span2")
 
-	rows := buildRows(traces)
+	rows := testRowBuilder().buildRows(traces)
 
 	assert.Equal(t, 2, len(rows), "Should have 2 rows")
 	assert.Equal(t, "span1", rows[0]["name"], "First row should be span1")
 	assert.Equal(t, "span2", rows[1]["name"], "Second row should be span2")
+	assert.Equal(t, "scope1", rows[0]["scope_name"], "First row should have scope1")
+	assert.Equal(t, "scope2", rows[1]["scope_name"], "Second row should have scope2")
 	assert.Equal(t, "service1", rows[0]["service_name"], "Both rows should have the same resource attributes")
 	assert.Equal(t, "service1", rows[1]["service_name"], "Both rows should have the same resource attributes")
 }
+
+func TestRangeRowChunksMatchesBuildRows(t *testing.T) {
+	traces := createLargeTestTraces(5)
+
+	var streamed []bigqueryrow
+	var chunkSizes []int
+	err := testRowBuilder().rangeRowChunks(traces, 2, func(chunk []bigqueryrow) error {
+		chunkSizes = append(chunkSizes, len(chunk))
+		streamed = append(streamed, chunk...)
+		return nil
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, []int{2, 2, 1}, chunkSizes, "Chunks should be bounded by the chunk size")
+	assert.Equal(t, testRowBuilder().buildRows(traces), streamed, "Streamed rows should match the slice-based rows")
+}
+
+func TestRangeRowChunksStopsOnError(t *testing.T) {
+	traces := createLargeTestTraces(5)
+
+	calls := 0
+	err := testRowBuilder().rangeRowChunks(traces, 2, func(chunk []bigqueryrow) error {
+		calls++
+		return fmt.Errorf("insert failed")
+	})
+
+	assert.Error(t, err)
+	assert.Equal(t, 1, calls, "No further chunks should be built after an error")
+}
+
+// Compare the heap held while rows are assembled: the slice-based path holds
+// every row at once, the streaming path holds one chunk at a time.
+func BenchmarkRowsPeakMemory(b *testing.B) {
+	traces := createLargeTestTraces(5000)
+
+	b.Run("slice", func(b *testing.B) {
+		var peak uint64
+		for i := 0; i < b.N; i++ {
+			rows := testRowBuilder().buildRows(traces)
+			peak = max(peak, liveHeap())
+			runtime.KeepAlive(rows)
+		}
+		b.ReportMetric(float64(peak), "peak-heap-B")
+	})
+
+	b.Run("streaming", func(b *testing.B) {
+		var peak uint64
+		for i := 0; i < b.N; i++ {
+			_ = testRowBuilder().rangeRowChunks(traces, defaultMaxRowsPerRequest, func(chunk []bigqueryrow) error {
+				peak = max(peak, liveHeap())
+				return nil
+			})
+		}
+		b.ReportMetric(float64(peak), "peak-heap-B")
+	})
+}
+
+func BenchmarkBuildRows(b *testing.B) {
+	traces := createLargeTestTraces(5000)
+	builder := testRowBuilder()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		rows := builder.buildRows(traces)
+		runtime.KeepAlive(rows)
+	}
+}
+
+// A resource with 200 attributes and 100 spans, with the resource's columns
+// built once (buildRows) or for every span, as addRowAttributes does.
+func BenchmarkBuildRowsWideResource(b *testing.B) {
+	traces := createLargeTestTraces(100)
+	resource := traces.ResourceSpans().At(0).Resource()
+	for i := 0; i < 200; i++ {
+		resource.Attributes().PutStr(fmt.Sprintf("resource.key.%d", i), "value")
+	}
+	builder := testRowBuilder()
+
+	b.Run("per_resource", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			rows := builder.buildRows(traces)
+			runtime.KeepAlive(rows)
+		}
+	})
+
+	b.Run("per_span", func(b *testing.B) {
+		scopeSpans := traces.ResourceSpans().At(0).ScopeSpans().At(0)
+		spans := scopeSpans.Spans()
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			rows := make([]bigqueryrow, 0, spans.Len())
+			for j := 0; j < spans.Len(); j++ {
+				span := spans.At(j)
+				row := bigqueryrow{"name": span.Name(), builder.partitionField(): span.StartTimestamp()}
+				builder.addRowAttributes(row, resource, scopeSpans.Scope(), span.Attributes())
+				rows = append(rows, row)
+			}
+			runtime.KeepAlive(rows)
+		}
+	})
+}
+
+func BenchmarkAddAttributes(b *testing.B) {
+	for _, key := range []string{"http_method", "http.request.method"} {
+		b.Run(key, func(b *testing.B) {
+			builder := testRowBuilder()
+			attrs := pcommon.NewMap()
+			attrs.PutStr(key, "value")
+			row, sources := bigqueryrow{}, columnSources{}
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				clear(row)
+				clear(sources)
+				builder.addAttributes(row, sources, attrs, builder.attributeColumn)
+			}
+		})
+	}
+}
+
+func liveHeap() uint64 {
+	var m runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&m)
+	return m.HeapAlloc
+}
+
+// Helper function to create a single-resource trace with n spans
+func createLargeTestTraces(n int) ptrace.Traces {
+	traces := ptrace.NewTraces()
+	rs := traces.ResourceSpans().AppendEmpty()
+	rs.Resource().Attributes().PutStr("service.name", "service1")
+	ss := rs.ScopeSpans().AppendEmpty()
+	for i := 0; i < n; i++ {
+		span := ss.Spans().AppendEmpty()
+		span.SetName(fmt.Sprintf("span%d", i))
+		span.Attributes().PutStr("str_key", "value")
+		span.Attributes().PutInt("int_key", int64(i))
+		span.Attributes().PutDouble("double_key", float64(i))
+	}
+	return traces
+}
+
+func TestBuildRowsSharesResourceColumns(t *testing.T) {
+	traces := createLargeTestTraces(3)
+	resource := traces.ResourceSpans().At(0).Resource()
+	resource.Attributes().PutEmpty("empty_key")
+	resource.Attributes().PutStr("name", "resource_name")
+	drops := &attributeDrops{}
+	builder := testRowBuilder().withDrops(drops)
+	builder.NestResource = true
+
+	rows := builder.buildRows(traces)
+
+	require.Len(t, rows, 3)
+	for i, row := range rows {
+		assert.Equal(t, map[string]bigquery.Value{"service_name": "service1", "name": "resource_name"}, row["resource"], "Row %d should have the resource's columns", i)
+		assert.Equal(t, fmt.Sprintf("span%d", i), row["name"])
+	}
+	rows[0]["resource"].(map[string]bigquery.Value)["service_name"] = "changed"
+	assert.Equal(t, "service1", rows[1]["resource"].(map[string]bigquery.Value)["service_name"], "Rows should not share the nested resource row")
+	assert.Equal(t, map[string]int{dropReasonEmptyValue: 3}, drops.take(), "Resource drops should be counted for each span")
+}
+
+func TestBuildRowsTraceAndSpanIDs(t *testing.T) {
+	traces := createTestTraces()
+	span := traces.ResourceSpans().At(0).ScopeSpans().At(0).Spans().At(0)
+	span.SetTraceID(pcommon.TraceID{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16})
+	span.SetSpanID(pcommon.SpanID{1, 2, 3, 4, 5, 6, 7, 8})
+
+	rows := testRowBuilder().buildRows(traces)
+
+	assert.Equal(t, "0102030405060708090a0b0c0d0e0f10", rows[0]["trace_id"], "Trace ID should be hex encoded")
+	assert.Equal(t, "0102030405060708", rows[0]["span_id"], "Span ID should be hex encoded")
+	assert.Equal(t, "", rows[1]["trace_id"], "Unset trace ID should be empty")
+}
+
+func TestBuildRowsSchemaURLs(t *testing.T) {
+	traces := createTestTraces()
+	rspan := traces.ResourceSpans().At(0)
+	rspan.SetSchemaUrl("https://opentelemetry.io/schemas/1.26.0")
+	rspan.ScopeSpans().At(0).SetSchemaUrl("https://opentelemetry.io/schemas/1.24.0")
+	traces.ResourceSpans().AppendEmpty().ScopeSpans().AppendEmpty().Spans().AppendEmpty()
+
+	rows := testRowBuilder().buildRows(traces)
+
+	assert.Equal(t, "https://opentelemetry.io/schemas/1.26.0", rows[0]["resource_schema_url"])
+	assert.Equal(t, "https://opentelemetry.io/schemas/1.24.0", rows[0]["scope_schema_url"])
+	last := rows[len(rows)-1]
+	require.Contains(t, last, "resource_schema_url")
+	assert.Equal(t, "", last["resource_schema_url"], "Unset schema URLs should be empty strings, not NULL")
+	assert.Equal(t, "", last["scope_schema_url"])
+}
+
+func TestBuildRowsTraceStateAndFlags(t *testing.T) {
+	traces := createTestTraces()
+	span := traces.ResourceSpans().At(0).ScopeSpans().At(0).Spans().At(0)
+	span.TraceState().FromRaw("vendor=abc,other=1")
+	span.SetFlags(1)
+
+	rows := testRowBuilder().buildRows(traces)
+
+	assert.Equal(t, "vendor=abc,other=1", rows[0]["trace_state"])
+	assert.Equal(t, int64(1), rows[0]["trace_flags"], "Sampled flag should be set")
+	require.Contains(t, rows[1], "trace_state")
+	assert.Equal(t, "", rows[1]["trace_state"], "Empty tracestate should be an empty string, not NULL")
+	assert.Equal(t, int64(0), rows[1]["trace_flags"])
+}
+
+func TestSplitRowsByCount(t *testing.T) {
+	rows := make([]bigqueryrow, 1200)
+	for i := range rows {
+		rows[i] = bigqueryrow{"name": fmt.Sprintf("span%d", i)}
+	}
+
+	chunks := splitRows(rows, 500, maxInsertRequestBytes)
+
+	assert.Equal(t, 3, len(chunks))
+	assert.Equal(t, 500, len(chunks[0]))
+	assert.Equal(t, 500, len(chunks[1]))
+	assert.Equal(t, 200, len(chunks[2]))
+	assert.Equal(t, "span1199", chunks[2][199]["name"], "Row order should be preserved")
+}
+
+func TestSplitRowsBySize(t *testing.T) {
+	big := bigqueryrow{"name": strings.Repeat("x", 1000)}
+	rows := []bigqueryrow{big, big, big, big, big}
+
+	chunks := splitRows(rows, 500, 2500)
+
+	assert.Equal(t, 3, len(chunks), "Each chunk should fit within the byte limit")
+	assert.Equal(t, 2, len(chunks[0]))
+	assert.Equal(t, 1, len(chunks[2]))
+}
+
+func TestEstimateRowBytes(t *testing.T) {
+	row := bigqueryrow{
+		"name":             "GET /api/v1/orders",
+		"trace_id":         "0102030405060708090a0b0c0d0e0f10",
+		"span_id":          "0102030405060708",
+		"http_status_code": int64(200),
+		"duration_ms":      12.5,
+		"error":            false,
+		"user_agent":       strings.Repeat("a", 200),
+	}
+	encoded, err := json.Marshal(row)
+	require.NoError(t, err)
+
+	assert.InEpsilon(t, len(encoded), estimateRowBytes(row), 0.25, "Estimate should be within 25%% of the encoded row")
+}
+
+func TestEstimateRowBytesRepeated(t *testing.T) {
+	tags := make([]string, 10_000)
+	for i := range tags {
+		tags[i] = fmt.Sprintf("tag-%d", i)
+	}
+	row := bigqueryrow{
+		"name":    "span1",
+		"tags":    tags,
+		"retries": []int64{1, 2, 3},
+		"ratios":  []float64{0.5, 0.25},
+		"flags":   []bool{true, false},
+	}
+	encoded, err := json.Marshal(row)
+	require.NoError(t, err)
+
+	assert.InEpsilon(t, len(encoded), estimateRowBytes(row), 0.25, "Repeated values should be sized by their elements")
+}
+
+func TestEstimateBatchBytes(t *testing.T) {
+	row := bigqueryrow{"name": strings.Repeat("x", 500), "trace_id": "0102030405060708090a0b0c0d0e0f10"}
+	rows := []bigqueryrow{row, row, row}
+	type insertRow struct {
+		InsertID string      `json:"insertId"`
+		JSON     bigqueryrow `json:"json"`
+	}
+	body := struct {
+		Rows           []insertRow `json:"rows"`
+		SkipInvalid    bool        `json:"skipInvalidRows"`
+		IgnoreUnknowns bool        `json:"ignoreUnknownValues"`
+	}{}
+	for _, r := range rows {
+		body.Rows = append(body.Rows, insertRow{InsertID: "0102030405060708090a0b0c0d0e0f100102030405060708", JSON: r})
+	}
+	encoded, err := json.Marshal(body)
+	require.NoError(t, err)
+
+	estimate := estimateBatchBytes(rows)
+
+	assert.InEpsilon(t, len(encoded), estimate, 0.25, "Estimate should be within 25%% of the request body")
+	assert.GreaterOrEqual(t, estimate, len(encoded), "Estimate should err on the large side")
+	assert.Equal(t, insertRequestOverhead, estimateBatchBytes(nil))
+}
+
+func TestSplitRowsMatchesBatchEstimate(t *testing.T) {
+	row := bigqueryrow{"name": strings.Repeat("x", 1000)}
+	rows := []bigqueryrow{row, row, row, row, row}
+	maxBytes := estimateBatchBytes(rows[:2])
+
+	chunks := splitRows(rows, 500, maxBytes)
+
+	require.Len(t, chunks, 3)
+	for _, chunk := range chunks {
+		assert.LessOrEqual(t, estimateBatchBytes(chunk), maxBytes)
+	}
+}
+
+func TestSplitRowsEmpty(t *testing.T) {
+	assert.Empty(t, splitRows(nil, 500, maxInsertRequestBytes))
+}
+
+func TestSanitizeColumnName(t *testing.T) {
+	tests := []struct {
+		name     string
+		key      string
+		expected string
+	}{
+		{name: "valid", key: "str_key", expected: "str_key"},
+		{name: "dots", key: "service.name", expected: "service_name"},
+		{name: "slash", key: "http/method", expected: "http_method"},
+		{name: "leading digit", key: "1st.attempt", expected: "_1st_attempt"},
+		{name: "hyphen and space", key: "user-agent name", expected: "user_agent_name"},
+		{name: "unicode", key: "café.naïve", expected: "caf__na_ve"},
+		{name: "empty", key: "", expected: "_"},
+		{name: "reserved partition prefix", key: "_PARTITIONTIME", expected: "__PARTITIONTIME"},
+		{name: "reserved prefix lowercase", key: "_table_suffix", expected: "__table_suffix"},
+		{name: "reserved root prefix", key: "__root__x", expected: "___root__x"},
+		{name: "reserved file prefix", key: "_File_name", expected: "__File_name"},
+		{name: "reserved row timestamp prefix", key: "_row_timestamp", expected: "__row_timestamp"},
+		{name: "reserved colon prefix", key: "_COLON_x", expected: "__COLON_x"},
+		{name: "reserved after sanitizing", key: "_partition.date", expected: "__partition_date"},
+		{name: "reserved prefix elsewhere", key: "x_PARTITIONTIME", expected: "x_PARTITIONTIME"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, sanitizeColumnName(tt.key))
+		})
+	}
+}
+
+func TestSanitizeColumnNameTruncates(t *testing.T) {
+	long1 := strings.Repeat("a", 400) + "1"
+	long2 := strings.Repeat("a", 400) + "2"
+
+	name1 := sanitizeColumnName(long1)
+	name2 := sanitizeColumnName(long2)
+
+	assert.Equal(t, maxColumnNameLength, len(name1), "Long names should be truncated to the limit")
+	assert.NotEqual(t, name1, name2, "Keys with a shared prefix should not collide")
+	assert.Equal(t, name1, sanitizeColumnName(long1), "Truncation should be stable")
+
+	reserved := sanitizeColumnName("_PARTITION" + strings.Repeat("a", 290))
+	assert.Len(t, reserved, maxColumnNameLength, "Remapped names should still be truncated to the limit")
+	assert.False(t, hasReservedColumnPrefix(reserved))
+}
+
+func TestBuildRowsColumnCollision(t *testing.T) {
+	traces := ptrace.NewTraces()
+	rs := traces.ResourceSpans().AppendEmpty()
+	rs.Resource().Attributes().PutStr("a.b", "resource_value")
+	span := rs.ScopeSpans().AppendEmpty().Spans().AppendEmpty()
+	span.SetName("span1")
+	span.Attributes().PutStr("a_b", "span_value")
+
+	core, logs := observer.New(zap.DebugLevel)
+	rows := newRowBuilder(createTestConfig(), zap.New(core)).buildRows(traces)
+
+	assert.Equal(t, "resource_value", rows[0]["a_b"], "First key should keep the column")
+	assert.Equal(t, "span_value", rows[0][withKeyHash("a_b", "a_b")], "Colliding key should get a hashed column")
+	assert.Equal(t, 1, logs.FilterMessage("Attribute column name collision resolved").Len(), "Collision should be logged")
+}
+
+func TestBuildRowsRepeatedKeyOverwrites(t *testing.T) {
+	traces := ptrace.NewTraces()
+	rs := traces.ResourceSpans().AppendEmpty()
+	rs.Resource().Attributes().PutStr("env", "resource_value")
+	span := rs.ScopeSpans().AppendEmpty().Spans().AppendEmpty()
+	span.Attributes().PutStr("env", "span_value")
+
+	rows := testRowBuilder().buildRows(traces)
+
+	assert.Equal(t, "span_value", rows[0]["env"], "Span attribute should overwrite the same resource attribute")
+	assert.NotContains(t, rows[0], withKeyHash("env", "env"), "Repeated keys should not be disambiguated")
+}
+
+func TestBuildRowsNestResource(t *testing.T) {
+	builder := testRowBuilder()
+	builder.NestResource = true
+
+	rows := builder.buildRows(createTestTraces())
+
+	require.Len(t, rows, 2)
+	assert.Equal(t, map[string]bigquery.Value{
+		"service_name": "service1",
+		"resource_id":  int64(1001),
+	}, rows[0]["resource"], "Resource attributes should be nested")
+	assert.NotContains(t, rows[0], "service_name", "Resource attributes should not be flattened")
+	assert.Equal(t, "value1", rows[0]["str_key"], "Span attributes should stay at the top level")
+	assert.Equal(t, int64(41), rows[0]["int_key"])
+}
+
+func TestBuildRowsNestResourceReservesColumn(t *testing.T) {
+	traces := ptrace.NewTraces()
+	rs := traces.ResourceSpans().AppendEmpty()
+	rs.Resource().Attributes().PutStr("service.name", "service1")
+	span := rs.ScopeSpans().AppendEmpty().Spans().AppendEmpty()
+	span.Attributes().PutStr("resource", "span_value")
+	builder := testRowBuilder()
+	builder.NestResource = true
+
+	rows := builder.buildRows(traces)
+
+	assert.Equal(t, map[string]bigquery.Value{"service_name": "service1"}, rows[0]["resource"])
+	assert.Equal(t, "span_value", rows[0]["attr_resource"], "A span attribute named resource should get its own column")
+}
+
+func TestBuildRowsNestResourceWithoutAttributes(t *testing.T) {
+	traces := ptrace.NewTraces()
+	traces.ResourceSpans().AppendEmpty().ScopeSpans().AppendEmpty().Spans().AppendEmpty()
+	builder := testRowBuilder()
+	builder.NestResource = true
+
+	rows := builder.buildRows(traces)
+
+	assert.NotContains(t, rows[0], "resource", "The column should be NULL without resource attributes")
+}
+
+func TestBuildRowsAttributeColumnPrefix(t *testing.T) {
+	traces := ptrace.NewTraces()
+	rs := traces.ResourceSpans().AppendEmpty()
+	rs.Resource().Attributes().PutStr("service.name", "checkout")
+	span := rs.ScopeSpans().AppendEmpty().Spans().AppendEmpty()
+	span.SetName("GET /cart")
+	span.SetTraceID(pcommon.TraceID{1})
+	span.Attributes().PutStr("name", "attribute_name")
+	span.Attributes().PutStr("trace_id", "attribute_trace_id")
+	builder := testRowBuilder()
+	builder.AttributeColumnPrefix = "attr_"
+
+	rows := builder.buildRows(traces)
+
+	row := rows[0]
+	assert.Equal(t, "GET /cart", row["name"], "An attribute named name should not clobber the span name")
+	assert.Equal(t, span.TraceID().String(), row["trace_id"])
+	assert.Equal(t, "attribute_name", row["attr_name"])
+	assert.Equal(t, "attribute_trace_id", row["attr_trace_id"])
+	assert.Equal(t, "checkout", row["attr_service_name"], "Resource attributes should be prefixed too")
+	assert.Contains(t, row, "ts", "Derived columns should not be prefixed")
+	assert.NotContains(t, row, "attr_ts")
+}
+
+func TestBuildRowsColumnNamespacing(t *testing.T) {
+	traces := ptrace.NewTraces()
+	rs := traces.ResourceSpans().AppendEmpty()
+	rs.Resource().Attributes().PutStr("service.name", "checkout")
+	ss := rs.ScopeSpans().AppendEmpty()
+	ss.Scope().SetName("otelhttp")
+	ss.Scope().Attributes().PutStr("library.tier", "core")
+	span := ss.Spans().AppendEmpty()
+	span.SetName("GET /cart")
+	span.Attributes().PutStr("http.method", "GET")
+	builder := testRowBuilder()
+
+	row := builder.buildRows(traces)[0]
+
+	assert.Equal(t, "checkout", row["service_name"])
+	assert.Equal(t, "GET", row["http_method"])
+	assert.NotContains(t, row, "library_tier", "Scope attributes should not be written without a scope prefix")
+
+	builder.ColumnNamespacing = ColumnNamespacingConfig{Resource: "resource_", Scope: "scope_", Span: "span_"}
+
+	row = builder.buildRows(traces)[0]
+
+	assert.Equal(t, "checkout", row["resource_service_name"], "Resource attributes should get the resource prefix")
+	assert.Equal(t, "core", row["scope_library_tier"], "Scope attributes should get the scope prefix")
+	assert.Equal(t, "GET", row["span_http_method"], "Span attributes should get the span prefix")
+	assert.Equal(t, "GET /cart", row["name"], "Derived columns should not be prefixed")
+	assert.Equal(t, "otelhttp", row["scope_name"])
+	assert.NotContains(t, row, "service_name")
+	assert.NotContains(t, row, "http_method")
+
+	builder.AttributeColumnPrefix = "attr_"
+
+	row = builder.buildRows(traces)[0]
+
+	assert.Equal(t, "checkout", row["attr_resource_service_name"], "Level prefixes should follow attributeColumnPrefix")
+	assert.Equal(t, "core", row["attr_scope_library_tier"])
+	assert.Equal(t, "GET", row["attr_span_http_method"])
+}
+
+func TestBuildRowsColumnNameStyles(t *testing.T) {
+	tests := []struct {
+		style    string
+		prefix   string
+		expected map[string]string
+	}{
+		{style: "", expected: map[string]string{"service_name": "checkout", "http_status_code": "200"}},
+		{style: columnNameStyleSnake, expected: map[string]string{"service_name": "checkout", "http_status_code": "200"}},
+		{style: columnNameStylePreserveDots, expected: map[string]string{"service__name": "checkout", "http__status_code": "200"}},
+		{style: columnNameStyleCamel, expected: map[string]string{"serviceName": "checkout", "httpStatusCode": "200"}},
+		{style: columnNameStyleCamel, prefix: "attr_", expected: map[string]string{"attrServiceName": "checkout", "attrHttpStatusCode": "200"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.style+tt.prefix, func(t *testing.T) {
+			traces := ptrace.NewTraces()
+			rs := traces.ResourceSpans().AppendEmpty()
+			rs.Resource().Attributes().PutStr("service.name", "checkout")
+			span := rs.ScopeSpans().AppendEmpty().Spans().AppendEmpty()
+			span.Attributes().PutStr("http.status_code", "200")
+			builder := testRowBuilder()
+			builder.ColumnNameStyle = tt.style
+			builder.AttributeColumnPrefix = tt.prefix
+
+			rows := builder.buildRows(traces)
+
+			for column, value := range tt.expected {
+				assert.True(t, isValidColumnName(column))
+				assert.Equal(t, value, rows[0][column], "Column %s", column)
+			}
+			assert.Contains(t, rows[0], "trace_id", "Derived columns should keep their names")
+		})
+	}
+}
+
+func TestBuildRowsStandardResourceColumns(t *testing.T) {
+	traces := ptrace.NewTraces()
+	rs := traces.ResourceSpans().AppendEmpty()
+	rs.Resource().Attributes().PutStr("service.name", "checkout")
+	rs.Resource().Attributes().PutStr("host.name", "node-1")
+	rs.Resource().Attributes().PutStr("k8s.pod.name", "checkout-7d9f")
+	rs.Resource().Attributes().PutStr("deployment.environment", "production")
+	rs.Resource().Attributes().PutStr("team", "payments")
+	span := rs.ScopeSpans().AppendEmpty().Spans().AppendEmpty()
+	span.Attributes().PutStr("host.name", "span_host")
+	builder := testRowBuilder()
+	builder.StandardResourceColumns = true
+	builder.AttributeColumnPrefix = "attr_"
+
+	rows := builder.buildRows(traces)
+
+	row := rows[0]
+	assert.Equal(t, "checkout", row["service_name"])
+	assert.Equal(t, "node-1", row["host_name"])
+	assert.Equal(t, "checkout-7d9f", row["k8s_pod_name"])
+	assert.Equal(t, "production", row["deployment_environment"])
+	assert.Equal(t, "payments", row["attr_team"], "Other resource attributes should be prefixed as usual")
+	assert.Equal(t, "span_host", row["attr_host_name"], "Span attributes should not use the standard columns")
+	assert.NotContains(t, row, "attr_service_name")
+}
+
+func TestBuildRowsStandardResourceColumnsNested(t *testing.T) {
+	traces := ptrace.NewTraces()
+	rs := traces.ResourceSpans().AppendEmpty()
+	rs.Resource().Attributes().PutStr("service.name", "checkout")
+	rs.ScopeSpans().AppendEmpty().Spans().AppendEmpty()
+	builder := testRowBuilder()
+	builder.StandardResourceColumns = true
+	builder.NestResource = true
+	builder.AttributeColumnPrefix = "attr_"
+
+	rows := builder.buildRows(traces)
+
+	assert.Equal(t, map[string]bigquery.Value{"service_name": "checkout"}, rows[0]["resource"])
+}
+
+func TestBuildRowsWithoutStandardResourceColumns(t *testing.T) {
+	traces := ptrace.NewTraces()
+	rs := traces.ResourceSpans().AppendEmpty()
+	rs.Resource().Attributes().PutStr("service.name", "checkout")
+	rs.ScopeSpans().AppendEmpty().Spans().AppendEmpty()
+	builder := testRowBuilder()
+	builder.AttributeColumnPrefix = "attr_"
+
+	rows := builder.buildRows(traces)
+
+	assert.Equal(t, "checkout", rows[0]["attr_service_name"])
+	assert.NotContains(t, rows[0], "service_name")
+}
+
+func TestBuildRowsSpanNameColumn(t *testing.T) {
+	traces := ptrace.NewTraces()
+	span := traces.ResourceSpans().AppendEmpty().ScopeSpans().AppendEmpty().Spans().AppendEmpty()
+	span.SetName("GET /cart")
+	span.Attributes().PutStr("name", "attribute_name")
+	builder := testRowBuilder()
+	builder.SpanNameColumn = "span_name"
+
+	rows := builder.buildRows(traces)
+
+	assert.Equal(t, "GET /cart", rows[0]["span_name"], "The span name should be written to spanNameColumn")
+	assert.Equal(t, "attribute_name", rows[0]["name"], "An attribute named name should keep its own column")
+}
+
+func TestBuildRowsEventTimeBounds(t *testing.T) {
+	traces := ptrace.NewTraces()
+	spans := traces.ResourceSpans().AppendEmpty().ScopeSpans().AppendEmpty().Spans()
+	span := spans.AppendEmpty()
+	for _, ts := range []pcommon.Timestamp{1_700_000_002_000_000_000, 1_700_000_001_000_000_000, 1_700_000_003_000_000_000} {
+		span.Events().AppendEmpty().SetTimestamp(ts)
+	}
+	spans.AppendEmpty()
+	builder := testRowBuilder()
+	builder.EmitEventTimeBounds = true
+
+	rows := builder.buildRows(traces)
+
+	assert.Equal(t, pcommon.Timestamp(1_700_000_001_000_000_000), rows[0]["first_event_time"], "The earliest event should be first")
+	assert.Equal(t, pcommon.Timestamp(1_700_000_003_000_000_000), rows[0]["last_event_time"], "The latest event should be last")
+	assert.NotContains(t, rows[1], "first_event_time", "Spans without events should have NULL bounds")
+	assert.NotContains(t, rows[1], "last_event_time")
+}
+
+func TestBuildRowsReservesEventTimeBounds(t *testing.T) {
+	traces := ptrace.NewTraces()
+	rs := traces.ResourceSpans().AppendEmpty()
+	rs.Resource().Attributes().PutStr("first_event_time", "resource_value")
+	spans := rs.ScopeSpans().AppendEmpty().Spans()
+	spans.AppendEmpty()
+	span := spans.AppendEmpty()
+	span.Events().AppendEmpty().SetTimestamp(pcommon.Timestamp(1_700_000_001_000_000_000))
+	builder := testRowBuilder()
+	builder.EmitEventTimeBounds = true
+
+	rows := builder.buildRows(traces)
+
+	require.Len(t, rows, 2)
+	assert.NotContains(t, rows[0], "first_event_time", "The first span has no events, so its bound should be NULL")
+	assert.Equal(t, pcommon.Timestamp(1_700_000_001_000_000_000), rows[1]["first_event_time"], "A resource attribute should not overwrite a later span's bound")
+	for _, row := range rows {
+		assert.Equal(t, "resource_value", row["attr_first_event_time"], "The resource attribute should be remapped on every span")
+	}
+}
+
+func TestBuildRowsRemapsReservedColumns(t *testing.T) {
+	traces := ptrace.NewTraces()
+	span := traces.ResourceSpans().AppendEmpty().ScopeSpans().AppendEmpty().Spans().AppendEmpty()
+	span.SetName("GET /cart")
+	span.Attributes().PutStr("name", "attribute_name")
+	core, logs := observer.New(zap.DebugLevel)
+	builder := testRowBuilder()
+	builder.logger = zap.New(core)
+
+	rows := builder.buildRows(traces)
+
+	assert.Equal(t, "GET /cart", rows[0]["name"], "An attribute named name should not clobber the span name")
+	assert.Equal(t, "attribute_name", rows[0]["attr_name"])
+	remaps := logs.FilterMessage("Attribute column remapped to keep a reserved column").All()
+	require.Len(t, remaps, 1)
+	assert.Equal(t, "attr_name", remaps[0].ContextMap()["column"])
+}
+
+func TestBuildRowsDropsOversizedAttributeJSON(t *testing.T) {
+	traces := ptrace.NewTraces()
+	span := traces.ResourceSpans().AppendEmpty().ScopeSpans().AppendEmpty().Spans().AppendEmpty()
+	span.SetName("GET /cart")
+	span.Attributes().PutStr("http.method", "GET")
+	nested := span.Attributes().PutEmptyMap("request")
+	for i := 0; i < 10; i++ {
+		nested = nested.PutEmptyMap("body")
+		nested.PutStr("payload", strings.Repeat("x", 100))
+	}
+	span.Attributes().PutEmptyMap("small").PutStr("k", "v")
+	core, logs := observer.New(zap.DebugLevel)
+	builder := testRowBuilder()
+	builder.MaxAttributeJSONBytes = 512
+	builder.logger = zap.New(core)
+
+	rows := builder.buildRows(traces)
+
+	assert.NotContains(t, rows[0], "request", "Oversized map should be dropped")
+	assert.Equal(t, `{"k":"v"}`, rows[0]["small"], "Maps within the limit should be kept")
+	assert.Equal(t, "GET", rows[0]["http_method"], "The rest of the row should be kept")
+	assert.Equal(t, "GET /cart", rows[0]["name"])
+	dropped := logs.FilterMessage("Attribute JSON dropped for exceeding maxAttributeJSONBytes").All()
+	require.Len(t, dropped, 1)
+	assert.Equal(t, "request", dropped[0].ContextMap()["key"])
+	assert.Greater(t, dropped[0].ContextMap()["bytes"], int64(512))
+}
+
+func TestBuildRowsPartitionTimestampAttribute(t *testing.T) {
+	start := pcommon.Timestamp(1_700_000_000_000_000_000)
+	eventTime := time.Date(2024, 1, 31, 12, 0, 0, 500, time.UTC)
+	traces := ptrace.NewTraces()
+	spans := traces.ResourceSpans().AppendEmpty().ScopeSpans().AppendEmpty().Spans()
+	for _, value := range []any{eventTime.UnixNano(), eventTime.Format(time.RFC3339Nano), nil, "yesterday"} {
+		span := spans.AppendEmpty()
+		span.SetStartTimestamp(start)
+		if value != nil {
+			require.NoError(t, span.Attributes().PutEmpty("log.time").FromRaw(value))
+		}
+	}
+	builder := testRowBuilder()
+	builder.PartitionTimestampAttribute = "log.time"
+
+	rows := builder.buildRows(traces)
+
+	require.Len(t, rows, 4)
+	assert.Equal(t, pcommon.NewTimestampFromTime(eventTime), rows[0][testPartitionField], "Epoch nanoseconds should be the partition timestamp")
+	assert.Equal(t, pcommon.NewTimestampFromTime(eventTime), rows[1][testPartitionField], "RFC 3339 timestamp should be the partition timestamp")
+	assert.Equal(t, start, rows[2][testPartitionField], "Spans without the attribute should be partitioned on start time")
+	assert.Equal(t, start, rows[3][testPartitionField], "Unparseable attribute should fall back to start time")
+}
+
+func TestBuildRowsPrimaryKey(t *testing.T) {
+	traces := ptrace.NewTraces()
+	spans := traces.ResourceSpans().AppendEmpty().ScopeSpans().AppendEmpty().Spans()
+	for i := 0; i < 2; i++ {
+		span := spans.AppendEmpty()
+		span.SetTraceID(pcommon.TraceID([16]byte{1}))
+		span.SetSpanID(pcommon.SpanID([8]byte{1}))
+		span.SetStartTimestamp(pcommon.Timestamp(1_700_000_000_000_000_000))
+	}
+	distinct := []func(ptrace.Span){
+		func(span ptrace.Span) { span.SetTraceID(pcommon.TraceID([16]byte{2})) },
+		func(span ptrace.Span) { span.SetSpanID(pcommon.SpanID([8]byte{2})) },
+		func(span ptrace.Span) { span.SetStartTimestamp(pcommon.Timestamp(1_700_000_000_000_000_001)) },
+	}
+	for _, change := range distinct {
+		span := spans.AppendEmpty()
+		spans.At(0).CopyTo(span)
+		change(span)
+	}
+	builder := testRowBuilder()
+	builder.PrimaryKeyColumn = "span_key"
+
+	rows := builder.buildRows(traces)
+
+	require.Len(t, rows, 5)
+	assert.NotEmpty(t, rows[0]["span_key"])
+	assert.Equal(t, rows[0]["span_key"], rows[1]["span_key"], "Identical spans should have the same key")
+	keys := map[any]bool{}
+	for _, row := range rows[1:] {
+		keys[row["span_key"]] = true
+	}
+	assert.Len(t, keys, 4, "Spans differing in trace ID, span ID or start time should have distinct keys")
+	assert.Equal(t, rows[0]["span_key"], builder.buildRows(traces)[0]["span_key"], "Keys should be stable across builds")
+}
+
+func TestBuildRowsStableColumnSet(t *testing.T) {
+	traces := ptrace.NewTraces()
+	spans := traces.ResourceSpans().AppendEmpty().ScopeSpans().AppendEmpty().Spans()
+	spans.AppendEmpty().Attributes().PutStr("http.method", "GET")
+	spans.AppendEmpty().Attributes().PutStr("db.system", "postgresql")
+	builder := testRowBuilder()
+	builder.StableColumnSet = []string{"http_method", "db_system"}
+
+	rows := builder.buildRows(traces)
+
+	require.Len(t, rows, 2)
+	assert.Equal(t, "GET", rows[0]["http_method"])
+	assert.Contains(t, rows[0], "db_system", "A missing stable column should be written")
+	assert.Nil(t, rows[0]["db_system"], "A missing stable column should be NULL")
+	assert.Contains(t, rows[1], "http_method")
+	assert.Nil(t, rows[1]["http_method"])
+	assert.Equal(t, "postgresql", rows[1]["db_system"])
+}
+
+func TestBuildRowsAttributeFilters(t *testing.T) {
+	tests := []struct {
+		name     string
+		include  []string
+		exclude  []string
+		expected []string
+		dropped  []string
+	}{
+		{
+			name:     "include only",
+			include:  []string{"service.name", "str_key"},
+			expected: []string{"service_name", "str_key"},
+			dropped:  []string{"resource_id", "int_key", "double_key"},
+		},
+		{
+			name:     "exclude only",
+			exclude:  []string{"service.name", "int_key"},
+			expected: []string{"resource_id", "str_key", "double_key"},
+			dropped:  []string{"service_name", "int_key"},
+		},
+		{
+			name:     "exclude takes precedence",
+			include:  []string{"str_key", "int_key"},
+			exclude:  []string{"int_key"},
+			expected: []string{"str_key"},
+			dropped:  []string{"service_name", "int_key", "double_key"},
+		},
+		{
+			name:     "sanitized key does not match",
+			exclude:  []string{"service_name"},
+			expected: []string{"service_name"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := createTestConfig()
+			cfg.IncludeAttributes = tt.include
+			cfg.ExcludeAttributes = tt.exclude
+
+			rows := newRowBuilder(cfg, zap.NewNop()).buildRows(createTestTraces())
+
+			assert.Equal(t, "span1", rows[0]["name"], "Derived columns should not be filtered")
+			for _, column := range tt.expected {
+				assert.Contains(t, rows[0], column)
+			}
+			for _, column := range tt.dropped {
+				assert.NotContains(t, rows[0], column)
+			}
+		})
+	}
+}
+
+func TestBuildRowsEvents(t *testing.T) {
+	traces := createTestTraces()
+	span := traces.ResourceSpans().At(0).ScopeSpans().At(0).Spans().At(0)
+	event1 := span.Events().AppendEmpty()
+	event1.SetName("cache.miss")
+	event1.SetTimestamp(pcommon.NewTimestampFromTime(time.Date(2025, 5, 1, 12, 0, 0, 0, time.UTC)))
+	event1.Attributes().PutStr("cache.key", "user:1")
+	event2 := span.Events().AppendEmpty()
+	event2.SetName("retry")
+	event2.SetTimestamp(pcommon.NewTimestampFromTime(time.Date(2025, 5, 1, 12, 0, 1, 500, time.UTC)))
+
+	rows := testRowBuilder().buildRows(traces)
+
+	var events []map[string]any
+	require.NoError(t, json.Unmarshal([]byte(rows[0]["events"].(string)), &events))
+	assert.Equal(t, []map[string]any{
+		{
+			"name":       "cache.miss",
+			"timestamp":  "2025-05-01T12:00:00Z",
+			"attributes": map[string]any{"cache.key": "user:1"},
+		},
+		{
+			"name":       "retry",
+			"timestamp":  "2025-05-01T12:00:01.0000005Z",
+			"attributes": map[string]any{},
+		},
+	}, events)
+	assert.Equal(t, "[]", rows[1]["events"], "Spans without events should have an empty array")
+}
+
+func TestBuildRowsEventsDisabled(t *testing.T) {
+	cfg := createTestConfig()
+	cfg.IncludeEvents = false
+
+	rows := newRowBuilder(cfg, zap.NewNop()).buildRows(createTestTraces())
+
+	assert.NotContains(t, rows[0], "events")
+}
+
+func TestBuildRowsLinks(t *testing.T) {
+	traces := createTestTraces()
+	span := traces.ResourceSpans().At(0).ScopeSpans().At(0).Spans().At(0)
+	link := span.Links().AppendEmpty()
+	link.SetTraceID(pcommon.TraceID{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16})
+	link.SetSpanID(pcommon.SpanID{1, 2, 3, 4, 5, 6, 7, 8})
+	link.Attributes().PutStr("link.kind", "follows_from")
+	cfg := createTestConfig()
+	cfg.IncludeLinks = true
+
+	rows := newRowBuilder(cfg, zap.NewNop()).buildRows(traces)
+
+	assert.Contains(t, rows[0]["links"], `"trace_id":"0102030405060708090a0b0c0d0e0f10"`, "Link trace ID should be hex encoded")
+	var links []map[string]any
+	require.NoError(t, json.Unmarshal([]byte(rows[0]["links"].(string)), &links))
+	assert.Equal(t, 1, len(links))
+	assert.Equal(t, "0102030405060708", links[0]["span_id"])
+	assert.Equal(t, map[string]any{"link.kind": "follows_from"}, links[0]["attributes"])
+}
+
+func TestBuildRowsLinksDisabled(t *testing.T) {
+	rows := testRowBuilder().buildRows(createTestTraces())
+
+	assert.NotContains(t, rows[0], "links")
+}
+
+func TestBuildRowsRawSpan(t *testing.T) {
+	traces := createTestTraces()
+	rspan := traces.ResourceSpans().At(0)
+	rspan.Resource().Attributes().PutStr("service.name", "checkout")
+	span := rspan.ScopeSpans().At(0).Spans().At(0)
+	span.Attributes().PutInt("http.status_code", 200)
+	builder := testRowBuilder()
+	builder.IncludeRawSpan = true
+
+	rows := builder.buildRows(traces)
+
+	require.Contains(t, rows[0], "raw_span")
+	raw, err := (&ptrace.JSONUnmarshaler{}).UnmarshalTraces([]byte(rows[0]["raw_span"].(string)))
+	require.NoError(t, err)
+	require.Equal(t, 1, raw.SpanCount(), "Each row should carry only its own span")
+	rawResource := raw.ResourceSpans().At(0)
+	rawSpan := rawResource.ScopeSpans().At(0).Spans().At(0)
+	assert.Equal(t, span.Name(), rawSpan.Name())
+	assert.Equal(t, "test_scope", rawResource.ScopeSpans().At(0).Scope().Name())
+	serviceName, _ := rawResource.Resource().Attributes().Get("service.name")
+	assert.Equal(t, "checkout", serviceName.Str())
+	assert.Equal(t, span.Name(), rows[0]["name"], "Flattened columns should still be exported")
+	assert.Equal(t, int64(200), rows[0]["http_status_code"])
+}
+
+func TestBuildRowsRawSpanDisabled(t *testing.T) {
+	rows := testRowBuilder().buildRows(createTestTraces())
+
+	assert.NotContains(t, rows[0], "raw_span")
+}
+
+func TestBuildRowsOnlyErrors(t *testing.T) {
+	traces := ptrace.NewTraces()
+	spans := traces.ResourceSpans().AppendEmpty().ScopeSpans().AppendEmpty().Spans()
+	okSpan := spans.AppendEmpty()
+	okSpan.SetName("ok_span")
+	okSpan.Status().SetCode(ptrace.StatusCodeOk)
+	errorSpan := spans.AppendEmpty()
+	errorSpan.SetName("error_span")
+	errorSpan.Status().SetCode(ptrace.StatusCodeError)
+	spans.AppendEmpty().SetName("unset_span")
+	builder := testRowBuilder()
+
+	assert.Len(t, builder.buildRows(traces), 3, "All spans should be exported by default")
+
+	builder.OnlyExportErrors = true
+	rows := builder.buildRows(traces)
+
+	require.Len(t, rows, 1, "Only the error span should be exported")
+	assert.Equal(t, "error_span", rows[0]["name"])
+}
+
+func TestBuildRowsRequireSampledFlag(t *testing.T) {
+	traces := ptrace.NewTraces()
+	spans := traces.ResourceSpans().AppendEmpty().ScopeSpans().AppendEmpty().Spans()
+	sampled := spans.AppendEmpty()
+	sampled.SetName("sampled_span")
+	sampled.SetFlags(traceFlagsSampled)
+	spans.AppendEmpty().SetName("unsampled_span")
+	builder := testRowBuilder()
+
+	assert.Len(t, builder.buildRows(traces), 2, "All spans should be exported by default")
+
+	builder.RequireSampledFlag = true
+	rows := builder.buildRows(traces)
+
+	require.Len(t, rows, 1, "Only the sampled span should be exported")
+	assert.Equal(t, "sampled_span", rows[0]["name"])
+}
+
+func TestBuildRowsSampleByTraceID(t *testing.T) {
+	builder := testRowBuilder()
+	builder.SampleRatio = 0.5
+	builder.SampleByTraceID = true
+	traces := ptrace.NewTraces()
+	spans := traces.ResourceSpans().AppendEmpty().ScopeSpans().AppendEmpty().Spans()
+	for i := 0; i < 100; i++ {
+		traceID := pcommon.TraceID{byte(i), 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}
+		for j := 0; j < 3; j++ {
+			span := spans.AppendEmpty()
+			span.SetTraceID(traceID)
+			span.SetSpanID(pcommon.SpanID{byte(i), byte(j), 1, 2, 3, 4, 5, 6})
+		}
+	}
+
+	rows := builder.buildRows(traces)
+
+	perTrace := map[any]int{}
+	for _, row := range rows {
+		perTrace[row["trace_id"]]++
+	}
+	for traceID, count := range perTrace {
+		assert.Equal(t, 3, count, "Trace %s should be kept whole", traceID)
+	}
+	assert.InDelta(t, 50, len(perTrace), 20, "About half the traces should be kept")
+	assert.Equal(t, rows, builder.buildRows(traces), "Sampling should be deterministic")
+}
+
+func TestSampled(t *testing.T) {
+	builder := testRowBuilder()
+	traceID := pcommon.TraceID{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16}
+	spanID := pcommon.SpanID{1, 2, 3, 4, 5, 6, 7, 8}
+
+	builder.SampleRatio = 0.5
+	first := builder.sampled(traceID, spanID)
+	for i := 0; i < 10; i++ {
+		assert.Equal(t, first, builder.sampled(traceID, spanID), "The same span should get the same decision")
+	}
+
+	builder.SampleRatio = math.SmallestNonzeroFloat64
+	assert.False(t, builder.sampled(traceID, spanID), "A tiny ratio should drop the span")
+
+	builder.SampleRatio = 1
+	assert.True(t, builder.exportSpan(ptrace.NewSpan()), "A ratio of 1 should keep every span")
+}
+
+func TestBuildRowsSampleBySpan(t *testing.T) {
+	builder := testRowBuilder()
+	builder.SampleRatio = 0.5
+	traces := ptrace.NewTraces()
+	spans := traces.ResourceSpans().AppendEmpty().ScopeSpans().AppendEmpty().Spans()
+	traceID := pcommon.TraceID{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16}
+	for i := 0; i < 200; i++ {
+		span := spans.AppendEmpty()
+		span.SetTraceID(traceID)
+		span.SetSpanID(pcommon.SpanID{byte(i), byte(i >> 8), 1, 2, 3, 4, 5, 6})
+	}
+
+	rows := builder.buildRows(traces)
+
+	assert.InDelta(t, 100, len(rows), 40, "Spans of one trace should be sampled individually")
+}
+
+func TestBuildRowsDroppedCounts(t *testing.T) {
+	traces := createTestTraces()
+	span := traces.ResourceSpans().At(0).ScopeSpans().At(0).Spans().At(0)
+	span.SetDroppedAttributesCount(3)
+
+	rows := testRowBuilder().buildRows(traces)
+
+	assert.Equal(t, int64(3), rows[0]["dropped_attributes_count"])
+	assert.Equal(t, int64(0), rows[0]["dropped_events_count"], "Zero counts should be written")
+	assert.Equal(t, int64(0), rows[0]["dropped_links_count"], "Zero counts should be written")
+	assert.Equal(t, int64(0), rows[1]["dropped_attributes_count"], "Zero counts should be written")
+}
+
+func TestBuildRowsPartitionField(t *testing.T) {
+	cfg := createTestConfig()
+	cfg.PartitionField = "start_time"
+	traces := createTestTraces()
+	span := traces.ResourceSpans().At(0).ScopeSpans().At(0).Spans().At(0)
+
+	rows := newRowBuilder(cfg, zap.NewNop()).buildRows(traces)
+
+	assert.Equal(t, span.StartTimestamp(), rows[0]["start_time"], "Start timestamp should populate the partition field")
+	assert.NotContains(t, rows[0], "ts")
+}
+
+func TestBuildRowsEmptyAttributeValues(t *testing.T) {
+	traces := createTestTraces()
+	span := traces.ResourceSpans().At(0).ScopeSpans().At(0).Spans().At(0)
+	span.Attributes().PutEmpty("empty_key")
+
+	rows := testRowBuilder().buildRows(traces)
+	assert.NotContains(t, rows[0], "empty_key", "Empty values should be skipped by default")
+
+	cfg := createTestConfig()
+	cfg.EmptyAttributeValues = "null"
+	rows = newRowBuilder(cfg, zap.NewNop()).buildRows(traces)
+	require.Contains(t, rows[0], "empty_key")
+	assert.Nil(t, rows[0]["empty_key"], "Empty values should be NULL when configured")
+}
+
+// Value types fed to FuzzAttributeColumn. Map values are left out: they have
+// no BigQuery type, and rows with them are dead-lettered (see
+// splitUnmappableRows).
+const (
+	fuzzStr uint8 = iota
+	fuzzInt
+	fuzzDouble
+	fuzzBool
+	fuzzBytes
+	fuzzSlice
+	fuzzEmpty
+	fuzzValueTypes
+)
+
+// ColumnNameStyle options fed to FuzzAttributeColumn.
+var fuzzColumnNameStyles = []string{"", columnNameStyleSnake, columnNameStylePreserveDots, columnNameStyleCamel}
+
+var validColumnName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]{0,299}$`)
+
+func FuzzAttributeColumn(f *testing.F) {
+	// The TestAddKeyValue cases.
+	f.Add("str_key", uint8(0), "", "", fuzzStr, "string_value", int64(0), 0.0, false, []byte(nil))
+	f.Add("int_key", uint8(0), "", "", fuzzInt, "", int64(123), 0.0, false, []byte(nil))
+	f.Add("double_key", uint8(0), "", "", fuzzDouble, "", int64(0), 1.23, false, []byte(nil))
+	f.Add("bool_key", uint8(0), "", "", fuzzBool, "", int64(0), 0.0, true, []byte(nil))
+	f.Add("service.name", uint8(0), "", "", fuzzStr, "test_service", int64(0), 0.0, false, []byte(nil))
+	// Keys that need sanitizing.
+	f.Add("", uint8(0), "", "", fuzzBytes, "", int64(0), 0.0, false, []byte{0xff})
+	f.Add("1st\x00keyé", uint8(0), "", "", fuzzSlice, "a", int64(-1), 0.0, true, []byte(nil))
+	f.Add(strings.Repeat("k", 400), uint8(0), "", "", fuzzEmpty, "", int64(0), 0.0, false, []byte(nil))
+	// Name styles, prefixes and namespacing.
+	f.Add("http.status_code", uint8(2), "attr_", "", fuzzInt, "", int64(200), 0.0, false, []byte(nil))
+	f.Add("http.status_code", uint8(3), "", "span.", fuzzInt, "", int64(200), 0.0, false, []byte(nil))
+	// Keys that become reserved names.
+	f.Add("_PARTITIONTIME", uint8(0), "", "", fuzzStr, "a", int64(0), 0.0, false, []byte(nil))
+	f.Add("table_suffix", uint8(1), "_", "", fuzzStr, "a", int64(0), 0.0, false, []byte(nil))
+	f.Add("ROOT__.x", uint8(2), "", "_", fuzzStr, "a", int64(0), 0.0, false, []byte(nil))
+
+	f.Fuzz(func(t *testing.T, key string, style uint8, prefix, namespace string, valueType uint8, s string, i int64, d float64, b bool, bs []byte) {
+		cfg := createTestConfig()
+		cfg.ColumnNameStyle = fuzzColumnNameStyles[int(style)%len(fuzzColumnNameStyles)]
+		// Configs with invalid prefixes are rejected by Validate.
+		if validateColumnPrefix(prefix) == nil {
+			cfg.AttributeColumnPrefix = prefix
+		}
+		if validateColumnPrefix(namespace) == nil {
+			cfg.ColumnNamespacing.Span = namespace
+		}
+
+		v := pcommon.NewValueEmpty()
+		switch valueType % fuzzValueTypes {
+		case fuzzStr:
+			v.SetStr(s)
+		case fuzzInt:
+			v.SetInt(i)
+		case fuzzDouble:
+			v.SetDouble(d)
+		case fuzzBool:
+			v.SetBool(b)
+		case fuzzBytes:
+			v.SetEmptyBytes().FromRaw(bs)
+		case fuzzSlice:
+			slice := v.SetEmptySlice()
+			slice.AppendEmpty().SetStr(s)
+			slice.AppendEmpty().SetInt(i)
+			slice.AppendEmpty().SetBool(b)
+		}
+
+		column := cfg.attributeColumn(key)
+		row := bigqueryrow{}
+		row.setValue(column, v)
+
+		assert.Regexp(t, validColumnName, column, "Column name should be a valid BigQuery identifier")
+		assert.False(t, hasReservedColumnPrefix(column), "Column name %q should not have a reserved prefix", column)
+		require.Len(t, row, 1)
+		_, err := inferFieldType(column, row[column])
+		assert.NoError(t, err, "Value should have a BigQuery type")
+	})
+}
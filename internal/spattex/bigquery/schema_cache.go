@@ -0,0 +1,89 @@
+package bigquery
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+
+	"cloud.google.com/go/bigquery"
+	"google.golang.org/api/googleapi"
+)
+
+// Table operations for creating the target table and reading and extending
+// its schema. Satisfied by *bigquery.Table.
+type schemaManager interface {
+	Create(ctx context.Context, tm *bigquery.TableMetadata) error
+	Metadata(ctx context.Context, opts ...bigquery.TableMetadataOption) (*bigquery.TableMetadata, error)
+	Update(ctx context.Context, tm bigquery.TableMetadataToUpdate, etag string, opts ...bigquery.TableUpdateOption) (*bigquery.TableMetadata, error)
+}
+
+// The target table schema as last fetched or updated by this exporter, so new
+// fields can be identified without a Metadata call on every failed insert.
+// The ETag guards schema updates against concurrent writers.
+type schemaCache struct {
+	mu     sync.Mutex
+	loaded bool
+	fields bigquery.Schema
+	types  map[string]bigquery.FieldType
+	// Columns in types that are REPEATED.
+	repeated map[string]bool
+	etag     string
+	// TABLE, or e.g. VIEW if the exporter is misconfigured with a view.
+	tableType bigquery.TableType
+
+	// Columns missing from a rigid schema that have been logged, so each is
+	// only logged once.
+	unmapped map[string]bool
+
+	// The table is missing, and will be created from the first batch; see
+	// AutodetectSchemaFromFirstBatch.
+	pendingCreate bool
+}
+
+// Replace the cached schema with the table's current metadata.
+// The caller must hold mu.
+func (c *schemaCache) set(meta *bigquery.TableMetadata) {
+	c.fields = meta.Schema
+	c.types = make(map[string]bigquery.FieldType, len(meta.Schema))
+	c.repeated = make(map[string]bool)
+	for _, field := range meta.Schema {
+		c.types[field.Name] = field.Type
+		if field.Repeated {
+			c.repeated[field.Name] = true
+		}
+	}
+	c.etag = meta.ETag
+	c.tableType = meta.Type
+	c.loaded = true
+}
+
+// Force the next lookup to fetch the schema from BigQuery.
+// The caller must hold mu.
+func (c *schemaCache) invalidate() {
+	c.loaded = false
+}
+
+// Fetch the schema if it isn't cached yet.
+// The caller must hold mu.
+func (c *schemaCache) load(ctx context.Context, table schemaManager) error {
+	if c.loaded {
+		return nil
+	}
+	meta, err := table.Metadata(ctx)
+	if err != nil {
+		return err
+	}
+	c.set(meta)
+	return nil
+}
+
+// Schema updates that lose an ETag race with another writer are retried
+// against the refetched schema up to this many times in total.
+const maxSchemaUpdateAttempts = 3
+
+// The schema was changed by another writer since it was cached.
+func isETagConflict(err error) bool {
+	var apiErr *googleapi.Error
+	return errors.As(err, &apiErr) && apiErr.Code == http.StatusPreconditionFailed
+}
@@ -0,0 +1,119 @@
+package bigquery
+
+import (
+	"context"
+	"sync"
+
+	"go.opentelemetry.io/collector/consumer/consumererror"
+	"go.opentelemetry.io/collector/pdata/plog"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+)
+
+/*
+The retry queue resends a failed export's whole batch, rebuilding its rows.
+When the insert failed after some rows were already settled, i.e. inserted
+(e.g. with SkipInvalidRows) or dropped and dead-lettered as they can never be
+inserted, resending them would insert or dead-letter them twice. So failed
+exports return only the spans or log records whose rows didn't settle, which
+the retry queue resends instead of the batch.
+
+Rows are matched to spans and log records by insertID (see Deduplicate),
+whether or not Deduplicate is set. Metric rows and the rows of log records
+emitted outside spans have none, so they're always resent, as are rows whose
+IDs a RowTransformer changed.
+*/
+
+// The insertIDs of a batch's settled rows. Safe for concurrent use. A nil
+// *settledRows records nothing.
+type settledRows struct {
+	mu  sync.Mutex
+	ids map[string]bool
+}
+
+func (s *settledRows) add(rows []bigqueryrow, tsColumn string) {
+	if s == nil || len(rows) == 0 {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ids == nil {
+		s.ids = make(map[string]bool, len(rows))
+	}
+	for _, row := range rows {
+		if id := row.insertID(tsColumn); id != "" {
+			s.ids[id] = true
+		}
+	}
+}
+
+func (s *settledRows) has(id string) bool {
+	if s == nil {
+		return false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.ids[id]
+}
+
+func (s *settledRows) empty() bool {
+	if s == nil {
+		return true
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.ids) == 0
+}
+
+type settledRowsKey struct{}
+
+// A context carrying an export's settled rows from the inserts that settle
+// them to the export, which leaves them out of the retry.
+func contextWithSettledRows(ctx context.Context, settled *settledRows) context.Context {
+	return context.WithValue(ctx, settledRowsKey{}, settled)
+}
+
+func settledRowsFromContext(ctx context.Context) *settledRows {
+	settled, _ := ctx.Value(settledRowsKey{}).(*settledRows)
+	return settled
+}
+
+// The error for an export of td that failed with err: with only the spans
+// whose rows didn't settle, for the retry queue to resend, if any did.
+func unsettledTracesError(err error, td ptrace.Traces, settled *settledRows) error {
+	if err == nil || consumererror.IsPermanent(err) || settled.empty() {
+		return err
+	}
+	retry := ptrace.NewTraces()
+	td.CopyTo(retry)
+	retry.ResourceSpans().RemoveIf(func(rspan ptrace.ResourceSpans) bool {
+		rspan.ScopeSpans().RemoveIf(func(sspan ptrace.ScopeSpans) bool {
+			sspan.Spans().RemoveIf(func(span ptrace.Span) bool {
+				return settled.has(span.TraceID().String() + span.SpanID().String())
+			})
+			return sspan.Spans().Len() == 0
+		})
+		return rspan.ScopeSpans().Len() == 0
+	})
+	return consumererror.NewTraces(err, retry)
+}
+
+// The error for an export of ld that failed with err: with only the log
+// records whose rows didn't settle, for the retry queue to resend, if any
+// did.
+func unsettledLogsError(err error, ld plog.Logs, settled *settledRows) error {
+	if err == nil || consumererror.IsPermanent(err) || settled.empty() {
+		return err
+	}
+	retry := plog.NewLogs()
+	ld.CopyTo(retry)
+	retry.ResourceLogs().RemoveIf(func(rlog plog.ResourceLogs) bool {
+		rlog.ScopeLogs().RemoveIf(func(slog plog.ScopeLogs) bool {
+			slog.LogRecords().RemoveIf(func(record plog.LogRecord) bool {
+				return settled.has(logInsertID(record.TraceID().String(), record.SpanID().String(), logTimestamp(record), record.Body().AsString()))
+			})
+			return slog.LogRecords().Len() == 0
+		})
+		return rlog.ScopeLogs().Len() == 0
+	})
+	return consumererror.NewLogs(err, retry)
+}
@@ -0,0 +1,83 @@
+package bigquery
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/consumer/consumererror"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/plog"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+)
+
+func TestConsumeTracesRetriesOnlyUnsettledSpans(t *testing.T) {
+	rowErrs := bigquery.PutMultiError{
+		{RowIndex: 0, Errors: bigquery.MultiError{&bigquery.Error{Reason: "invalid", Message: "Cannot convert value to integer."}}},
+		{RowIndex: 1, Errors: bigquery.MultiError{&bigquery.Error{Reason: "invalid", Message: "no such field: new_key."}}},
+	}
+	inserter, deadLetters := &fakeInserter{errs: []error{rowErrs}}, &fakeInserter{}
+	table := newFakeSchemaManager(bigquery.Schema{{Name: "name", Type: bigquery.StringFieldType}})
+	cfg := createTestConfig()
+	cfg.SchemaFlexible = true
+	cfg.SkipInvalidRows = true
+	sender := newTestSender(t, withConfig(cfg), withInserter(inserter), withDeadLetters(deadLetters), withTableClients(nil, table))
+	traces := ptrace.NewTraces()
+	spans := traces.ResourceSpans().AppendEmpty().ScopeSpans().AppendEmpty().Spans()
+	for i, name := range []string{"invalid", "missing_field", "inserted"} {
+		span := spans.AppendEmpty()
+		span.SetName(name)
+		span.SetTraceID(pcommon.TraceID([16]byte{1}))
+		span.SetSpanID(pcommon.SpanID([8]byte{byte(i + 1)}))
+	}
+	spans.At(1).Attributes().PutInt("new_key", 1)
+
+	err := sender.consumeTraces(context.Background(), traces)
+
+	require.Error(t, err)
+	var retry consumererror.Traces
+	require.True(t, errors.As(err, &retry), "Only the unsettled spans should be returned for retry")
+	require.Equal(t, 1, retry.Data().SpanCount())
+	require.NoError(t, sender.consumeTraces(context.Background(), retry.Data()))
+
+	assert.Equal(t, []int{3, 1}, inserter.putSizes, "The retry should resend only the span with the missing field")
+	assert.Equal(t, "missing_field", savedRow(t, inserter.rows[3])["name"])
+	assert.Equal(t, []int{1}, deadLetters.putSizes, "The invalid span should be dead-lettered once")
+}
+
+func TestConsumeLogsRetriesOnlyUnsettledRecords(t *testing.T) {
+	rowErrs := bigquery.PutMultiError{
+		{RowIndex: 0, Errors: bigquery.MultiError{&bigquery.Error{Reason: "invalid", Message: "no such field: new_key."}}},
+		{RowIndex: 1, Errors: bigquery.MultiError{&bigquery.Error{Reason: "stopped"}}},
+	}
+	inserter := &fakeInserter{errs: []error{rowErrs}}
+	table := newFakeSchemaManager(bigquery.Schema{{Name: "body", Type: bigquery.StringFieldType}})
+	cfg := createTestConfig()
+	cfg.SchemaFlexible = true
+	sender := newTestSender(t, withConfig(cfg), withInserter(inserter), withTableClients(nil, table))
+	logs := plog.NewLogs()
+	records := logs.ResourceLogs().AppendEmpty().ScopeLogs().AppendEmpty().LogRecords()
+	for _, body := range []string{"missing field", "stopped", "inserted"} {
+		record := records.AppendEmpty()
+		record.Body().SetStr(body)
+		record.SetTraceID(pcommon.TraceID([16]byte{1}))
+		record.SetSpanID(pcommon.SpanID([8]byte{1}))
+		record.SetTimestamp(pcommon.Timestamp(1_706_702_400_000_000_000))
+	}
+	records.At(0).Attributes().PutInt("new_key", 1)
+
+	err := sender.consumeLogs(context.Background(), logs)
+
+	require.Error(t, err)
+	var retry consumererror.Logs
+	require.True(t, errors.As(err, &retry), "Only the unsettled log records should be returned for retry")
+	require.Equal(t, 2, retry.Data().LogRecordCount(), "The inserted record shouldn't be retried")
+	require.NoError(t, sender.consumeLogs(context.Background(), retry.Data()))
+
+	assert.Equal(t, []int{3, 2}, inserter.putSizes)
+	assert.Equal(t, "missing field", savedRow(t, inserter.rows[3])["body"])
+	assert.Equal(t, "stopped", savedRow(t, inserter.rows[4])["body"])
+}
@@ -0,0 +1,280 @@
+package bigquery
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"cloud.google.com/go/bigquery"
+	"cloud.google.com/go/bigquery/storage/managedwriter"
+	"cloud.google.com/go/bigquery/storage/managedwriter/adapt"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+/*
+Storage Write API
+
+With UseStorageWriteAPI (or UseGRPC), rows are appended to the table's
+default stream over gRPC, rather than inserted with the legacy REST streaming
+API. The default stream has the same at-least-once semantics as streaming
+inserts, at lower cost and higher throughput.
+
+Rows are encoded as protocol buffer messages that match the table schema, so
+the exporter keeps the schema cache warm and rebuilds the message descriptor
+whenever the cached schema changes.
+
+Schema changes are more limited than with streaming inserts:
+-> A row with a field missing from the table schema fails the append with a
+"no such field" error, which triggers a schema update when the schema is
+flexible, as for streaming inserts.
+-> After a schema update, the default stream may keep rejecting the new
+fields for several minutes, until the change propagates to the Storage Write
+backend. Leave retries to the retry queue (SchemaUpdateSettleDelay 0) rather
+than waiting in the export goroutine.
+-> insertIDs aren't supported, so Deduplicate has no effect.
+-> NUMERIC and BIGNUMERIC columns, created by older versions of the exporter,
+aren't supported.
+*/
+
+// Appends encoded rows to a write stream, waiting for the result.
+// Satisfied by managedStreamAppender.
+type rowAppender interface {
+	appendRows(ctx context.Context, data [][]byte, opts ...managedwriter.AppendOption) error
+}
+
+// Adapts a managed stream to rowAppender.
+type managedStreamAppender struct {
+	stream *managedwriter.ManagedStream
+}
+
+func (a managedStreamAppender) appendRows(ctx context.Context, data [][]byte, opts ...managedwriter.AppendOption) error {
+	result, err := a.stream.AppendRows(ctx, data, opts...)
+	if err != nil {
+		return err
+	}
+	_, err = result.GetResult(ctx)
+	return err
+}
+
+// Opens the table's default stream, using client.
+func defaultStreamOpener(client *managedwriter.Client, tablePath string) func(context.Context, *descriptorpb.DescriptorProto) (rowAppender, error) {
+	return func(ctx context.Context, descriptor *descriptorpb.DescriptorProto) (rowAppender, error) {
+		stream, err := client.NewManagedStream(ctx,
+			managedwriter.WithDestinationTable(tablePath),
+			managedwriter.WithType(managedwriter.DefaultStream),
+			managedwriter.WithSchemaDescriptor(descriptor))
+		if err != nil {
+			return nil, fmt.Errorf("open write stream: %w", err)
+		}
+		return managedStreamAppender{stream}, nil
+	}
+}
+
+// A rowInserter that appends rows with the Storage Write API. The stream is
+// opened on first use, with a descriptor for the schema cached at the time.
+// Appends aren't serialized, so with MaxConcurrentInserts, sub-batches are
+// appended at once.
+type storageWriteInserter struct {
+	schema        *schemaCache
+	schemaManager schemaManager
+	openStream    func(context.Context, *descriptorpb.DescriptorProto) (rowAppender, error)
+
+	// Guards the stream and descriptor, not appends.
+	mu         sync.Mutex
+	stream     rowAppender
+	etag       string
+	message    protoreflect.MessageDescriptor
+	descriptor *descriptorpb.DescriptorProto
+}
+
+func newStorageWriteInserter(client *managedwriter.Client, tablePath string, schema *schemaCache, table schemaManager) *storageWriteInserter {
+	return &storageWriteInserter{
+		schema:        schema,
+		schemaManager: table,
+		openStream:    defaultStreamOpener(client, tablePath),
+	}
+}
+
+func (w *storageWriteInserter) Put(ctx context.Context, src interface{}) error {
+	savers, ok := src.([]bigquery.ValueSaver)
+	if !ok {
+		return fmt.Errorf("unsupported row type %T", src)
+	}
+
+	w.mu.Lock()
+	schemaChanged, err := w.refreshDescriptor(ctx)
+	message, descriptor := w.message, w.descriptor
+	w.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	data := make([][]byte, len(savers))
+	for i, saver := range savers {
+		row, _, err := saver.Save()
+		if err != nil {
+			return err
+		}
+		if data[i], err = encodeRow(message, row); err != nil {
+			return err
+		}
+	}
+
+	stream, opened, err := w.openedStream(ctx, descriptor)
+	if err != nil {
+		return err
+	}
+	if schemaChanged && !opened {
+		return stream.appendRows(ctx, data, managedwriter.UpdateSchemaDescriptor(descriptor))
+	}
+	return stream.appendRows(ctx, data)
+}
+
+// The stream, opening it with descriptor if it isn't yet, and whether this
+// call opened it.
+func (w *storageWriteInserter) openedStream(ctx context.Context, descriptor *descriptorpb.DescriptorProto) (rowAppender, bool, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.stream != nil {
+		return w.stream, false, nil
+	}
+	stream, err := w.openStream(ctx, descriptor)
+	if err != nil {
+		return nil, false, err
+	}
+	w.stream = stream
+	return stream, true, nil
+}
+
+// Rebuild the message descriptor if the cached schema changed since it was
+// last built, reporting whether it did.
+func (w *storageWriteInserter) refreshDescriptor(ctx context.Context) (bool, error) {
+	w.schema.mu.Lock()
+	defer w.schema.mu.Unlock()
+
+	if err := w.schema.load(ctx, w.schemaManager); err != nil {
+		return false, fmt.Errorf("table metadata: %w", err)
+	}
+	if w.message != nil && w.etag == w.schema.etag {
+		return false, nil
+	}
+
+	message, descriptor, err := schemaDescriptor(w.schema.fields)
+	if err != nil {
+		return false, err
+	}
+	w.message, w.descriptor, w.etag = message, descriptor, w.schema.etag
+	return true, nil
+}
+
+// The protocol buffer message type for rows of a table with schema.
+func schemaDescriptor(schema bigquery.Schema) (protoreflect.MessageDescriptor, *descriptorpb.DescriptorProto, error) {
+	tableSchema, err := adapt.BQSchemaToStorageTableSchema(schema)
+	if err != nil {
+		return nil, nil, fmt.Errorf("convert schema: %w", err)
+	}
+	d, err := adapt.StorageSchemaToProto2Descriptor(tableSchema, "root")
+	if err != nil {
+		return nil, nil, fmt.Errorf("build row descriptor: %w", err)
+	}
+	message, ok := d.(protoreflect.MessageDescriptor)
+	if !ok {
+		return nil, nil, fmt.Errorf("row descriptor is a %T, not a message", d)
+	}
+	descriptor, err := adapt.NormalizeDescriptor(message)
+	if err != nil {
+		return nil, nil, fmt.Errorf("normalize row descriptor: %w", err)
+	}
+	return message, descriptor, nil
+}
+
+// Encode row as a message of type message. Fields missing from the message
+// are reported the way streaming inserts report them, so that they're
+// handled as a schema mismatch.
+func encodeRow(message protoreflect.MessageDescriptor, row map[string]bigquery.Value) ([]byte, error) {
+	m := dynamicpb.NewMessage(message)
+	if err := setFields(m, row); err != nil {
+		return nil, err
+	}
+	return proto.Marshal(m)
+}
+
+// Set the message's fields from row, including the fields of RECORD columns.
+func setFields(m protoreflect.Message, row map[string]bigquery.Value) error {
+	for key, value := range row {
+		field := m.Descriptor().Fields().ByName(protoreflect.Name(key))
+		if field == nil {
+			return fmt.Errorf("%w: %s.", errSchemaMismatch, key)
+		}
+		if value == nil {
+			// Unset fields are NULL.
+			continue
+		}
+		if field.IsList() {
+			elements, ok := repeatedElements(value)
+			if !ok {
+				return fmt.Errorf("field %s: %T value doesn't match repeated column", key, value)
+			}
+			list := m.Mutable(field).List()
+			for _, element := range elements {
+				v, err := protoValue(field, element)
+				if err != nil {
+					return fmt.Errorf("field %s: %w", key, err)
+				}
+				list.Append(v)
+			}
+			continue
+		}
+		if field.Kind() == protoreflect.MessageKind {
+			record, ok := value.(map[string]bigquery.Value)
+			if !ok {
+				return fmt.Errorf("field %s: %T value doesn't match record column", key, value)
+			}
+			if err := setFields(m.Mutable(field).Message(), record); err != nil {
+				return fmt.Errorf("record %s: %w", key, err)
+			}
+			continue
+		}
+		v, err := protoValue(field, value)
+		if err != nil {
+			return fmt.Errorf("field %s: %w", key, err)
+		}
+		m.Set(field, v)
+	}
+	return nil
+}
+
+// Convert a row value to the field's protocol buffer type. TIMESTAMP columns
+// are encoded as microseconds since the Unix epoch.
+func protoValue(field protoreflect.FieldDescriptor, value bigquery.Value) (protoreflect.Value, error) {
+	switch field.Kind() {
+	case protoreflect.Int64Kind:
+		switch v := value.(type) {
+		case int64:
+			return protoreflect.ValueOfInt64(v), nil
+		case pcommon.Timestamp:
+			return protoreflect.ValueOfInt64(int64(v) / 1000), nil
+		}
+	case protoreflect.DoubleKind:
+		if v, ok := value.(float64); ok {
+			return protoreflect.ValueOfFloat64(v), nil
+		}
+	case protoreflect.BoolKind:
+		if v, ok := value.(bool); ok {
+			return protoreflect.ValueOfBool(v), nil
+		}
+	case protoreflect.StringKind:
+		if v, ok := value.(string); ok {
+			return protoreflect.ValueOfString(v), nil
+		}
+	case protoreflect.BytesKind:
+		if v, ok := value.([]byte); ok {
+			return protoreflect.ValueOfBytes(v), nil
+		}
+	}
+	return protoreflect.Value{}, fmt.Errorf("%T value doesn't match column type %v", value, field.Kind())
+}
@@ -0,0 +1,239 @@
+package bigquery
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"cloud.google.com/go/bigquery/storage/managedwriter"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+func TestStorageWriteEncodesRows(t *testing.T) {
+	table := newFakeSchemaManager(bigquery.Schema{
+		{Name: "name", Type: bigquery.StringFieldType},
+		{Name: "ts", Type: bigquery.TimestampFieldType},
+		{Name: "count", Type: bigquery.IntegerFieldType},
+		{Name: "ratio", Type: bigquery.FloatFieldType},
+		{Name: "ok", Type: bigquery.BooleanFieldType},
+	})
+	inserter, stream := newTestStorageWriteInserter(table)
+	rows := []bigqueryrow{{
+		"name":  "span1",
+		"ts":    pcommon.Timestamp(1_700_000_000_123_456_789),
+		"count": int64(3),
+		"ratio": 0.5,
+		"ok":    true,
+	}}
+
+	require.NoError(t, inserter.Put(context.Background(), testValueSavers(rows)))
+
+	require.Len(t, stream.appends, 1)
+	require.Len(t, stream.appends[0], 1)
+	message := decodeRow(t, stream.descriptor, stream.appends[0][0])
+	assert.Equal(t, "span1", message["name"].String())
+	assert.Equal(t, int64(1_700_000_000_123_456), message["ts"].Int(), "Timestamps should be encoded as microseconds")
+	assert.Equal(t, int64(3), message["count"].Int())
+	assert.Equal(t, 0.5, message["ratio"].Float())
+	assert.True(t, message["ok"].Bool())
+}
+
+func TestStorageWriteEncodesRepeatedFields(t *testing.T) {
+	table := newFakeSchemaManager(bigquery.Schema{
+		{Name: "tags", Type: bigquery.StringFieldType, Repeated: true},
+	})
+	inserter, stream := newTestStorageWriteInserter(table)
+	rows := []bigqueryrow{{"tags": []string{"a", "b"}}}
+
+	require.NoError(t, inserter.Put(context.Background(), testValueSavers(rows)))
+
+	require.Len(t, stream.appends, 1)
+	tags := decodeRow(t, stream.descriptor, stream.appends[0][0])["tags"].List()
+	require.Equal(t, 2, tags.Len())
+	assert.Equal(t, "a", tags.Get(0).String())
+	assert.Equal(t, "b", tags.Get(1).String())
+}
+
+func TestStorageWriteEncodesRecordFields(t *testing.T) {
+	table := newFakeSchemaManager(bigquery.Schema{
+		{Name: "name", Type: bigquery.StringFieldType},
+		{Name: "resource", Type: bigquery.RecordFieldType, Schema: bigquery.Schema{
+			{Name: "service_name", Type: bigquery.StringFieldType},
+		}},
+	})
+	inserter, stream := newTestStorageWriteInserter(table)
+	rows := []bigqueryrow{{"name": "span1", "resource": map[string]bigquery.Value{"service_name": "checkout"}}}
+
+	require.NoError(t, inserter.Put(context.Background(), testValueSavers(rows)))
+
+	require.Len(t, stream.appends, 1)
+	resource := decodeRow(t, stream.descriptor, stream.appends[0][0])["resource"].Message()
+	serviceName := resource.Get(resource.Descriptor().Fields().ByName("service_name"))
+	assert.Equal(t, "checkout", serviceName.String())
+}
+
+func TestStorageWriteMissingRecordField(t *testing.T) {
+	table := newFakeSchemaManager(bigquery.Schema{
+		{Name: "resource", Type: bigquery.RecordFieldType, Schema: bigquery.Schema{
+			{Name: "service_name", Type: bigquery.StringFieldType},
+		}},
+	})
+	inserter, _ := newTestStorageWriteInserter(table)
+	rows := []bigqueryrow{{"resource": map[string]bigquery.Value{"host_cpus": int64(4)}}}
+
+	err := inserter.Put(context.Background(), testValueSavers(rows))
+
+	require.Error(t, err)
+	assert.True(t, isSchemaMismatch(err), "Missing nested fields should be handled as a schema mismatch")
+}
+
+func TestStorageWriteMissingField(t *testing.T) {
+	table := newFakeSchemaManager(bigquery.Schema{{Name: "name", Type: bigquery.StringFieldType}})
+	inserter, stream := newTestStorageWriteInserter(table)
+	rows := []bigqueryrow{{"name": "span1", "new_key": "value"}}
+
+	err := inserter.Put(context.Background(), testValueSavers(rows))
+
+	require.Error(t, err)
+	assert.True(t, isSchemaMismatch(err), "Missing fields should be handled as a schema mismatch")
+	assert.Empty(t, stream.appends)
+}
+
+func TestStorageWriteTypeMismatch(t *testing.T) {
+	table := newFakeSchemaManager(bigquery.Schema{{Name: "count", Type: bigquery.IntegerFieldType}})
+	inserter, _ := newTestStorageWriteInserter(table)
+	rows := []bigqueryrow{{"count": "three"}}
+
+	err := inserter.Put(context.Background(), testValueSavers(rows))
+
+	require.Error(t, err)
+	assert.False(t, isSchemaMismatch(err), "Type mismatches can't be fixed by a schema update")
+}
+
+func TestStorageWriteUpdatesDescriptorAfterSchemaChange(t *testing.T) {
+	table := newFakeSchemaManager(bigquery.Schema{{Name: "name", Type: bigquery.StringFieldType}})
+	inserter, stream := newTestStorageWriteInserter(table)
+	sender := newTestSender(t, withTableClients(nil, table))
+	inserter.schema = &sender.schema
+	rows := []bigqueryrow{{"name": "span1", "new_key": "value"}}
+
+	require.NoError(t, inserter.Put(context.Background(), testValueSavers([]bigqueryrow{{"name": "span0"}})))
+	require.NoError(t, sender.updateSchema(context.Background(), rows))
+	require.NoError(t, inserter.Put(context.Background(), testValueSavers(rows)))
+
+	assert.Equal(t, 1, stream.opens, "Stream should be reused after a schema change")
+	assert.Equal(t, []int{0, 1}, stream.optionCounts, "Appends after a schema change should update the stream descriptor")
+	message := decodeRow(t, inserter.descriptor, stream.appends[1][0])
+	assert.Equal(t, "value", message["new_key"].String())
+}
+
+func TestStorageWriteAppendsConcurrently(t *testing.T) {
+	table := newFakeSchemaManager(bigquery.Schema{{Name: "name", Type: bigquery.StringFieldType}})
+	stream := &concurrencyAppender{}
+	cfg := createTestConfig()
+	cfg.MaxRowsPerRequest = 1
+	cfg.MaxConcurrentInserts = 4
+	sender := newTestSender(t, withConfig(cfg), withTableClients(nil, table))
+	sender.inserter = &storageWriteInserter{
+		schema:        &sender.schema,
+		schemaManager: table,
+		openStream: func(ctx context.Context, descriptor *descriptorpb.DescriptorProto) (rowAppender, error) {
+			return stream, nil
+		},
+	}
+	rows := make([]bigqueryrow, 8)
+	for i := range rows {
+		rows[i] = bigqueryrow{"name": fmt.Sprintf("span%d", i)}
+	}
+
+	require.NoError(t, sender.sendRows(context.Background(), rows))
+
+	assert.Equal(t, int32(8), stream.appends.Load(), "Every chunk should be appended")
+	assert.LessOrEqual(t, stream.maxInFlight.Load(), int32(4), "At most 4 appends should be in flight")
+	assert.Greater(t, stream.maxInFlight.Load(), int32(1), "Chunks should be appended concurrently")
+}
+
+// Helper function to create a Storage Write inserter that appends to a fake
+// stream
+func newTestStorageWriteInserter(table schemaManager) (*storageWriteInserter, *fakeAppender) {
+	stream := &fakeAppender{}
+	inserter := &storageWriteInserter{
+		schema:        &schemaCache{},
+		schemaManager: table,
+		openStream: func(ctx context.Context, descriptor *descriptorpb.DescriptorProto) (rowAppender, error) {
+			stream.opens++
+			stream.descriptor = descriptor
+			return stream, nil
+		},
+	}
+	return inserter, stream
+}
+
+// Helper function to prepare rows for an inserter
+func testValueSavers(rows []bigqueryrow) []bigquery.ValueSaver {
+	return (&bigquerySender{Config: createTestConfig()}).valueSavers(rows)
+}
+
+// Helper function to decode an appended row into values by field name
+func decodeRow(t *testing.T, descriptor *descriptorpb.DescriptorProto, data []byte) map[string]protoreflect.Value {
+	t.Helper()
+	file, err := protodesc.NewFile(&descriptorpb.FileDescriptorProto{
+		Name:        proto.String("row.proto"),
+		MessageType: []*descriptorpb.DescriptorProto{descriptor},
+	}, nil)
+	require.NoError(t, err)
+	message := dynamicpb.NewMessage(file.Messages().Get(0))
+	require.NoError(t, proto.Unmarshal(data, message))
+
+	values := map[string]protoreflect.Value{}
+	message.Range(func(field protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		values[string(field.Name())] = v
+		return true
+	})
+	return values
+}
+
+// Fake stream that records appended rows
+type fakeAppender struct {
+	opens        int
+	descriptor   *descriptorpb.DescriptorProto
+	appends      [][][]byte
+	optionCounts []int
+}
+
+func (f *fakeAppender) appendRows(ctx context.Context, data [][]byte, opts ...managedwriter.AppendOption) error {
+	f.appends = append(f.appends, data)
+	f.optionCounts = append(f.optionCounts, len(opts))
+	return nil
+}
+
+// Fake stream that tracks the most concurrent appends
+type concurrencyAppender struct {
+	inFlight    atomic.Int32
+	maxInFlight atomic.Int32
+	appends     atomic.Int32
+}
+
+func (c *concurrencyAppender) appendRows(ctx context.Context, data [][]byte, opts ...managedwriter.AppendOption) error {
+	c.appends.Add(1)
+	n := c.inFlight.Add(1)
+	defer c.inFlight.Add(-1)
+	for {
+		highest := c.maxInFlight.Load()
+		if n <= highest || c.maxInFlight.CompareAndSwap(highest, n) {
+			break
+		}
+	}
+	time.Sleep(20 * time.Millisecond)
+	return nil
+}
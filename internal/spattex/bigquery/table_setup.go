@@ -0,0 +1,174 @@
+package bigquery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.uber.org/zap"
+	"google.golang.org/api/googleapi"
+)
+
+// Dataset operations for creating the target dataset.
+// Satisfied by *bigquery.Dataset.
+type datasetManager interface {
+	Create(ctx context.Context, md *bigquery.DatasetMetadata) error
+	Metadata(ctx context.Context) (*bigquery.DatasetMetadata, error)
+}
+
+// Create the dataset and table if they don't exist yet. Another exporter
+// (e.g. for a different signal) may create them concurrently, so creation
+// conflicts are not errors.
+func (s *bigquerySender) createIfMissing(ctx context.Context) error {
+	if _, err := s.datasetManager.Metadata(ctx); err != nil {
+		if !isNotFound(err) {
+			return fmt.Errorf("dataset metadata for %s: %w", s.Dataset, err)
+		}
+		s.logger.Info("Creating dataset", zap.String("dataset", s.Dataset))
+		err := s.datasetManager.Create(ctx, &bigquery.DatasetMetadata{Location: s.Location, Labels: s.Labels})
+		if err != nil && !isAlreadyExists(err) {
+			return fmt.Errorf("create dataset %s: %w", s.Dataset, err)
+		}
+	}
+
+	if _, err := s.schemaManager.Metadata(ctx); err != nil {
+		if !isNotFound(err) {
+			return fmt.Errorf("table metadata for %s.%s: %w", s.Dataset, s.tableID, err)
+		}
+		if s.AutodetectSchemaFromFirstBatch {
+			s.logger.Info("Deferring table creation until the first batch", zap.String("dataset", s.Dataset), zap.String("table", s.tableID))
+			s.schema.mu.Lock()
+			s.schema.pendingCreate = true
+			s.schema.mu.Unlock()
+			return nil
+		}
+		s.logger.Info("Creating table", zap.String("dataset", s.Dataset), zap.String("table", s.tableID))
+		err := s.schemaManager.Create(ctx, s.newTableMetadata())
+		if err != nil && !isAlreadyExists(err) {
+			return fmt.Errorf("create table %s.%s: %w", s.Dataset, s.tableID, err)
+		}
+	}
+	return nil
+}
+
+// Create the table whose creation createIfMissing deferred, with
+// AutodetectSchemaFromFirstBatch, with columns for the fields of rows, the
+// first batch, typed as a schema update would type them. Later batches then
+// only need schema updates for fields the first didn't have. Rows with values
+// that have no BigQuery type don't contribute columns.
+func (s *bigquerySender) createPendingTable(ctx context.Context, rows []bigqueryrow) error {
+	s.schema.mu.Lock()
+	defer s.schema.mu.Unlock()
+	if !s.schema.pendingCreate {
+		return nil
+	}
+
+	meta := s.newTableMetadata()
+	mappable, _, _ := splitUnmappableRows(rows)
+	schema, _, err := mergeSchema(s.logger, meta.Schema, mappable)
+	if err != nil {
+		return err
+	}
+	meta.Schema = schema
+	s.logger.Info("Creating table",
+		zap.String("dataset", s.Dataset),
+		zap.String("table", s.tableID),
+		zap.Int("columns", len(schema)))
+	if err := s.schemaManager.Create(ctx, meta); err != nil && !isAlreadyExists(err) {
+		return fmt.Errorf("create table %s.%s: %w", s.Dataset, s.tableID, err)
+	}
+	s.schema.pendingCreate = false
+
+	s.schema.invalidate()
+	if err := s.schema.load(ctx, s.schemaManager); err != nil {
+		return fmt.Errorf("table metadata for %s.%s: %w", s.Dataset, s.tableID, err)
+	}
+	return nil
+}
+
+// The SpanNameColumn value of the row the startup probe inserts, so queries can
+// filter it out.
+const startupProbeName = "otelex.startup_probe"
+
+// Insert a single canary row into the table, with RunStartupProbe, so that
+// missing write permission or connectivity fails the collector start rather
+// than the first export. Streamed rows can't be deleted until they leave the
+// streaming buffer, so the row is left in the table: it has the partition
+// field set to the current time and, if the table has a SpanNameColumn, the
+// name startupProbeName.
+func (s *bigquerySender) probe(ctx context.Context) error {
+	row := bigqueryrow{s.partitionField(): pcommon.NewTimestampFromTime(time.Now())}
+	s.schema.mu.Lock()
+	if _, ok := s.schema.types[s.spanNameColumn()]; ok {
+		row[s.spanNameColumn()] = startupProbeName
+	}
+	s.schema.mu.Unlock()
+
+	if err := tagErrorKind(s.inserter.Put(ctx, []bigquery.ValueSaver{row})); err != nil {
+		return fmt.Errorf("startup probe insert into %s.%s: %w", s.Dataset, s.tableID, err)
+	}
+	s.logger.Info("Startup probe row inserted", zap.String("dataset", s.Dataset), zap.String("table", s.tableID))
+	return nil
+}
+
+// Metadata for the sender's table, if it's created.
+func (s *bigquerySender) newTableMetadata() *bigquery.TableMetadata {
+	if s.ResourceTable != "" && s.tableID == s.ResourceTable {
+		return newResourceTableMetadata(s.Config)
+	}
+	return newTableMetadata(s.Config)
+}
+
+// A minimal schema for a new table: the columns every span row has. Further
+// columns are added as they're seen if the schema is flexible.
+// With RangePartitioning, the table is partitioned on its integer field
+// instead of by time.
+func newTableMetadata(cfg *Config) *bigquery.TableMetadata {
+	meta := &bigquery.TableMetadata{
+		Schema: bigquery.Schema{
+			{Name: cfg.spanNameColumn(), Type: bigquery.StringFieldType},
+			{Name: cfg.partitionField(), Type: bigquery.TimestampFieldType},
+			{Name: "trace_id", Type: bigquery.StringFieldType},
+			{Name: "span_id", Type: bigquery.StringFieldType},
+		},
+		TimePartitioning: newTimePartitioning(cfg),
+		// TimePartitioning.RequirePartitionFilter is deprecated.
+		RequirePartitionFilter: cfg.RequirePartitionFilter,
+		Labels:                 cfg.Labels,
+	}
+	if rp := cfg.RangePartitioning; rp.Field != "" {
+		meta.Schema = append(meta.Schema, &bigquery.FieldSchema{Name: rp.Field, Type: bigquery.IntegerFieldType})
+		meta.TimePartitioning = nil
+		meta.RangePartitioning = &bigquery.RangePartitioning{
+			Field: rp.Field,
+			Range: &bigquery.RangePartitioningRange{
+				Start:    rp.Start,
+				End:      rp.End,
+				Interval: rp.Interval,
+			},
+		}
+	}
+	return meta
+}
+
+func newTimePartitioning(cfg *Config) *bigquery.TimePartitioning {
+	return &bigquery.TimePartitioning{
+		Type:       cfg.partitionType(),
+		Field:      cfg.partitionField(),
+		Expiration: cfg.PartitionExpiration,
+	}
+}
+
+func isNotFound(err error) bool {
+	var apiErr *googleapi.Error
+	return errors.As(err, &apiErr) && apiErr.Code == http.StatusNotFound
+}
+
+func isAlreadyExists(err error) bool {
+	var apiErr *googleapi.Error
+	return errors.As(err, &apiErr) && apiErr.Code == http.StatusConflict
+}
@@ -0,0 +1,253 @@
+package bigquery
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/googleapi"
+)
+
+func TestStartCreatesMissingTable(t *testing.T) {
+	dataset := &fakeDatasetManager{}
+	table := newFakeSchemaManager(nil)
+	table.metadataErr = notFoundError()
+	cfg := createTestConfig()
+	cfg.CreateIfMissing = true
+	sender := newTestSender(t, withConfig(cfg), withTableClients(dataset, table))
+
+	require.NoError(t, sender.start(context.Background(), nil))
+
+	assert.Equal(t, 0, dataset.createCalls, "Existing dataset should not be created")
+	assert.Equal(t, 1, table.createCalls, "Missing table should be created")
+	assert.Equal(t, bigquery.TimestampFieldType, fieldType(table.meta.Schema, "ts"))
+	assert.Equal(t, bigquery.StringFieldType, fieldType(table.meta.Schema, "trace_id"))
+	assert.Equal(t, bigquery.StringFieldType, fieldType(table.meta.Schema, "span_id"))
+	assert.Equal(t, &bigquery.TimePartitioning{Type: bigquery.DayPartitioningType, Field: "ts"}, table.meta.TimePartitioning)
+	assert.True(t, sender.schema.loaded, "Schema cache should be warm after start")
+}
+
+func TestStartCreatesTableWithPartitioning(t *testing.T) {
+	table := newFakeSchemaManager(nil)
+	table.metadataErr = notFoundError()
+	cfg := createTestConfig()
+	cfg.CreateIfMissing = true
+	cfg.PartitionField = "start_time"
+	cfg.PartitionType = "HOUR"
+	sender := newTestSender(t, withConfig(cfg), withTableClients(&fakeDatasetManager{}, table))
+
+	require.NoError(t, sender.start(context.Background(), nil))
+
+	assert.Equal(t, bigquery.TimestampFieldType, fieldType(table.meta.Schema, "start_time"))
+	assert.Equal(t, &bigquery.TimePartitioning{Type: bigquery.HourPartitioningType, Field: "start_time"}, table.meta.TimePartitioning)
+}
+
+func TestStartCreatesTableWithRangePartitioning(t *testing.T) {
+	table := newFakeSchemaManager(nil)
+	table.metadataErr = notFoundError()
+	cfg := createTestConfig()
+	cfg.CreateIfMissing = true
+	cfg.PartitionType = ""
+	cfg.RangePartitioning = RangePartitioningConfig{Field: "tenant_id", Start: 0, End: 1000, Interval: 10}
+	sender := newTestSender(t, withConfig(cfg), withTableClients(&fakeDatasetManager{}, table))
+
+	require.NoError(t, sender.start(context.Background(), nil))
+
+	assert.Equal(t, bigquery.IntegerFieldType, fieldType(table.meta.Schema, "tenant_id"))
+	assert.Nil(t, table.meta.TimePartitioning)
+	assert.Equal(t, &bigquery.RangePartitioning{
+		Field: "tenant_id",
+		Range: &bigquery.RangePartitioningRange{Start: 0, End: 1000, Interval: 10},
+	}, table.meta.RangePartitioning)
+}
+
+func TestStartCreatesTableWithPartitionExpiration(t *testing.T) {
+	for _, expiration := range []time.Duration{0, 90 * 24 * time.Hour} {
+		table := newFakeSchemaManager(nil)
+		table.metadataErr = notFoundError()
+		cfg := createTestConfig()
+		cfg.CreateIfMissing = true
+		cfg.PartitionExpiration = expiration
+		sender := newTestSender(t, withConfig(cfg), withTableClients(&fakeDatasetManager{}, table))
+
+		require.NoError(t, sender.start(context.Background(), nil))
+
+		assert.Equal(t, expiration, table.meta.TimePartitioning.Expiration, "Partition expiration should match the config")
+	}
+}
+
+func TestStartCreatesTableRequiringPartitionFilter(t *testing.T) {
+	table := newFakeSchemaManager(nil)
+	table.metadataErr = notFoundError()
+	cfg := createTestConfig()
+	cfg.CreateIfMissing = true
+	cfg.RequirePartitionFilter = true
+	sender := newTestSender(t, withConfig(cfg), withTableClients(&fakeDatasetManager{}, table))
+
+	require.NoError(t, sender.start(context.Background(), nil))
+
+	assert.True(t, table.meta.RequirePartitionFilter, "Created table should require a partition filter")
+}
+
+func TestStartCreatesMissingDataset(t *testing.T) {
+	dataset := &fakeDatasetManager{metadataErr: notFoundError()}
+	table := newFakeSchemaManager(nil)
+	table.metadataErr = notFoundError()
+	cfg := createTestConfig()
+	cfg.CreateIfMissing = true
+	sender := newTestSender(t, withConfig(cfg), withTableClients(dataset, table))
+
+	require.NoError(t, sender.start(context.Background(), nil))
+
+	assert.Equal(t, 1, dataset.createCalls, "Missing dataset should be created")
+	assert.Equal(t, 1, table.createCalls, "Missing table should be created")
+}
+
+func TestStartCreatesWithLabels(t *testing.T) {
+	dataset := &fakeDatasetManager{metadataErr: notFoundError()}
+	table := newFakeSchemaManager(nil)
+	table.metadataErr = notFoundError()
+	cfg := createTestConfig()
+	cfg.CreateIfMissing = true
+	cfg.Labels = map[string]string{"team": "observability"}
+	sender := newTestSender(t, withConfig(cfg), withTableClients(dataset, table))
+
+	require.NoError(t, sender.start(context.Background(), nil))
+
+	assert.Equal(t, cfg.Labels, dataset.meta.Labels, "Created dataset should be labeled")
+	assert.Equal(t, cfg.Labels, table.meta.Labels, "Created table should be labeled")
+}
+
+func TestStartSkipsExistingTable(t *testing.T) {
+	dataset := &fakeDatasetManager{}
+	table := newFakeSchemaManager(bigquery.Schema{{Name: "name", Type: bigquery.StringFieldType}})
+	cfg := createTestConfig()
+	cfg.CreateIfMissing = true
+	sender := newTestSender(t, withConfig(cfg), withTableClients(dataset, table))
+
+	require.NoError(t, sender.start(context.Background(), nil))
+
+	assert.Equal(t, 0, dataset.createCalls)
+	assert.Equal(t, 0, table.createCalls, "Existing table should not be created")
+}
+
+func TestStartWithoutCreateIfMissing(t *testing.T) {
+	dataset := &fakeDatasetManager{metadataErr: notFoundError()}
+	table := newFakeSchemaManager(nil)
+	table.metadataErr = notFoundError()
+	sender := newTestSender(t, withTableClients(dataset, table))
+
+	require.Error(t, sender.start(context.Background(), nil), "Missing table should fail start")
+
+	assert.Equal(t, 0, dataset.createCalls)
+	assert.Equal(t, 0, table.createCalls, "Table should only be created when configured")
+}
+
+func TestStartDefersTableCreationToFirstBatch(t *testing.T) {
+	table := newFakeSchemaManager(nil)
+	table.metadataErr = notFoundError()
+	cfg := createTestConfig()
+	cfg.CreateIfMissing = true
+	cfg.AutodetectSchemaFromFirstBatch = true
+	inserter := &fakeInserter{}
+	sender := newTestSender(t, withConfig(cfg), withTableClients(&fakeDatasetManager{}, table))
+	sender.inserter = inserter
+
+	require.NoError(t, sender.start(context.Background(), nil))
+	assert.Equal(t, 0, table.createCalls, "Table creation should wait for the first batch")
+
+	rows := []bigqueryrow{
+		{"name": "span1", "http_status_code": int64(200), "retry": true},
+		{"name": "span2", "ratio": 0.5, "tags": []string{"a", "b"}},
+	}
+	require.NoError(t, sender.sendRows(context.Background(), rows))
+
+	assert.Equal(t, 1, table.createCalls)
+	assert.Equal(t, 0, table.updateCalls, "The created schema should fit the first batch")
+	assert.Equal(t, bigquery.TimestampFieldType, fieldType(table.meta.Schema, "ts"))
+	assert.Equal(t, bigquery.StringFieldType, fieldType(table.meta.Schema, "trace_id"))
+	assert.Equal(t, bigquery.IntegerFieldType, fieldType(table.meta.Schema, "http_status_code"))
+	assert.Equal(t, bigquery.BooleanFieldType, fieldType(table.meta.Schema, "retry"))
+	assert.Equal(t, bigquery.FloatFieldType, fieldType(table.meta.Schema, "ratio"))
+	assert.Equal(t, bigquery.StringFieldType, fieldType(table.meta.Schema, "tags"))
+	assert.True(t, sender.schema.loaded, "Schema cache should be warm after creation")
+	assert.Equal(t, []int{2}, inserter.putSizes)
+
+	require.NoError(t, sender.sendRows(context.Background(), rows))
+	assert.Equal(t, 1, table.createCalls, "The table should only be created once")
+}
+
+func TestStartRunsProbe(t *testing.T) {
+	table := newFakeSchemaManager(bigquery.Schema{
+		{Name: "name", Type: bigquery.StringFieldType},
+		{Name: "ts", Type: bigquery.TimestampFieldType},
+	})
+	cfg := createTestConfig()
+	cfg.RunStartupProbe = true
+	inserter := &fakeInserter{}
+	sender := newTestSender(t, withConfig(cfg), withTableClients(&fakeDatasetManager{}, table))
+	sender.inserter = inserter
+
+	require.NoError(t, sender.start(context.Background(), nil))
+
+	require.Equal(t, []int{1}, inserter.putSizes, "A single probe row should be inserted")
+	row := savedRow(t, inserter.rows[0])
+	assert.Equal(t, startupProbeName, row["name"])
+	assert.Contains(t, row, "ts")
+}
+
+func TestStartProbeSurfacesPermissionErrors(t *testing.T) {
+	table := newFakeSchemaManager(bigquery.Schema{{Name: "ts", Type: bigquery.TimestampFieldType}})
+	cfg := createTestConfig()
+	cfg.RunStartupProbe = true
+	denied := &googleapi.Error{Code: http.StatusForbidden, Message: "Access Denied: Table msyvr:otelex.spattex_test: Permission bigquery.tables.updateData denied"}
+	inserter := &fakeInserter{errs: []error{denied}}
+	sender := newTestSender(t, withConfig(cfg), withTableClients(&fakeDatasetManager{}, table))
+	sender.inserter = inserter
+
+	err := sender.start(context.Background(), nil)
+
+	require.Error(t, err, "A rejected probe should fail start")
+	assert.ErrorIs(t, err, errAccessDenied)
+	assert.Contains(t, err.Error(), "startup probe")
+	assert.NotContains(t, savedRow(t, inserter.rows[0]), "name", "Columns missing from the table should be left out")
+}
+
+func TestStartWithoutProbe(t *testing.T) {
+	inserter := &fakeInserter{}
+	sender := newTestSender(t, withTableClients(&fakeDatasetManager{}, newFakeSchemaManager(nil)))
+	sender.inserter = inserter
+
+	require.NoError(t, sender.start(context.Background(), nil))
+
+	assert.Empty(t, inserter.putSizes, "The probe should be off by default")
+}
+
+func notFoundError() error {
+	return &googleapi.Error{Code: http.StatusNotFound, Message: "Not found"}
+}
+
+// Fake dataset that counts Create calls
+type fakeDatasetManager struct {
+	meta        *bigquery.DatasetMetadata
+	metadataErr error
+	createCalls int
+}
+
+func (f *fakeDatasetManager) Create(ctx context.Context, md *bigquery.DatasetMetadata) error {
+	f.createCalls++
+	f.meta = md
+	f.metadataErr = nil
+	return nil
+}
+
+func (f *fakeDatasetManager) Metadata(ctx context.Context) (*bigquery.DatasetMetadata, error) {
+	if f.metadataErr != nil {
+		return nil, f.metadataErr
+	}
+	return &bigquery.DatasetMetadata{}, nil
+}
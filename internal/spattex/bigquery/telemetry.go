@@ -0,0 +1,148 @@
+package bigquery
+
+import (
+	"context"
+
+	"go.opentelemetry.io/collector/component"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+const scopeName = "github.com/msyvr/otelex/internal/spattex/bigquery"
+
+// Histogram buckets for rows per batch and per request, around the 500 rows
+// per request BigQuery recommends and up to its 50,000 row limit.
+var rowBuckets = []float64{1, 10, 50, 100, 250, 500, 1000, 2500, 5000, 10000, 50000}
+
+// Histogram buckets for bytes per request, up to the 10 MB request size
+// limit requests are kept under (see maxInsertRequestBytes).
+var byteBuckets = []float64{1 << 10, 10 << 10, 100 << 10, 500 << 10, 1 << 20, 2 << 20, 5 << 20, maxInsertRequestBytes, 10 << 20}
+
+// The exporter's own metrics, recorded with the collector's meter provider.
+// Each is attributed to the destination table. A nil *exporterTelemetry
+// records nothing.
+type exporterTelemetry struct {
+	rowsSent      metric.Int64Counter
+	rowsFailed    metric.Int64Counter
+	schemaUpdates metric.Int64Counter
+	batchSize     metric.Int64Histogram
+	requestBytes  metric.Int64Histogram
+	exportRows    metric.Int64Histogram
+
+	attributesDropped metric.Int64Counter
+}
+
+func newExporterTelemetry(settings component.TelemetrySettings) (*exporterTelemetry, error) {
+	meter := settings.MeterProvider.Meter(scopeName)
+	t := &exporterTelemetry{}
+	var err error
+
+	if t.rowsSent, err = meter.Int64Counter(
+		"otelcol_exporter_bigquery_rows_sent",
+		metric.WithDescription("Rows successfully inserted into BigQuery."),
+		metric.WithUnit("{row}"),
+	); err != nil {
+		return nil, err
+	}
+	if t.rowsFailed, err = meter.Int64Counter(
+		"otelcol_exporter_bigquery_rows_failed",
+		metric.WithDescription("Rows that failed to be inserted into BigQuery. Failed rows may be retried."),
+		metric.WithUnit("{row}"),
+	); err != nil {
+		return nil, err
+	}
+	if t.schemaUpdates, err = meter.Int64Counter(
+		"otelcol_exporter_bigquery_schema_updates",
+		metric.WithDescription("Table schema updates made to add new fields."),
+		metric.WithUnit("{update}"),
+	); err != nil {
+		return nil, err
+	}
+	if t.batchSize, err = meter.Int64Histogram(
+		"otelcol_exporter_bigquery_batch_size",
+		metric.WithDescription("Rows per insert request."),
+		metric.WithUnit("{row}"),
+		metric.WithExplicitBucketBoundaries(rowBuckets...),
+	); err != nil {
+		return nil, err
+	}
+	if t.requestBytes, err = meter.Int64Histogram(
+		"otelcol_exporter_bigquery_request_size",
+		metric.WithDescription("Estimated bytes per insert request."),
+		metric.WithUnit("By"),
+		metric.WithExplicitBucketBoundaries(byteBuckets...),
+	); err != nil {
+		return nil, err
+	}
+	if t.exportRows, err = meter.Int64Histogram(
+		"otelcol_exporter_bigquery_export_size",
+		metric.WithDescription("Rows per batch received from the pipeline, before it's split into insert requests."),
+		metric.WithUnit("{row}"),
+		metric.WithExplicitBucketBoundaries(rowBuckets...),
+	); err != nil {
+		return nil, err
+	}
+	if t.attributesDropped, err = meter.Int64Counter(
+		"otelcol_exporter_bigquery_attributes_dropped",
+		metric.WithDescription("Attribute values dropped rather than exported, by reason."),
+		metric.WithUnit("{value}"),
+	); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func (t *exporterTelemetry) recordRowsSent(ctx context.Context, tableID string, rows int) {
+	if t == nil {
+		return
+	}
+	t.rowsSent.Add(ctx, int64(rows), tableAttribute(tableID))
+}
+
+func (t *exporterTelemetry) recordRowsFailed(ctx context.Context, tableID string, rows int) {
+	if t == nil {
+		return
+	}
+	t.rowsFailed.Add(ctx, int64(rows), tableAttribute(tableID))
+}
+
+func (t *exporterTelemetry) recordSchemaUpdate(ctx context.Context, tableID string) {
+	if t == nil {
+		return
+	}
+	t.schemaUpdates.Add(ctx, 1, tableAttribute(tableID))
+}
+
+func (t *exporterTelemetry) recordBatchSize(ctx context.Context, tableID string, rows int) {
+	if t == nil {
+		return
+	}
+	t.batchSize.Record(ctx, int64(rows), tableAttribute(tableID))
+}
+
+func (t *exporterTelemetry) recordRequestBytes(ctx context.Context, tableID string, bytes int) {
+	if t == nil {
+		return
+	}
+	t.requestBytes.Record(ctx, int64(bytes), tableAttribute(tableID))
+}
+
+func (t *exporterTelemetry) recordExportRows(ctx context.Context, tableID string, rows int) {
+	if t == nil {
+		return
+	}
+	t.exportRows.Record(ctx, int64(rows), tableAttribute(tableID))
+}
+
+func (t *exporterTelemetry) recordAttributesDropped(ctx context.Context, tableID, reason string, values int) {
+	if t == nil {
+		return
+	}
+	t.attributesDropped.Add(ctx, int64(values), metric.WithAttributes(
+		attribute.String("table", tableID),
+		attribute.String("reason", reason)))
+}
+
+func tableAttribute(tableID string) metric.MeasurementOption {
+	return metric.WithAttributes(attribute.String("table", tableID))
+}
@@ -0,0 +1,161 @@
+package bigquery
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/component/componenttest"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestTelemetryRowsSent(t *testing.T) {
+	sender, reader := newTelemetryTestSender(t, &fakeInserter{})
+	rows := []bigqueryrow{{"name": "span1"}, {"name": "span2"}}
+
+	require.NoError(t, sender.sendRows(context.Background(), rows))
+
+	metrics := collectMetrics(t, reader)
+	assert.Equal(t, int64(2), sumValue(t, metrics, "otelcol_exporter_bigquery_rows_sent"))
+	assert.NotContains(t, metrics, "otelcol_exporter_bigquery_rows_failed")
+}
+
+func TestTelemetryRowsFailed(t *testing.T) {
+	sender, reader := newTelemetryTestSender(t, &fakeInserter{errs: []error{errors.New("insert failed")}})
+	rows := []bigqueryrow{{"name": "span1"}}
+
+	require.Error(t, sender.sendRows(context.Background(), rows))
+
+	metrics := collectMetrics(t, reader)
+	assert.Equal(t, int64(1), sumValue(t, metrics, "otelcol_exporter_bigquery_rows_failed"))
+	assert.NotContains(t, metrics, "otelcol_exporter_bigquery_rows_sent")
+}
+
+func TestTelemetrySchemaUpdates(t *testing.T) {
+	sender, reader := newTelemetryTestSender(t, &fakeInserter{})
+	sender.schemaManager = newFakeSchemaManager(bigquery.Schema{{Name: "name", Type: bigquery.StringFieldType}})
+	rows := []bigqueryrow{{"name": "span1", "new_key": "value"}}
+
+	require.NoError(t, sender.updateSchema(context.Background(), rows))
+
+	assert.Equal(t, int64(1), sumValue(t, collectMetrics(t, reader), "otelcol_exporter_bigquery_schema_updates"))
+}
+
+func TestTelemetryAttributesDroppedUnsupportedType(t *testing.T) {
+	sender, reader := newTelemetryTestSender(t, &fakeInserter{errs: []error{noSuchFieldError("map_key")}})
+	sender.SchemaFlexible = true
+	core, logs := observer.New(zap.DebugLevel)
+	sender.logger = zap.New(core)
+	rows := []bigqueryrow{{"name": "span1", "map_key": pcommon.NewMap()}}
+
+	require.NoError(t, sender.sendRows(context.Background(), rows))
+
+	metrics := collectMetrics(t, reader)
+	assert.Equal(t, int64(1), sumValue(t, metrics, "otelcol_exporter_bigquery_attributes_dropped"))
+	assert.Equal(t, attribute.NewSet(attribute.String("table", sender.tableID), attribute.String("reason", dropReasonUnsupportedType)),
+		metrics["otelcol_exporter_bigquery_attributes_dropped"].Data.(metricdata.Sum[int64]).DataPoints[0].Attributes)
+	summary := logs.FilterMessage("Dropped attribute values that can't be exported").All()
+	require.Len(t, summary, 1)
+	assert.Equal(t, int64(1), summary[0].ContextMap()[dropReasonUnsupportedType])
+}
+
+func TestTelemetryAttributesDroppedWhileBuildingRows(t *testing.T) {
+	sender, reader := newTelemetryTestSender(t, &fakeInserter{})
+	sender.logger = zap.NewNop()
+	sender.rows = newRowBuilder(sender.Config, zap.NewNop())
+	traces := createTestTraces()
+	spans := traces.ResourceSpans().At(0).ScopeSpans().At(0).Spans()
+	spans.At(0).Attributes().PutEmpty("empty_key")
+	spans.At(1).Attributes().PutEmpty("empty_key")
+	mixed := spans.At(1).Attributes().PutEmptySlice("nan_key")
+	mixed.AppendEmpty().SetStr("a")
+	mixed.AppendEmpty().SetDouble(math.NaN())
+
+	require.NoError(t, sender.consumeTraces(context.Background(), traces))
+
+	sum := collectMetrics(t, reader)["otelcol_exporter_bigquery_attributes_dropped"].Data.(metricdata.Sum[int64])
+	byReason := map[string]int64{}
+	for _, dp := range sum.DataPoints {
+		reason, _ := dp.Attributes.Value("reason")
+		byReason[reason.AsString()] = dp.Value
+	}
+	assert.Equal(t, map[string]int64{dropReasonEmptyValue: 2, dropReasonUnencodable: 1}, byReason)
+}
+
+func TestTelemetryNoAttributesDropped(t *testing.T) {
+	sender, reader := newTelemetryTestSender(t, &fakeInserter{})
+
+	require.NoError(t, sender.sendRows(context.Background(), []bigqueryrow{{"name": "span1"}}))
+
+	assert.NotContains(t, collectMetrics(t, reader), "otelcol_exporter_bigquery_attributes_dropped")
+}
+
+func TestTelemetryExportSize(t *testing.T) {
+	sender, reader := newTelemetryTestSender(t, &fakeInserter{})
+	sender.MaxRowsPerRequest = 1
+	sender.logger = zap.NewNop()
+	sender.rows = newRowBuilder(sender.Config, zap.NewNop())
+	traces := createTestTraces()
+
+	require.NoError(t, sender.consumeTraces(context.Background(), traces))
+	require.NoError(t, sender.consumeTraces(context.Background(), traces))
+
+	metrics := collectMetrics(t, reader)
+	exports := metrics["otelcol_exporter_bigquery_export_size"].Data.(metricdata.Histogram[int64]).DataPoints
+	require.Len(t, exports, 1)
+	assert.Equal(t, uint64(2), exports[0].Count, "Each batch should be observed once")
+	assert.Equal(t, int64(2*traces.SpanCount()), exports[0].Sum)
+	assert.Equal(t, rowBuckets, exports[0].Bounds)
+
+	requests := metrics["otelcol_exporter_bigquery_request_size"].Data.(metricdata.Histogram[int64]).DataPoints
+	require.Len(t, requests, 1)
+	assert.Equal(t, uint64(2*traces.SpanCount()), requests[0].Count, "Each insert request should be observed once")
+	assert.Equal(t, byteBuckets, requests[0].Bounds)
+}
+
+// Helper function to create a sender that records telemetry to a manual reader
+func newTelemetryTestSender(t *testing.T, inserter rowInserter) (*bigquerySender, *sdkmetric.ManualReader) {
+	reader := sdkmetric.NewManualReader()
+	settings := componenttest.NewNopTelemetrySettings()
+	settings.MeterProvider = sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	telemetry, err := newExporterTelemetry(settings)
+	require.NoError(t, err)
+
+	return newTestSender(t, withInserter(inserter), withTelemetry(telemetry)), reader
+}
+
+// Helper function to collect metrics by name
+func collectMetrics(t *testing.T, reader *sdkmetric.ManualReader) map[string]metricdata.Metrics {
+	var rm metricdata.ResourceMetrics
+	require.NoError(t, reader.Collect(context.Background(), &rm))
+
+	metrics := map[string]metricdata.Metrics{}
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			metrics[m.Name] = m
+		}
+	}
+	return metrics
+}
+
+// Helper function to total a counter across attributes
+func sumValue(t *testing.T, metrics map[string]metricdata.Metrics, name string) int64 {
+	require.Contains(t, metrics, name)
+	sum, ok := metrics[name].Data.(metricdata.Sum[int64])
+	require.True(t, ok, "%s should be an int64 sum", name)
+
+	var total int64
+	for _, dp := range sum.DataPoints {
+		total += dp.Value
+	}
+	return total
+}
@@ -0,0 +1,63 @@
+package bigquery
+
+import (
+	"context"
+	"errors"
+
+	"cloud.google.com/go/bigquery"
+	"go.uber.org/zap"
+)
+
+// Mutates rows before they're inserted, e.g. to redact, rename or enrich
+// columns, without forking the exporter. Rows map column names to values of
+// the types the exporter builds them with: string, int64, float64, bool,
+// []byte, pcommon.Timestamp or nil.
+//
+// Transform may modify row in place and return it. Returning ErrSkipRow
+// drops the row; rows that fail with any other error are dead-lettered.
+// Transform is called concurrently when the sending queue has more than one
+// consumer.
+type RowTransformer interface {
+	Transform(ctx context.Context, row map[string]bigquery.Value) (map[string]bigquery.Value, error)
+}
+
+// Returned by a RowTransformer to drop a row.
+var ErrSkipRow = errors.New("skip row")
+
+// Apply the RowTransformer to each row, returning the rows to insert.
+func (sender *bigquerySender) transformRows(ctx context.Context, rows []bigqueryrow) []bigqueryrow {
+	if sender.RowTransformer == nil {
+		return rows
+	}
+
+	kept := rows[:0:0]
+	var failed []bigqueryrow
+	var reasons []error
+	skipped := 0
+	for _, row := range rows {
+		transformed, err := sender.RowTransformer.Transform(ctx, row)
+		switch {
+		case errors.Is(err, ErrSkipRow):
+			skipped++
+		case err != nil:
+			failed = append(failed, row)
+			reasons = append(reasons, err)
+		default:
+			kept = append(kept, transformed)
+		}
+	}
+
+	if skipped > 0 {
+		sender.logger.Debug("Row transformer skipped rows",
+			zap.String("table", sender.tableID),
+			zap.Int("rows", skipped))
+	}
+	if len(failed) > 0 {
+		sender.logger.Warn("Dropping rows the row transformer failed on",
+			zap.String("table", sender.tableID),
+			zap.Int("rows", len(failed)),
+			zap.Error(reasons[0]))
+		sender.deadLetter(ctx, failed, reasons)
+	}
+	return kept
+}
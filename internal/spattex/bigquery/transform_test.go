@@ -0,0 +1,99 @@
+package bigquery
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSendRowsRedactsColumn(t *testing.T) {
+	inserter := &fakeInserter{}
+	sender := newTransformTestSender(t, redactTransformer{column: "user_email"}, inserter, &fakeInserter{})
+	rows := []bigqueryrow{{"name": "span1", "user_email": "someone@example.com"}}
+
+	require.NoError(t, sender.sendRows(context.Background(), rows))
+
+	require.Len(t, inserter.rows, 1)
+	assert.Equal(t, "REDACTED", savedRow(t, inserter.rows[0])["user_email"])
+	assert.Equal(t, "span1", savedRow(t, inserter.rows[0])["name"])
+}
+
+func TestSendRowsSkipsTransformedRows(t *testing.T) {
+	inserter, deadLetters := &fakeInserter{}, &fakeInserter{}
+	sender := newTransformTestSender(t, skipTransformer{name: "health_check"}, inserter, deadLetters)
+	rows := []bigqueryrow{
+		{"name": "health_check"},
+		{"name": "span1"},
+		{"name": "health_check"},
+	}
+
+	require.NoError(t, sender.sendRows(context.Background(), rows))
+
+	require.Len(t, inserter.rows, 1)
+	assert.Equal(t, "span1", savedRow(t, inserter.rows[0])["name"])
+	assert.Empty(t, deadLetters.putSizes, "Skipped rows should not be dead-lettered")
+}
+
+func TestSendRowsDeadLettersTransformErrors(t *testing.T) {
+	inserter, deadLetters := &fakeInserter{}, &fakeInserter{}
+	sender := newTransformTestSender(t, failTransformer{}, inserter, deadLetters)
+	rows := []bigqueryrow{{"name": "span1"}}
+
+	require.NoError(t, sender.sendRows(context.Background(), rows))
+
+	assert.Empty(t, inserter.putSizes)
+	require.Equal(t, []int{1}, deadLetters.putSizes)
+	assert.Equal(t, "transform failed", savedRow(t, deadLetters.rows[0])["error"])
+}
+
+func TestFactoryWithRowTransformer(t *testing.T) {
+	transformer := redactTransformer{column: "user_email"}
+	factory := NewFactoryWithRowTransformer(transformer)
+
+	cfg := factory.CreateDefaultConfig().(*Config)
+
+	assert.Equal(t, transformer, cfg.RowTransformer)
+	assert.Nil(t, NewFactory().CreateDefaultConfig().(*Config).RowTransformer)
+}
+
+// Helper function to create a sender with a row transformer
+func newTransformTestSender(t *testing.T, transformer RowTransformer, inserter, deadLetters rowInserter) *bigquerySender {
+	cfg := createTestConfig()
+	cfg.RowTransformer = transformer
+	return newTestSender(t, withConfig(cfg), withInserter(inserter), withDeadLetters(deadLetters))
+}
+
+// Transformer that overwrites a column's value
+type redactTransformer struct {
+	column string
+}
+
+func (r redactTransformer) Transform(ctx context.Context, row map[string]bigquery.Value) (map[string]bigquery.Value, error) {
+	if _, ok := row[r.column]; ok {
+		row[r.column] = "REDACTED"
+	}
+	return row, nil
+}
+
+// Transformer that skips rows with a given span name
+type skipTransformer struct {
+	name string
+}
+
+func (s skipTransformer) Transform(ctx context.Context, row map[string]bigquery.Value) (map[string]bigquery.Value, error) {
+	if row["name"] == s.name {
+		return nil, ErrSkipRow
+	}
+	return row, nil
+}
+
+// Transformer that fails on every row
+type failTransformer struct{}
+
+func (failTransformer) Transform(ctx context.Context, row map[string]bigquery.Value) (map[string]bigquery.Value, error) {
+	return nil, errors.New("transform failed")
+}
@@ -0,0 +1,233 @@
+package bigquery
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"math"
+	"strconv"
+
+	"cloud.google.com/go/bigquery"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.uber.org/zap"
+)
+
+// Resolve values whose type differs from their column's, as configured by
+// TypeConflictStrategy. An attribute key can carry different value types
+// across spans, but its column has a single type: the type in the cached
+// schema or, for a column that doesn't exist yet, the type of the key's first
+// value in the batch, which the schema update will give it. A slice value
+// only fits a REPEATED column, and a scalar value only a column that isn't.
+// Rows with a value that can't be resolved are dead-lettered rather than
+// failing the batch.
+// Nothing is resolved until the schema is cached.
+func (sender *bigquerySender) resolveTypeConflicts(ctx context.Context, rows []bigqueryrow) []bigqueryrow {
+	sender.schema.mu.Lock()
+	loaded := sender.schema.loaded
+	types := make(map[string]bigquery.FieldType, len(sender.schema.types))
+	for name, fieldType := range sender.schema.types {
+		types[name] = fieldType
+	}
+	repeated := make(map[string]bool, len(sender.schema.repeated))
+	for name := range sender.schema.repeated {
+		repeated[name] = true
+	}
+	sender.schema.mu.Unlock()
+	if !loaded {
+		return rows
+	}
+
+	kept := rows[:0:0]
+	var rejected []bigqueryrow
+	var reasons []error
+	dropped := 0
+	for _, row := range rows {
+		n, err := sender.resolveRow(row, types, repeated)
+		if err != nil {
+			rejected = append(rejected, row)
+			reasons = append(reasons, err)
+			continue
+		}
+		dropped += n
+		kept = append(kept, row)
+	}
+
+	attributeDropsFromContext(ctx).add(dropReasonTypeConflict, dropped)
+	if len(rejected) > 0 {
+		sender.logger.Warn("Dropping rows with values that don't match their column type",
+			zap.String("table", sender.tableID),
+			zap.Int("rows", len(rejected)),
+			zap.Error(reasons[0]))
+		sender.deadLetter(ctx, rejected, reasons)
+	}
+	return kept
+}
+
+// Resolve the row's type conflicts in place, returning the number of values
+// dropped. types and repeated are extended with the type of each new column.
+func (sender *bigquerySender) resolveRow(row bigqueryrow, types map[string]bigquery.FieldType, repeated map[string]bool) (int, error) {
+	var moved bigqueryrow
+	dropped := 0
+	for key, value := range row {
+		if value == nil {
+			// NULLs fit any column.
+			continue
+		}
+		valueType, err := inferFieldType(key, value)
+		if err != nil {
+			// Left for the schema update to report.
+			continue
+		}
+		valueRepeated := isRepeatedValue(value)
+		columnType, known := types[key]
+		if !known {
+			types[key] = valueType
+			repeated[key] = valueRepeated
+			continue
+		}
+		if fitsColumn(columnType, valueType) && repeated[key] == valueRepeated {
+			continue
+		}
+
+		switch sender.TypeConflictStrategy {
+		case typeConflictSuffix:
+			if moved == nil {
+				moved = bigqueryrow{}
+			}
+			moved[typedColumnName(key, valueType, valueRepeated)] = value
+			delete(row, key)
+		case typeConflictDrop:
+			delete(row, key)
+			dropped++
+		default:
+			coerced, ok := coerceValue(value, columnType)
+			if valueRepeated || repeated[key] {
+				coerced, ok = coerceRepeatedValue(value, columnType, repeated[key])
+			}
+			if !ok {
+				return 0, fmt.Errorf("%T value of %s doesn't fit its %s column", value, key, columnType)
+			}
+			row[key] = coerced
+		}
+	}
+
+	// Added after ranging over the row, so moved values aren't revisited.
+	for column, value := range moved {
+		valueType, _ := inferFieldType(column, value)
+		valueRepeated := isRepeatedValue(value)
+		columnType, known := types[column]
+		if known && (!fitsColumn(columnType, valueType) || repeated[column] != valueRepeated) {
+			return 0, fmt.Errorf("%T value of %s doesn't fit its %s column", value, column, columnType)
+		}
+		types[column] = valueType
+		repeated[column] = valueRepeated
+		row[column] = value
+	}
+	return dropped, nil
+}
+
+// Values of valueType can be written to a column of columnType as is. Legacy
+// NUMERIC and BIGNUMERIC columns hold int and double values respectively.
+func fitsColumn(columnType, valueType bigquery.FieldType) bool {
+	switch columnType {
+	case bigquery.NumericFieldType:
+		return valueType == bigquery.IntegerFieldType
+	case bigquery.BigNumericFieldType:
+		return valueType == bigquery.FloatFieldType
+	}
+	return columnType == valueType
+}
+
+// The value converted for a column of fieldType, REPEATED if repeated, where
+// either the value or the column is repeated and the conversion is safe.
+// Slices written to a STRING column, e.g. one created for the JSON array
+// strings older versions of the exporter wrote, are converted to JSON.
+func coerceRepeatedValue(value bigquery.Value, fieldType bigquery.FieldType, repeated bool) (bigquery.Value, bool) {
+	elements, valueRepeated := repeatedElements(value)
+	switch {
+	case valueRepeated && !repeated:
+		if fieldType == bigquery.StringFieldType {
+			return jsonString(value), true
+		}
+	case valueRepeated && repeated:
+		// Different element types, e.g. ints for a REPEATED FLOAT column.
+		switch fieldType {
+		case bigquery.StringFieldType:
+			return coerceElements[string](elements, fieldType)
+		case bigquery.IntegerFieldType:
+			return coerceElements[int64](elements, fieldType)
+		case bigquery.FloatFieldType:
+			return coerceElements[float64](elements, fieldType)
+		}
+	}
+	return nil, false
+}
+
+// The elements converted to the column type, as a []T.
+func coerceElements[T any](elements []bigquery.Value, fieldType bigquery.FieldType) (bigquery.Value, bool) {
+	values := make([]T, len(elements))
+	for i, element := range elements {
+		coerced, ok := coerceValue(element, fieldType)
+		if !ok {
+			return nil, false
+		}
+		values[i] = coerced.(T)
+	}
+	return values, true
+}
+
+// The value converted to the column type, if the conversion is safe.
+func coerceValue(value bigquery.Value, fieldType bigquery.FieldType) (bigquery.Value, bool) {
+	if value == nil {
+		return nil, true
+	}
+
+	switch fieldType {
+	case bigquery.StringFieldType:
+		switch v := value.(type) {
+		case string:
+			return v, true
+		case bool:
+			return strconv.FormatBool(v), true
+		case int64:
+			return strconv.FormatInt(v, 10), true
+		case float64:
+			return strconv.FormatFloat(v, 'g', -1, 64), true
+		case []byte:
+			return base64.StdEncoding.EncodeToString(v), true
+		}
+	case bigquery.IntegerFieldType, bigquery.NumericFieldType:
+		switch v := value.(type) {
+		case int64:
+			return v, true
+		case float64:
+			// Only whole numbers within the int64 range.
+			if v == math.Trunc(v) && v >= math.MinInt64 && v < math.MaxInt64 {
+				return int64(v), true
+			}
+		}
+	case bigquery.FloatFieldType, bigquery.BigNumericFieldType:
+		switch v := value.(type) {
+		case float64:
+			return v, true
+		case int64:
+			return float64(v), true
+		}
+	case bigquery.BooleanFieldType:
+		if v, ok := value.(bool); ok {
+			return v, true
+		}
+	case bigquery.BytesFieldType:
+		if v, ok := value.([]byte); ok {
+			return v, true
+		}
+	case bigquery.TimestampFieldType:
+		if v, ok := value.(pcommon.Timestamp); ok {
+			return v, true
+		}
+	default:
+		// Leave values for other column types to BigQuery.
+		return value, true
+	}
+	return nil, false
+}
@@ -0,0 +1,165 @@
+package bigquery
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCoerceValue(t *testing.T) {
+	tests := []struct {
+		name      string
+		value     bigquery.Value
+		fieldType bigquery.FieldType
+		expected  bigquery.Value
+		ok        bool
+	}{
+		{name: "int into FLOAT", value: int64(3), fieldType: bigquery.FloatFieldType, expected: 3.0, ok: true},
+		{name: "whole float into INTEGER", value: 3.0, fieldType: bigquery.IntegerFieldType, expected: int64(3), ok: true},
+		{name: "fractional float into INTEGER", value: 3.5, fieldType: bigquery.IntegerFieldType, ok: false},
+		{name: "bool into STRING", value: true, fieldType: bigquery.StringFieldType, expected: "true", ok: true},
+		{name: "int into STRING", value: int64(-7), fieldType: bigquery.StringFieldType, expected: "-7", ok: true},
+		{name: "bytes into STRING", value: []byte("hi"), fieldType: bigquery.StringFieldType, expected: "aGk=", ok: true},
+		{name: "string into INTEGER", value: "three", fieldType: bigquery.IntegerFieldType, ok: false},
+		{name: "string into BOOLEAN", value: "true", fieldType: bigquery.BooleanFieldType, ok: false},
+		{name: "NULL into INTEGER", value: nil, fieldType: bigquery.IntegerFieldType, expected: nil, ok: true},
+		{name: "int into NUMERIC", value: int64(3), fieldType: bigquery.NumericFieldType, expected: int64(3), ok: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			coerced, ok := coerceValue(tt.value, tt.fieldType)
+
+			assert.Equal(t, tt.ok, ok)
+			if tt.ok {
+				assert.Equal(t, tt.expected, coerced)
+			}
+		})
+	}
+}
+
+func TestSendRowsCoercesToColumnType(t *testing.T) {
+	inserter := &fakeInserter{}
+	sender := newTypeConflictTestSender(t, typeConflictCoerce, inserter, &fakeInserter{})
+	rows := []bigqueryrow{{"name": "span1", "ratio": int64(1)}}
+
+	require.NoError(t, sender.sendRows(context.Background(), rows))
+
+	require.Len(t, inserter.rows, 1)
+	assert.Equal(t, 1.0, savedRow(t, inserter.rows[0])["ratio"], "Int values should be coerced for a FLOAT column")
+}
+
+func TestSendRowsCoercesSliceToStringColumn(t *testing.T) {
+	inserter := &fakeInserter{}
+	sender := newTypeConflictTestSender(t, typeConflictCoerce, inserter, &fakeInserter{})
+	rows := []bigqueryrow{{"name": []string{"span1", "span2"}}}
+
+	require.NoError(t, sender.sendRows(context.Background(), rows))
+
+	require.Len(t, inserter.rows, 1)
+	assert.Equal(t, `["span1","span2"]`, savedRow(t, inserter.rows[0])["name"], "Slices should be written to an existing STRING column as JSON")
+}
+
+func TestSendRowsSuffixesRepeatedValues(t *testing.T) {
+	inserter := &fakeInserter{}
+	sender := newTypeConflictTestSender(t, typeConflictSuffix, inserter, &fakeInserter{})
+	rows := []bigqueryrow{{"name": []string{"span1"}}}
+
+	require.NoError(t, sender.sendRows(context.Background(), rows))
+
+	require.Len(t, inserter.rows, 1)
+	assert.Equal(t, map[string]bigquery.Value{"name_str_array": []string{"span1"}}, savedRow(t, inserter.rows[0]))
+}
+
+func TestSendRowsDeadLettersIncompatibleValues(t *testing.T) {
+	inserter, deadLetters := &fakeInserter{}, &fakeInserter{}
+	sender := newTypeConflictTestSender(t, typeConflictCoerce, inserter, deadLetters)
+	rows := []bigqueryrow{
+		{"name": "span1", "ratio": 0.5},
+		{"name": "span2", "ratio": "half"},
+	}
+
+	require.NoError(t, sender.sendRows(context.Background(), rows), "Incompatible values should not fail the batch")
+
+	assert.Equal(t, []int{1}, inserter.putSizes, "Only the compatible row should be inserted")
+	require.Equal(t, []int{1}, deadLetters.putSizes, "The incompatible row should be dead-lettered")
+	assert.Contains(t, savedRow(t, deadLetters.rows[0])["error"], "ratio")
+}
+
+func TestSendRowsTypeConflictStrategies(t *testing.T) {
+	tests := []struct {
+		strategy string
+		expected bigqueryrow
+	}{
+		{strategy: typeConflictCoerce, expected: bigqueryrow{"name": "span2", "value": "3"}},
+		{strategy: typeConflictSuffix, expected: bigqueryrow{"name": "span2", "value_int": int64(3)}},
+		{strategy: typeConflictDrop, expected: bigqueryrow{"name": "span2"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.strategy, func(t *testing.T) {
+			inserter := &fakeInserter{}
+			sender := newTypeConflictTestSender(t, tt.strategy, inserter, &fakeInserter{})
+			// value is a new column, typed by its first value.
+			rows := []bigqueryrow{
+				{"name": "span1", "value": "three"},
+				{"name": "span2", "value": int64(3)},
+			}
+
+			require.NoError(t, sender.sendRows(context.Background(), rows))
+
+			require.Len(t, inserter.rows, 2)
+			assert.Equal(t, map[string]bigquery.Value{"name": "span1", "value": "three"}, savedRow(t, inserter.rows[0]))
+			assert.Equal(t, map[string]bigquery.Value(tt.expected), savedRow(t, inserter.rows[1]))
+		})
+	}
+}
+
+func TestSendRowsSuffixesExistingColumn(t *testing.T) {
+	inserter := &fakeInserter{}
+	sender := newTypeConflictTestSender(t, typeConflictSuffix, inserter, &fakeInserter{})
+	rows := []bigqueryrow{{"name": "span1", "ratio": "half"}}
+
+	require.NoError(t, sender.sendRows(context.Background(), rows))
+
+	require.Len(t, inserter.rows, 1)
+	assert.Equal(t, map[string]bigquery.Value{"name": "span1", "ratio_str": "half"}, savedRow(t, inserter.rows[0]))
+}
+
+func TestMergeSchemaAddsSuffixedColumn(t *testing.T) {
+	sender := newTypeConflictTestSender(t, typeConflictSuffix, &fakeInserter{}, &fakeInserter{})
+	rows := sender.resolveTypeConflicts(context.Background(), []bigqueryrow{{"ratio": "half"}})
+
+	merged, newFields, err := mergeSchema(sender.logger, sender.schema.fields, rows)
+
+	require.NoError(t, err)
+	assert.Equal(t, 1, newFields)
+	assert.Equal(t, bigquery.StringFieldType, fieldType(merged, "ratio_str"))
+	assert.Equal(t, bigquery.FloatFieldType, fieldType(merged, "ratio"), "The existing column should be unchanged")
+}
+
+func TestTypedColumnNameLength(t *testing.T) {
+	name := strings.Repeat("a", maxColumnNameLength)
+
+	column := typedColumnName(name, bigquery.IntegerFieldType, false)
+
+	assert.Len(t, column, maxColumnNameLength)
+	assert.True(t, strings.HasSuffix(column, "_int"))
+}
+
+// Helper function to create a sender with a warm schema cache
+func newTypeConflictTestSender(t *testing.T, strategy string, inserter, deadLetters rowInserter) *bigquerySender {
+	table := newFakeSchemaManager(bigquery.Schema{
+		{Name: "name", Type: bigquery.StringFieldType},
+		{Name: "ratio", Type: bigquery.FloatFieldType},
+	})
+	cfg := createTestConfig()
+	cfg.TypeConflictStrategy = strategy
+	sender := newTestSender(t, withConfig(cfg), withInserter(inserter), withDeadLetters(deadLetters), withTableClients(nil, table))
+	require.NoError(t, sender.start(context.Background(), nil))
+	return sender
+}